@@ -0,0 +1,199 @@
+package smoketest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/ratelimit"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+var (
+	sessionsTotal = metrics.NewCounterVec(
+		"protohackers_smoketest_sessions_total",
+		"Echo sessions by transport: connections, or datagrams over UDP.",
+		"transport",
+	)
+	echoedBytes = metrics.NewCounterVec(
+		"protohackers_smoketest_echoed_bytes_total",
+		"Bytes echoed back by transport.",
+		"transport",
+	)
+	throttledSeconds = metrics.NewHistogramVec(
+		"protohackers_smoketest_throttled_seconds",
+		"Time a session waited for the rate limits by transport.",
+		metrics.DefaultBuckets,
+		"transport",
+	)
+	quotaExceeded = metrics.NewCounterVec(
+		"protohackers_smoketest_quota_exceeded_total",
+		"Sessions closed for sending more than the byte quota by transport.",
+		"transport",
+	)
+)
+
+// errQuotaExceeded ends a session that sent more than its byte quota.
+var errQuotaExceeded = errors.New("byte quota exceeded")
+
+// Options are the limits of the echo server.
+type Options struct {
+	// Rate is the bandwidth of a single connection in bytes per second,
+	// or 0 for no limit.
+	Rate float64
+
+	// GlobalRate is the bandwidth of all connections together in bytes
+	// per second, or 0 for no limit.
+	GlobalRate float64
+
+	// MaxBytes is the most a connection may send, or 0 for no limit.
+	MaxBytes int64
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&o.Rate, "echo-rate", o.Rate, "bandwidth of each connection in bytes per second, with a burst of one second (0 means no limit) (smoketest)")
+	fs.Float64Var(&o.GlobalRate, "echo-global-rate", o.GlobalRate, "bandwidth of all connections together in bytes per second (0 means no limit) (smoketest)")
+	fs.Int64Var(&o.MaxBytes, "echo-max-bytes", o.MaxBytes, "close connections that send more than this many bytes (0 means no limit) (smoketest)")
+}
+
+// Problem is the smoke test: an echo server. Besides TCP, it echoes over
+// Unix sockets and echoes UDP datagrams back to their sender.
+var Problem = problem.Problem{
+	Number:     0,
+	Name:       "smoketest",
+	Aliases:    []string{"echo"},
+	Title:      "Smoke Test",
+	NewOptions: func() problem.Options { return &Options{} },
+	NewServer: func(_ context.Context, opts problem.Options) (*server.Server, error) {
+		o := opts.(*Options)
+		if o.Rate < 0 || o.GlobalRate < 0 || o.MaxBytes < 0 {
+			return nil, errors.New("echo limits must not be negative")
+		}
+		return &server.Server{
+			Name:        "smoketest",
+			Handler:     newEchoServer(o.Rate, o.GlobalRate, o.MaxBytes),
+			IdleTimeout: time.Minute,
+		}, nil
+	},
+	NewPacketServer: func(context.Context, problem.Options) (*server.PacketServer, error) {
+		return &server.PacketServer{
+			Name:    "smoketest",
+			Handler: server.PacketHandlerFunc(handlePacket),
+		}, nil
+	},
+}
+
+// echoServer echoes connections within bandwidth and quota limits. The
+// zero value imposes none.
+type echoServer struct {
+	// rate is the bandwidth of a single connection in bytes per second,
+	// or 0 for no limit.
+	rate float64
+
+	// global limits the bandwidth of all connections together, or is nil.
+	global *ratelimit.Limiter
+
+	// maxBytes is the most a connection may send, or 0 for no limit.
+	maxBytes int64
+}
+
+func newEchoServer(rate, globalRate float64, maxBytes int64) *echoServer {
+	s := &echoServer{rate: rate, maxBytes: maxBytes}
+	if globalRate > 0 {
+		s.global = ratelimit.NewLimiter(globalRate, burst(globalRate))
+	}
+	return s
+}
+
+func (s *echoServer) ServeConn(ctx context.Context, conn net.Conn) {
+	logger := logging.FromContext(ctx)
+	transport := conn.LocalAddr().Network()
+	sessionsTotal.With(transport).Inc()
+
+	// Limiting what is read limits what is echoed back just as well.
+	var src io.Reader = conn
+	if s.maxBytes > 0 {
+		src = &quotaReader{r: src, remaining: s.maxBytes}
+	}
+	var own *ratelimit.Limiter
+	if s.rate > 0 {
+		own = ratelimit.NewLimiter(s.rate, burst(s.rate))
+	}
+	r := ratelimit.NewReader(ctx, src, own, s.global)
+
+	_, err := io.Copy(conn, r)
+
+	echoedBytes.With(transport).Add(uint64(r.N()))
+	throttledSeconds.With(transport).Observe(r.Waited().Seconds())
+	exceeded := errors.Is(err, errQuotaExceeded)
+	if exceeded {
+		quotaExceeded.With(transport).Inc()
+	}
+	logger.Info("session closed",
+		slog.String("transport", transport),
+		slog.Int64("bytes", r.N()),
+		slog.Duration("throttled", r.Waited()),
+		slog.Bool("quota_exceeded", exceeded),
+	)
+	// Connections cut short by the server shutting down ended normally.
+	if err != nil && !exceeded && !errors.Is(err, context.Canceled) {
+		logger.Error("failed to copy", slog.Any("err", err))
+	}
+}
+
+// burst is the burst size of a limiter of rate bytes per second: one
+// second's worth.
+func burst(rate float64) int {
+	return int(math.Ceil(rate))
+}
+
+// quotaReader reads from r until remaining bytes were read, and fails with
+// errQuotaExceeded if more follow.
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if q.remaining == 0 {
+		// Only a byte beyond the quota tells an overrun from a peer that
+		// stopped right at it.
+		var b [1]byte
+		n, err := q.r.Read(b[:])
+		if n > 0 {
+			return 0, errQuotaExceeded
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > q.remaining {
+		p = p[:q.remaining]
+	}
+	n, err := q.r.Read(p)
+	q.remaining -= int64(n)
+	return n, err
+}
+
+func handlePacket(ctx context.Context, pc net.PacketConn, addr net.Addr, payload []byte) {
+	transport := pc.LocalAddr().Network()
+	sessionsTotal.With(transport).Inc()
+
+	n, err := pc.WriteTo(payload, addr)
+	echoedBytes.With(transport).Add(uint64(n))
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to write", slog.Any("err", err))
+		return
+	}
+}
@@ -0,0 +1,304 @@
+package smoketest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/faultnet"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func Test_handleConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []byte
+	}{
+		{
+			name:    "empty payload",
+			payload: []byte{},
+			want:    []byte{},
+		},
+		{
+			name:    "hello world",
+			payload: []byte("hello world"),
+			want:    []byte("hello world"),
+		},
+		{
+			name:    "large payload",
+			payload: bytes.Repeat([]byte("0123456789"), 200),
+			want:    bytes.Repeat([]byte("0123456789"), 200),
+		},
+	}
+
+	for _, p := range faultnet.Profiles() {
+		for _, tt := range tests {
+			t.Run(p.Name+"/"+tt.name, func(t *testing.T) {
+				ctx, stopServer := context.WithCancel(context.Background())
+				defer stopServer()
+
+				ln, err := net.Listen("tcp", ":0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+
+				errs := make(chan error, 1)
+				go func() {
+					srv := server.Server{Handler: &echoServer{}, Logger: discardLogger}
+					errs <- srv.Serve(ctx, ln)
+				}()
+
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					t.Fatalf("failed to dial: %v", err)
+				}
+				conn = faultnet.Wrap(conn, p.Faults)
+				defer conn.Close()
+
+				// write request
+				n, err := conn.Write(tt.payload)
+				if err != nil {
+					t.Fatalf("failed to write: %v", err)
+				}
+				if n != len(tt.want) {
+					t.Fatalf("wrote %d bytes, want %d", n, len(tt.want))
+				}
+
+				// read response
+				b := make([]byte, len(tt.want))
+				n, err = io.ReadFull(conn, b)
+				if err != nil {
+					t.Fatalf("failed to read: %v", err)
+				}
+				if n != len(tt.want) {
+					t.Fatalf("read %d bytes, want %d", n, len(tt.want))
+				}
+
+				if !bytes.Equal(b, tt.want) {
+					t.Fatalf("got %q, want %q", b, tt.want)
+				}
+
+				if err := conn.Close(); err != nil {
+					t.Fatalf("failed to close connection: %v", err)
+				}
+
+				// check server didn't return an error after closing connection
+				if err := serverError(errs); err != nil {
+					t.Fatalf("server error: %v", err)
+				}
+
+				stopServer()
+
+				// wait for server to stop
+				select {
+				case err := <-errs:
+					if err != nil {
+						t.Fatalf("server error: %v", err)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("server did not stop")
+				}
+			})
+		}
+	}
+}
+
+func Test_handleConnection_unix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "echo.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		srv := server.Server{Handler: &echoServer{}, Logger: discardLogger}
+		srv.Serve(ctx, ln)
+	}()
+
+	before := echoedBytes.With("unix").Value()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := conn.Write([]byte("hello world")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		t.Fatalf("failed to close the writing side: %v", err)
+	}
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(got) != "hello world" {
+		t.Fatalf("got %q, want %q", got, "hello world")
+	}
+
+	// The server closed the connection, so the handler is done counting.
+	if n := echoedBytes.With("unix").Value() - before; n != uint64(len(got)) {
+		t.Errorf("counted %d echoed bytes over unix, want %d", n, len(got))
+	}
+}
+
+func TestEchoServer_limits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		srv          *echoServer
+		payload      int
+		closeWrite   bool
+		want         int
+		wantExceeded bool
+		minDuration  time.Duration
+	}{
+		{name: "within quota", srv: &echoServer{maxBytes: 10}, payload: 10, closeWrite: true, want: 10},
+		// A byte over the quota is all the server reads of the excess, so
+		// the connection is not reset over unread data.
+		{name: "over quota", srv: &echoServer{maxBytes: 10}, payload: 11, want: 10, wantExceeded: true},
+		{name: "rate", srv: &echoServer{rate: 2000}, payload: 2500, closeWrite: true, want: 2500, minDuration: 200 * time.Millisecond},
+		{name: "global rate", srv: newEchoServer(0, 2000, 0), payload: 2500, closeWrite: true, want: 2500, minDuration: 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			go func() {
+				srv := server.Server{Handler: tt.srv, Logger: discardLogger}
+				srv.Serve(ctx, ln)
+			}()
+
+			// Other tests share the counter, so only its growth is
+			// checked.
+			before := quotaExceeded.With("tcp").Value()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			start := time.Now()
+			if _, err := conn.Write(bytes.Repeat([]byte("x"), tt.payload)); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+			if tt.closeWrite {
+				conn.(*net.TCPConn).CloseWrite()
+			}
+			got, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("echoed %d bytes, want %d", len(got), tt.want)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Errorf("echo took %v, want at least %v", elapsed, tt.minDuration)
+			}
+			if tt.wantExceeded {
+				if n := quotaExceeded.With("tcp").Value() - before; n == 0 {
+					t.Error("quota exceeded was not counted")
+				}
+			}
+		})
+	}
+}
+
+func Test_quotaReader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		quota   int64
+		want    string
+		wantErr error
+	}{
+		{name: "under", input: "hello", quota: 10, want: "hello"},
+		{name: "exact", input: "hello", quota: 5, want: "hello"},
+		{name: "over", input: "hello world", quota: 5, want: "hello", wantErr: errQuotaExceeded},
+	}
+	for _, tt := range tests {
+		got, err := io.ReadAll(&quotaReader{r: strings.NewReader(tt.input), remaining: tt.quota})
+		if string(got) != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: read %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func Test_handlePacket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		srv := server.PacketServer{Handler: server.PacketHandlerFunc(handlePacket)}
+		srv.Serve(ctx, pc)
+	}()
+
+	before := sessionsTotal.With("udp").Value()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	// Every datagram comes back on its own.
+	b := make([]byte, 64)
+	for _, payload := range []string{"hello", "", "world"} {
+		if _, err := conn.Write([]byte(payload)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if got := string(b[:n]); got != payload {
+			t.Fatalf("got %q, want %q", got, payload)
+		}
+	}
+
+	if n := sessionsTotal.With("udp").Value() - before; n != 3 {
+		t.Errorf("counted %d udp sessions, want 3", n)
+	}
+}
+
+func serverError(errs <-chan error) error {
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
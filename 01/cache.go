@@ -0,0 +1,94 @@
+package primetime
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A resultCache holds the results of recent primality tests, evicting the
+// least recently used once it is full. It is safe for concurrent use. A
+// nil cache holds none.
+type resultCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[cacheKey]*list.Element
+	order    *list.List // of *cacheEntry, most recently used first
+}
+
+// A cacheKey names a test: the decimal digits of a number, and the
+// Miller-Rabin rounds it was tested with, or 0 for an exact test.
+type cacheKey struct {
+	digits string
+	rounds int
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	prime bool
+}
+
+// newResultCache returns a cache of up to capacity results. A cache with a
+// capacity of 0 holds none.
+func newResultCache(capacity int) *resultCache {
+	return &resultCache{
+		capacity: capacity,
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the cached result of a test, and whether there was one.
+func (c *resultCache) get(key cacheKey) (prime, ok bool) {
+	if c == nil {
+		return false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		cacheLookups.With("miss").Inc()
+		return false, false
+	}
+	cacheLookups.With("hit").Inc()
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).prime, true
+}
+
+// put caches the result of a test.
+func (c *resultCache) put(key cacheKey, prime bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).prime = prime
+		c.order.MoveToFront(e)
+		return
+	}
+	if c.capacity <= 0 {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, prime: prime})
+	cacheEntries.With().Inc()
+	c.evict()
+}
+
+// len returns the number of cached results.
+func (c *resultCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *resultCache) evict() {
+	for c.order.Len() > max(c.capacity, 0) {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*cacheEntry).key)
+		cacheEntries.With().Dec()
+	}
+}
@@ -0,0 +1,72 @@
+package primetime
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func Test_resultCache(t *testing.T) {
+	t.Parallel()
+
+	key := func(i int) cacheKey {
+		return cacheKey{digits: strconv.Itoa(i)}
+	}
+	c := newResultCache(3)
+	for i := 1; i <= 3; i++ {
+		c.put(key(i), i%2 == 1)
+	}
+
+	// Using 1 makes 2 the least recently used, so it goes first.
+	if prime, ok := c.get(key(1)); !ok || !prime {
+		t.Fatalf("get(1) = %v, %v, want true, true", prime, ok)
+	}
+	c.put(key(4), false)
+	if _, ok := c.get(key(2)); ok {
+		t.Error("get(2) hit after it was evicted")
+	}
+	for _, i := range []int{1, 3, 4} {
+		if prime, ok := c.get(key(i)); !ok || prime != (i%2 == 1) {
+			t.Errorf("get(%d) = %v, %v, want %v, true", i, prime, ok, i%2 == 1)
+		}
+	}
+	if _, ok := c.get(cacheKey{digits: "1", rounds: 5}); ok {
+		t.Error("get() hit with other rounds")
+	}
+
+	c = newResultCache(0)
+	c.put(key(5), true)
+	if n := c.len(); n != 0 {
+		t.Errorf("len() of a cache of capacity 0 = %d, want 0", n)
+	}
+
+	var nilCache *resultCache
+	nilCache.put(key(5), true)
+	if _, ok := nilCache.get(key(5)); ok {
+		t.Error("get() of a nil cache hit")
+	}
+}
+
+func Test_resultCache_concurrent(t *testing.T) {
+	t.Parallel()
+
+	c := newResultCache(100)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := cacheKey{digits: strconv.Itoa((g * i) % 300)}
+				if _, ok := c.get(k); !ok {
+					c.put(k, true)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := c.len(); n > 100 {
+		t.Errorf("len() = %d, want at most the capacity of 100", n)
+	}
+}
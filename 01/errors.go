@@ -0,0 +1,71 @@
+package primetime
+
+import "errors"
+
+// Error modes: how the server answers a malformed request.
+const (
+	// errorModeStrict sends the error as a line of text and disconnects,
+	// as the problem demands.
+	errorModeStrict = "strict"
+
+	// errorModeLenient sends the error as a JSON object and carries on
+	// with the next request.
+	errorModeLenient = "lenient"
+)
+
+// Codes of the errors of malformed requests. They also label the errors
+// metric.
+const (
+	codeInvalidJSON   = "invalid_json"
+	codeBadMethod     = "bad_method"
+	codeMissingNumber = "missing_number"
+	codeInvalidParams = "invalid_params"
+	codeLineTooLong   = "line_too_long"
+)
+
+// errNumberRequired is returned by params that lack their number.
+var errNumberRequired = errors.New("number is required")
+
+// A requestError is why a request is malformed.
+type requestError struct {
+	// code classifies the error.
+	code string
+
+	// err is the reason the request is malformed.
+	err error
+}
+
+// Error returns the text of the malformed response of strict mode.
+func (e *requestError) Error() string {
+	if e.code == codeInvalidJSON {
+		return "failed to decode request"
+	}
+	return "invalid request: " + e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// paramsError classifies an error returned by the params or the function
+// of a method.
+func paramsError(err error) *requestError {
+	if errors.Is(err, errNumberRequired) {
+		return &requestError{code: codeMissingNumber, err: err}
+	}
+	return &requestError{code: codeInvalidParams, err: err}
+}
+
+// An errorResponse answers a malformed request in lenient mode.
+type errorResponse struct {
+	Error errorObject `json:"error"`
+}
+
+type errorObject struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+func newErrorResponse(e *requestError) errorResponse {
+	return errorResponse{Error: errorObject{Code: e.code, Reason: e.err.Error()}}
+}
@@ -0,0 +1,183 @@
+package primetime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+// newHTTPHandler returns the gateway to srv, a server of Problem.
+func newHTTPHandler(srv *server.Server) (http.Handler, error) {
+	s, ok := srv.Handler.(*primeServer)
+	if !ok {
+		return nil, fmt.Errorf("cannot serve HTTP with handler %T", srv.Handler)
+	}
+	return &gateway{s: s}, nil
+}
+
+// A gateway answers requests POSTed over HTTP: a request object, or an
+// array of them answered by an array of responses in the same order. It
+// evaluates them on the workers of its server, and takes bodies up to its
+// line limit.
+type gateway struct {
+	s *primeServer
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := r.Body
+	if g.s.maxLine > 0 {
+		body = http.MaxBytesReader(w, r.Body, int64(g.s.maxLine))
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			logging.FromContext(ctx).Debug("failed to read request", slog.Any("err", err))
+			return
+		}
+		reqErr := &requestError{code: codeLineTooLong, err: fmt.Errorf("request is longer than %d bytes", g.s.maxLine)}
+		countMalformed(ctx, nil, reqErr)
+		g.malformed(ctx, w, reqErr)
+		return
+	}
+
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		g.serveBatch(ctx, w, b)
+		return
+	}
+
+	tokens, ok := g.acquire(ctx, len(b))
+	if !ok {
+		return
+	}
+	js, err := g.s.respond(ctx, b)
+	g.release(tokens)
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		g.malformed(ctx, w, reqErr)
+	case err != nil:
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+	default:
+		writeJSON(ctx, w, http.StatusOK, js)
+	}
+}
+
+// serveBatch answers the array of requests b with the array of their
+// responses, or of errors for those that are malformed.
+func (g *gateway) serveBatch(ctx context.Context, w http.ResponseWriter, b []byte) {
+	var reqs []json.RawMessage
+	if err := json.Unmarshal(b, &reqs); err != nil {
+		reqErr := &requestError{code: codeInvalidJSON, err: err}
+		countMalformed(ctx, b, reqErr)
+		g.malformed(ctx, w, reqErr)
+		return
+	}
+
+	resps := make([]json.RawMessage, len(reqs))
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		tokens, ok := g.acquire(ctx, len(req))
+		if !ok {
+			break
+		}
+		wg.Add(1)
+		go func(i int, req []byte) {
+			defer wg.Done()
+			defer g.release(tokens)
+
+			resps[i], errs[i] = g.s.respond(ctx, req)
+			var reqErr *requestError
+			if errors.As(errs[i], &reqErr) {
+				resps[i], errs[i] = marshal(ctx, newErrorResponse(reqErr))
+			}
+		}(i, req)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	js, err := marshal(ctx, resps)
+	if err != nil {
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(ctx, w, http.StatusOK, js)
+}
+
+// acquire takes a token from the pool of a request of n bytes and
+// returns the pool, or reports false if ctx is done first.
+func (g *gateway) acquire(ctx context.Context, n int) (chan struct{}, bool) {
+	tokens := g.s.pool(n)
+	select {
+	case tokens <- struct{}{}:
+		return tokens, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// release gives back a token taken by acquire from tokens.
+func (g *gateway) release(tokens chan struct{}) {
+	<-tokens
+}
+
+// malformed answers a malformed request with its error object.
+func (g *gateway) malformed(ctx context.Context, w http.ResponseWriter, reqErr *requestError) {
+	js, err := marshal(ctx, newErrorResponse(reqErr))
+	if err != nil {
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(ctx, w, errorStatus(reqErr.code), js)
+}
+
+// errorStatus returns the HTTP status of the errors of code: requests that
+// are not JSON are bad, and those too long too large, but those that are
+// well-formed JSON are only unprocessable.
+func errorStatus(code string) int {
+	switch code {
+	case codeInvalidJSON:
+		return http.StatusBadRequest
+	case codeLineTooLong:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, js []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(js, '\n')); err != nil {
+		logging.FromContext(ctx).Debug("failed to write response", slog.Any("err", err))
+	}
+}
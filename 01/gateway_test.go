@@ -0,0 +1,165 @@
+package primetime
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+func Test_gateway(t *testing.T) {
+	t.Parallel()
+
+	h, err := newHTTPHandler(&server.Server{Handler: newPrimeServer(false, 2, 200, 0)})
+	if err != nil {
+		t.Fatalf("newHTTPHandler() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "prime",
+			body:       `{"method":"isPrime","number":7}`,
+			wantStatus: http.StatusOK,
+			want:       `{"method":"isPrime","prime":true}`,
+		},
+		{
+			name:       "surrounded by whitespace",
+			body:       " \n{\"method\":\"isPrime\",\"number\":8}\n",
+			wantStatus: http.StatusOK,
+			want:       `{"method":"isPrime","prime":false}`,
+		},
+		{
+			name:       "invalid JSON",
+			body:       `{"method":"isPrime",`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":{"code":"invalid_json","reason":"unexpected end of JSON input"}}`,
+		},
+		{
+			name:       "empty",
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":{"code":"invalid_json","reason":"unexpected end of JSON input"}}`,
+		},
+		{
+			name:       "bad method",
+			body:       `{"method":"isEven","number":7}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			want:       `{"error":{"code":"bad_method","reason":"invalid method"}}`,
+		},
+		{
+			name:       "missing number",
+			body:       `{"method":"isPrime"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			want:       `{"error":{"code":"missing_number","reason":"number is required"}}`,
+		},
+		{
+			name:       "too long",
+			body:       `{"method":"isPrime","number":1` + strings.Repeat("0", 200) + `}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			want:       `{"error":{"code":"line_too_long","reason":"request is longer than 200 bytes"}}`,
+		},
+		{
+			name:       "batch",
+			body:       `[{"method":"isPrime","number":7}, {"method":"isEven"}, 1, {"method":"factorize","number":12}]`,
+			wantStatus: http.StatusOK,
+			want: `[{"method":"isPrime","prime":true},` +
+				`{"error":{"code":"bad_method","reason":"invalid method"}},` +
+				`{"error":{"code":"invalid_json","reason":"json: cannot unmarshal number into Go value of type primetime.request"}},` +
+				`{"method":"factorize","factors":[2,2,3]}]`,
+		},
+		{
+			name:       "empty batch",
+			body:       `[]`,
+			wantStatus: http.StatusOK,
+			want:       `[]`,
+		},
+		{
+			name:       "invalid batch",
+			body:       `[{"method":"isPrime","number":7}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":{"code":"invalid_json","reason":"unexpected end of JSON input"}}`,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			want:       "Method Not Allowed",
+		},
+		{
+			name:       "wrong path",
+			path:       "/isPrime",
+			body:       `{"method":"isPrime","number":7}`,
+			wantStatus: http.StatusNotFound,
+			want:       "404 page not found",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			method, path := tt.method, tt.path
+			if method == "" {
+				method = http.MethodPost
+			}
+			if path == "" {
+				path = "/"
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+			if tt.method == http.MethodGet {
+				if allow := rec.Header().Get("Allow"); allow != http.MethodPost {
+					t.Errorf("Allow = %q, want %q", allow, http.MethodPost)
+				}
+			}
+		})
+	}
+}
+
+func Test_gateway_metrics(t *testing.T) {
+	// Not parallel: it counts the metrics the other tests add to as well.
+	h, err := newHTTPHandler(&server.Server{Handler: newPrimeServer(false, 1, 0, 0)})
+	if err != nil {
+		t.Fatalf("newHTTPHandler() error = %v", err)
+	}
+
+	requests := requestsTotal.With("isPrime").Value()
+	errs := errorsTotal.With(codeBadMethod).Value()
+
+	body := `[{"method":"isPrime","number":1},{"method":"isPrime","number":2},{"method":"isOdd","number":3}]`
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"method":"isPrime","number":3}`)))
+
+	if n := requestsTotal.With("isPrime").Value() - requests; n != 3 {
+		t.Errorf("counted %d isPrime requests, want 3", n)
+	}
+	if n := errorsTotal.With(codeBadMethod).Value() - errs; n != 1 {
+		t.Errorf("counted %d %s errors, want 1", n, codeBadMethod)
+	}
+}
+
+func Test_newHTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	srv := &server.Server{Handler: server.HandlerFunc(func(context.Context, net.Conn) {})}
+	if _, err := newHTTPHandler(srv); err == nil {
+		t.Error("newHTTPHandler() of a server of another problem error = nil, want an error")
+	}
+}
@@ -0,0 +1,71 @@
+package primetime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// errLineTooLong is returned for a line longer than the limit of a
+// lineReader.
+var errLineTooLong = errors.New("line too long")
+
+// A lineReader reads newline-terminated lines of any length, or of up to a
+// limit. Unlike a bufio.Scanner, it does not give up on a line over the
+// limit: it skips it, without holding it in memory, and goes on with the
+// next one.
+type lineReader struct {
+	r *bufio.Reader
+
+	// max is the length limit of a line, without its newline, or 0 for
+	// none.
+	max int
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{r: bufio.NewReader(r), max: max}
+}
+
+// ReadLine returns the next line without its newline, or a carriage return
+// before it. The last line need not end with a newline. It returns
+// errLineTooLong for a line over the limit, once the line was skipped, and
+// io.EOF at the end of the input.
+func (l *lineReader) ReadLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		content := bytes.TrimSuffix(chunk, []byte("\n"))
+		if l.max > 0 && len(line)+len(bytes.TrimSuffix(content, []byte("\r"))) > l.max {
+			if err == bufio.ErrBufferFull {
+				err = l.skipLine()
+			}
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, errLineTooLong
+		}
+		line = append(line, content...)
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(line) > 0:
+			return bytes.TrimSuffix(line, []byte("\r")), nil
+		case err != nil:
+			return nil, err
+		default:
+			return bytes.TrimSuffix(line, []byte("\r")), nil
+		}
+	}
+}
+
+// skipLine discards the rest of a line, up to and including its newline.
+func (l *lineReader) skipLine() error {
+	for {
+		_, err := l.r.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
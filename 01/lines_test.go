@@ -0,0 +1,92 @@
+package primetime
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_lineReader(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 10000)
+
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want []string // "!" stands for errLineTooLong
+	}{
+		{name: "lines", in: "a\nbc\n\nd\n", want: []string{"a", "bc", "", "d"}},
+		{name: "last line without newline", in: "a\nbc", want: []string{"a", "bc"}},
+		{name: "crlf", in: "a\r\nb\r\n", want: []string{"a", "b"}},
+		{name: "empty", in: "", want: nil},
+		{name: "longer than the buffer", in: long + "\nb\n", want: []string{long, "b"}},
+		{name: "at the limit", in: "abc\nabcd\n", max: 4, want: []string{"abc", "abcd"}},
+		{name: "crlf at the limit", in: "abcd\r\n", max: 4, want: []string{"abcd"}},
+		{name: "over the limit", in: "abcde\nab\n", max: 4, want: []string{"!", "ab"}},
+		{name: "over the limit at the end", in: "ab\nabcde", max: 4, want: []string{"ab", "!"}},
+		{name: "far over the limit", in: long + "\n" + long + "\nab\n", max: 100, want: []string{"!", "!", "ab"}},
+		{name: "far over the limit at the end", in: "ab\n" + long, max: 100, want: []string{"ab", "!"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			lr := newLineReader(strings.NewReader(tt.in), tt.max)
+			var got []string
+			for {
+				line, err := lr.ReadLine()
+				if err == io.EOF {
+					break
+				}
+				switch {
+				case errors.Is(err, errLineTooLong):
+					got = append(got, "!")
+				case err != nil:
+					t.Fatalf("ReadLine() error = %v", err)
+				default:
+					got = append(got, string(line))
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lineReader_skipsInPlace(t *testing.T) {
+	// Not parallel: it measures the memory the whole program allocates.
+	const size = 64 << 20
+	r := io.MultiReader(io.LimitReader(repeatReader('1'), size), strings.NewReader("\n7\n"))
+	lr := newLineReader(r, 1<<10)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := lr.ReadLine(); !errors.Is(err, errLineTooLong) {
+		t.Fatalf("ReadLine() of a %d-byte line error = %v, want %v", size, err, errLineTooLong)
+	}
+	line, err := lr.ReadLine()
+	runtime.ReadMemStats(&after)
+	if err != nil || string(line) != "7" {
+		t.Fatalf("ReadLine() after the long line = %q, %v, want %q", line, err, "7")
+	}
+
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("skipping a %d-byte line allocated %d bytes", size, alloc)
+	}
+}
+
+// repeatReader reads as an endless run of its byte.
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,46 @@
+package primetime
+
+import "encoding/json"
+
+// A method is a procedure the service offers. Its params are the fields of
+// a request beside "method", and its result is sent as the fields of the
+// response beside "method".
+type method struct {
+	// decode decodes the params of a request line.
+	decode func(b []byte) (params any, err error)
+
+	// call evaluates params returned by decode, caching primality
+	// results in c.
+	call func(c *resultCache, params any) (result any, err error)
+}
+
+// methods are the methods of the service, keyed by name.
+var methods = map[string]method{}
+
+// register adds a method whose params decode from a request into a P and
+// whose result is an R, which must encode as a JSON object. If P has a
+// Validate method, requests whose params it rejects are malformed, and so
+// are those fn fails on. fn is passed the cache of the server, which
+// methods that test primality keep their results in.
+//
+// register is called from the init functions of the files holding the
+// methods.
+func register[P, R any](name string, fn func(c *resultCache, p P) (R, error)) {
+	methods[name] = method{
+		decode: func(b []byte) (any, error) {
+			var params P
+			if err := json.Unmarshal(b, &params); err != nil {
+				return nil, err
+			}
+			return params, nil
+		},
+		call: func(c *resultCache, params any) (any, error) {
+			return fn(c, params.(P))
+		},
+	}
+}
+
+// validator is implemented by params that check themselves.
+type validator interface {
+	Validate() error
+}
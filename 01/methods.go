@@ -0,0 +1,101 @@
+package primetime
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Bounds on the numbers the costlier methods take.
+const (
+	// maxNextPrimeDigits keeps nextPrime to numbers of about 512 bits.
+	maxNextPrimeDigits = 155
+
+	// maxPrimeCount is the largest number primeCount counts up to.
+	maxPrimeCount = 100_000_000
+
+	// maxRounds is the most Miller-Rabin rounds isProbablePrime runs.
+	maxRounds = 100
+
+	// defaultRounds is the number of rounds isProbablePrime runs if the
+	// request does not say.
+	defaultRounds = 20
+)
+
+func init() {
+	register("isPrime", func(c *resultCache, p numberParams) (primeResult, error) {
+		return primeResult{Prime: isPrime(c, *p.Number)}, nil
+	})
+	register("isProbablePrime", func(c *resultCache, p probablePrimeParams) (primeResult, error) {
+		rounds := defaultRounds
+		if p.Rounds != nil {
+			rounds = *p.Rounds
+		}
+		return primeResult{Prime: probablyPrime(c, *p.Number, rounds)}, nil
+	})
+	register("nextPrime", func(_ *resultCache, p numberParams) (numberResult, error) {
+		n, err := p.Number.integer(maxNextPrimeDigits)
+		if err != nil {
+			return numberResult{}, err
+		}
+		return numberResult{Number: nextPrime(n)}, nil
+	})
+	register("factorize", func(c *resultCache, p numberParams) (factorsResult, error) {
+		n, err := p.Number.integer(20)
+		if err != nil || n.Sign() <= 0 || !n.IsUint64() {
+			return factorsResult{}, fmt.Errorf("number is not an integer from 1 to %d", uint64(1<<64-1))
+		}
+		return factorsResult{Factors: factorize(c, n.Uint64())}, nil
+	})
+	register("primeCount", func(_ *resultCache, p numberParams) (countResult, error) {
+		n, err := p.Number.integer(9)
+		if err != nil || n.Cmp(big.NewInt(maxPrimeCount)) > 0 {
+			return countResult{}, fmt.Errorf("number is not an integer of at most %d", maxPrimeCount)
+		}
+		return countResult{Count: primeCount(n.Int64())}, nil
+	})
+}
+
+// numberParams are the params of methods that take a number.
+type numberParams struct {
+	Number *number `json:"number"`
+}
+
+func (p numberParams) Validate() error {
+	if p.Number == nil {
+		return errNumberRequired
+	}
+	return nil
+}
+
+type probablePrimeParams struct {
+	numberParams
+
+	// Rounds is the number of Miller-Rabin rounds to run.
+	Rounds *int `json:"rounds"`
+}
+
+func (p probablePrimeParams) Validate() error {
+	if err := p.numberParams.Validate(); err != nil {
+		return err
+	}
+	if p.Rounds != nil && (*p.Rounds < 0 || *p.Rounds > maxRounds) {
+		return fmt.Errorf("rounds is not from 0 to %d", maxRounds)
+	}
+	return nil
+}
+
+type primeResult struct {
+	Prime bool `json:"prime"`
+}
+
+type numberResult struct {
+	Number *big.Int `json:"number"`
+}
+
+type factorsResult struct {
+	Factors []uint64 `json:"factors"`
+}
+
+type countResult struct {
+	Count int `json:"count"`
+}
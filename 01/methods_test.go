@@ -0,0 +1,207 @@
+package primetime
+
+import (
+	"encoding/json"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+func init() {
+	// negate is a method of the tests only, which plugs into the service
+	// like the others.
+	register("negate", func(_ *resultCache, p numberParams) (numberResult, error) {
+		n, err := p.Number.integer(100)
+		if err != nil {
+			return numberResult{}, err
+		}
+		return numberResult{Number: n.Neg(n)}, nil
+	})
+}
+
+// answer returns the response the service sends for a request line.
+func answer(line string) (string, error) {
+	req, err := parseRequest([]byte(line))
+	if err != nil {
+		return "", err
+	}
+	res, err := req.evaluate(nil)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(res)
+	return string(b), err
+}
+
+// methodTests are the cases of Test_methods, and seeds of
+// FuzzParseRequest.
+var methodTests = []struct {
+	name    string
+	in      string
+	want    string
+	wantErr string
+}{
+	{name: "isPrime", in: `{"method":"isPrime","number":7}`, want: `{"method":"isPrime","prime":true}`},
+	{name: "isPrime composite", in: `{"method":"isPrime","number":8}`, want: `{"method":"isPrime","prime":false}`},
+	{name: "isPrime extra fields", in: `{"number":13,"rounds":-1,"method":"isPrime"}`, want: `{"method":"isPrime","prime":true}`},
+
+	{name: "isProbablePrime", in: `{"method":"isProbablePrime","number":18446744073709551629}`, want: `{"method":"isProbablePrime","prime":true}`},
+	{name: "isProbablePrime rounds", in: `{"method":"isProbablePrime","number":561,"rounds":5}`, want: `{"method":"isProbablePrime","prime":false}`},
+	{name: "isProbablePrime no rounds", in: `{"method":"isProbablePrime","number":7919,"rounds":0}`, want: `{"method":"isProbablePrime","prime":true}`},
+	{name: "isProbablePrime fraction", in: `{"method":"isProbablePrime","number":7.5}`, want: `{"method":"isProbablePrime","prime":false}`},
+	{name: "isProbablePrime negative rounds", in: `{"method":"isProbablePrime","number":7,"rounds":-1}`, wantErr: "invalid request: rounds is not from 0 to 100"},
+	{name: "isProbablePrime too many rounds", in: `{"method":"isProbablePrime","number":7,"rounds":101}`, wantErr: "invalid request: rounds is not from 0 to 100"},
+	{name: "isProbablePrime fractional rounds", in: `{"method":"isProbablePrime","number":7,"rounds":1.5}`, wantErr: "failed to decode request"},
+	{name: "isProbablePrime missing number", in: `{"method":"isProbablePrime","rounds":1}`, wantErr: "invalid request: number is required"},
+
+	{name: "nextPrime", in: `{"method":"nextPrime","number":7}`, want: `{"method":"nextPrime","number":11}`},
+	{name: "nextPrime even", in: `{"method":"nextPrime","number":8}`, want: `{"method":"nextPrime","number":11}`},
+	{name: "nextPrime zero", in: `{"method":"nextPrime","number":0}`, want: `{"method":"nextPrime","number":2}`},
+	{name: "nextPrime negative", in: `{"method":"nextPrime","number":-100}`, want: `{"method":"nextPrime","number":2}`},
+	{name: "nextPrime two", in: `{"method":"nextPrime","number":2}`, want: `{"method":"nextPrime","number":3}`},
+	{name: "nextPrime exponent", in: `{"method":"nextPrime","number":1e2}`, want: `{"method":"nextPrime","number":101}`},
+	{name: "nextPrime beyond 64 bits", in: `{"method":"nextPrime","number":18446744073709551616}`, want: `{"method":"nextPrime","number":18446744073709551629}`},
+	{name: "nextPrime fraction", in: `{"method":"nextPrime","number":7.5}`, wantErr: "invalid request: number is not an integer"},
+	{name: "nextPrime too large", in: `{"method":"nextPrime","number":1e155}`, wantErr: "invalid request: number has more than 155 digits"},
+
+	{name: "factorize", in: `{"method":"factorize","number":360}`, want: `{"method":"factorize","factors":[2,2,2,3,3,5]}`},
+	{name: "factorize one", in: `{"method":"factorize","number":1}`, want: `{"method":"factorize","factors":[]}`},
+	{name: "factorize prime", in: `{"method":"factorize","number":7919}`, want: `{"method":"factorize","factors":[7919]}`},
+	{name: "factorize exponent", in: `{"method":"factorize","number":1E3}`, want: `{"method":"factorize","factors":[2,2,2,5,5,5]}`},
+	{name: "factorize largest", in: `{"method":"factorize","number":18446744073709551615}`, want: `{"method":"factorize","factors":[3,5,17,257,641,65537,6700417]}`},
+	{name: "factorize zero", in: `{"method":"factorize","number":0}`, wantErr: "invalid request: number is not an integer from 1 to 18446744073709551615"},
+	{name: "factorize negative", in: `{"method":"factorize","number":-6}`, wantErr: "invalid request: number is not an integer from 1 to 18446744073709551615"},
+	{name: "factorize beyond 64 bits", in: `{"method":"factorize","number":18446744073709551616}`, wantErr: "invalid request: number is not an integer from 1 to 18446744073709551615"},
+	{name: "factorize fraction", in: `{"method":"factorize","number":6.5}`, wantErr: "invalid request: number is not an integer from 1 to 18446744073709551615"},
+
+	{name: "primeCount", in: `{"method":"primeCount","number":100}`, want: `{"method":"primeCount","count":25}`},
+	{name: "primeCount negative", in: `{"method":"primeCount","number":-100}`, want: `{"method":"primeCount","count":0}`},
+	{name: "primeCount largest", in: `{"method":"primeCount","number":1e8}`, want: `{"method":"primeCount","count":5761455}`},
+	{name: "primeCount too large", in: `{"method":"primeCount","number":100000001}`, wantErr: "invalid request: number is not an integer of at most 100000000"},
+	{name: "primeCount fraction", in: `{"method":"primeCount","number":100.5}`, wantErr: "invalid request: number is not an integer of at most 100000000"},
+
+	{name: "plugged in", in: `{"method":"negate","number":7}`, want: `{"method":"negate","number":-7}`},
+	{name: "unknown method", in: `{"method":"isComposite","number":7}`, wantErr: "invalid request: invalid method"},
+	{name: "method case", in: `{"method":"IsPrime","number":7}`, wantErr: "invalid request: invalid method"},
+	{name: "missing method", in: `{"number":7}`, wantErr: "invalid request: invalid method"},
+	{name: "number as string", in: `{"method":"nextPrime","number":"7"}`, wantErr: "failed to decode request"},
+}
+
+func Test_methods(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range methodTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := answer(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("answer(%s) = %s, %v, want error %q", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("answer(%s) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("answer(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_response_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(response{Method: "nothing", Result: struct{}{}})
+	if err != nil || string(b) != `{"method":"nothing"}` {
+		t.Errorf("json.Marshal() of an empty result = %s, %v, want %s", b, err, `{"method":"nothing"}`)
+	}
+	if b, err := json.Marshal(response{Method: "scalar", Result: 7}); err == nil {
+		t.Errorf("json.Marshal() of a scalar result = %s, want an error", b)
+	}
+}
+
+func Test_factorize(t *testing.T) {
+	t.Parallel()
+
+	tests := [][]uint64{
+		{2},
+		{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+		{997, 1009},
+		{1000003, 1000003},
+		{101, 101, 101, 101, 101, 101, 101, 101, 101},
+		{4294967279, 4294967291},
+		{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47},
+		{18446744073709551557},
+	}
+	for _, want := range tests {
+		n := uint64(1)
+		for _, f := range want {
+			n *= f
+		}
+		if got := factorize(nil, n); !slices.Equal(got, want) {
+			t.Errorf("factorize(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	// Every number up to 10000 is the product of its factors, which are
+	// prime.
+	for n := uint64(1); n <= 10000; n++ {
+		product := uint64(1)
+		for _, f := range factorize(nil, n) {
+			if !isPrime64(nil, f) {
+				t.Fatalf("factorize(%d) has %d, which is not prime", n, f)
+			}
+			product *= f
+		}
+		if product != n {
+			t.Fatalf("factors of %d multiply to %d", n, product)
+		}
+	}
+}
+
+func Test_primeCount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int64
+		want int
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 0},
+		{2, 1},
+		{3, 2},
+		{10, 4},
+		{1000, 168},
+		{segmentSize - 1, 6542},
+		{segmentSize, 6542},
+		{segmentSize + 1, 6543},
+		{1_000_000, 78498},
+		{10_000_000, 664579},
+	}
+	for _, tt := range tests {
+		if got := primeCount(tt.n); got != tt.want {
+			t.Errorf("primeCount(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func Test_nextPrime(t *testing.T) {
+	t.Parallel()
+
+	for n := int64(-2); n < 1000; n++ {
+		got := nextPrime(big.NewInt(n)).Int64()
+		if got <= n || !isPrime64(nil, uint64(got)) {
+			t.Fatalf("nextPrime(%d) = %d, want a prime above it", n, got)
+		}
+		for m := max(n+1, 2); m < got; m++ {
+			if isPrime64(nil, uint64(m)) {
+				t.Fatalf("nextPrime(%d) = %d, want %d", n, got, m)
+			}
+		}
+	}
+}
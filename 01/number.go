@@ -0,0 +1,97 @@
+package primetime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxExp bounds the exponents decimal works with, so that adding the
+// length of a fraction to one cannot overflow. Clamping changes nothing
+// that matters: past it a number is a multiple of ten or not an integer
+// either way.
+const maxExp = 1 << 62
+
+// A number is a JSON number of any size and precision, kept as the text
+// it was sent as.
+type number struct {
+	value json.Number
+}
+
+func (n number) String() string {
+	return n.value.String()
+}
+
+// MarshalJSON writes n as the text it was sent as.
+func (n number) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.value)
+}
+
+// UnmarshalJSON accepts JSON numbers only. A json.Number on its own also
+// takes strings that hold a number, which the protocol counts as
+// malformed.
+func (n *number) UnmarshalJSON(b []byte) error {
+	// The decoder has checked b is valid JSON, so anything that starts
+	// like a number is one.
+	if len(b) == 0 || (b[0] != '-' && (b[0] < '0' || b[0] > '9')) {
+		return errors.New("number is not a number")
+	}
+	n.value = json.Number(b)
+	return nil
+}
+
+// decimal splits n into a coefficient and a power of ten, so that n is
+// coef×10^exp. The coefficient is a string of decimal digits, with a minus
+// sign if n is negative, and without leading or trailing zeros, so that
+// numbers too long to parse quickly can be classified without parsing
+// them. n is an integer if exp is not negative. Zero is 0×10^0.
+func (n number) decimal() (coef string, exp int64) {
+	s := n.String()
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(strings.TrimPrefix(s[i+1:], "+"), 10, 64)
+		if err != nil {
+			// Only the range can be wrong in a valid JSON number.
+			exp = maxExp
+			if s[i+1] == '-' {
+				exp = -maxExp
+			}
+		}
+		exp = max(min(exp, maxExp), -maxExp)
+		s = s[:i]
+	}
+	if whole, frac, ok := strings.Cut(s, "."); ok {
+		s = whole + frac
+		exp -= int64(len(frac))
+	}
+
+	sign, s := "", strings.TrimLeft(s, "0")
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = "-", strings.TrimLeft(rest, "0")
+	}
+	digits := strings.TrimRight(s, "0")
+	if digits == "" {
+		return "0", 0
+	}
+	return sign + digits, exp + int64(len(s)-len(digits))
+}
+
+// integer returns n as an integer. It fails if n is not an integer or has
+// more than maxDigits digits.
+func (n number) integer(maxDigits int) (*big.Int, error) {
+	coef, exp := n.decimal()
+	if exp < 0 {
+		return nil, errors.New("number is not an integer")
+	}
+	if exp > int64(maxDigits-len(strings.TrimPrefix(coef, "-"))) {
+		return nil, fmt.Errorf("number has more than %d digits", maxDigits)
+	}
+	i, _ := new(big.Int).SetString(coef, 10)
+	if exp == 0 {
+		return i, nil
+	}
+	return i.Mul(i, new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil)), nil
+}
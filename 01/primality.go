@@ -0,0 +1,145 @@
+package primetime
+
+import (
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// sieveLimit bounds the numbers looked up in the sieve.
+	sieveLimit = 1 << 20
+
+	// defaultCacheSize is the default capacity of the cache of a server.
+	defaultCacheSize = 1 << 16
+
+	// maxCachedDigits bounds the numbers a cache holds, so that it stays
+	// small however long the numbers it is asked about.
+	maxCachedDigits = 1000
+)
+
+// smallPrimes is a sieve of the odd numbers below sieveLimit: bit i is set
+// if 2i+1 is composite. It is computed on first use.
+var smallPrimes = sync.OnceValue(func() []uint64 {
+	composite := make([]uint64, sieveLimit/128)
+	for i := uint64(3); i*i < sieveLimit; i += 2 {
+		if composite[i/128]&(1<<(i/2%64)) != 0 {
+			continue
+		}
+		for m := i * i; m < sieveLimit; m += 2 * i {
+			composite[m/128] |= 1 << (m / 2 % 64)
+		}
+	}
+	return composite
+})
+
+// isPrime reports whether n is a prime number, caching the result in c.
+// Numbers that are not integers are not prime.
+func isPrime(c *resultCache, n number) bool {
+	return probablyPrime(c, n, 20)
+}
+
+// probablyPrime is isPrime for numbers beyond 64 bits that, on top of a
+// Baillie-PSW test, run the given number of Miller-Rabin rounds. Numbers
+// up to 64 bits are tested exactly whatever the rounds.
+func probablyPrime(c *resultCache, n number, rounds int) bool {
+	coef, exp := n.decimal()
+	// With a positive exponent, n is a multiple of ten.
+	if exp != 0 || strings.HasPrefix(coef, "-") {
+		return false
+	}
+	if u, err := strconv.ParseUint(coef, 10, 64); err == nil {
+		return isPrime64(c, u)
+	}
+
+	// The last digit rules out most numbers without parsing the rest.
+	switch coef[len(coef)-1] {
+	case '0', '2', '4', '5', '6', '8':
+		return false
+	}
+
+	key := cacheKey{digits: coef, rounds: rounds}
+	cached := len(coef) <= maxCachedDigits
+	if cached {
+		if prime, ok := c.get(key); ok {
+			return prime
+		}
+	}
+	i, _ := new(big.Int).SetString(coef, 10)
+	prime := i.ProbablyPrime(rounds)
+	if cached {
+		c.put(key, prime)
+	}
+	return prime
+}
+
+// isPrime64 reports whether n is prime: small numbers are looked up in the
+// sieve, recently tested ones in the cache c, and the others are tested by
+// deterministic Miller-Rabin.
+func isPrime64(c *resultCache, n uint64) bool {
+	if n < sieveLimit {
+		if n%2 == 0 {
+			return n == 2
+		}
+		return n != 1 && smallPrimes()[n/128]&(1<<(n/2%64)) == 0
+	}
+	for _, p := range millerRabinBases {
+		if n%p == 0 {
+			return false
+		}
+	}
+
+	key := cacheKey{digits: strconv.FormatUint(n, 10)}
+	if prime, ok := c.get(key); ok {
+		return prime
+	}
+	prime := millerRabin(n)
+	c.put(key, prime)
+	return prime
+}
+
+// millerRabinBases are the bases that make Miller-Rabin exact for numbers
+// below 3.3×10^24, which covers every 64-bit number.
+var millerRabinBases = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+
+// millerRabin reports whether n, which must be odd and greater than the
+// largest base, is prime.
+func millerRabin(n uint64) bool {
+	d := n - 1
+	s := bits.TrailingZeros64(d)
+	d >>= s
+
+	for _, a := range millerRabinBases {
+		x := powMod(a, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+		witness := true
+		for r := 1; r < s; r++ {
+			x = mulMod(x, x, n)
+			if x == n-1 {
+				witness = false
+				break
+			}
+		}
+		if witness {
+			return false
+		}
+	}
+	return true
+}
+
+func powMod(a, e, n uint64) uint64 {
+	result := uint64(1)
+	a %= n
+	for e > 0 {
+		if e&1 == 1 {
+			result = mulMod(result, a, n)
+		}
+		a = mulMod(a, a, n)
+		e >>= 1
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package primetime
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func Test_isPrime64(t *testing.T) {
+	t.Parallel()
+
+	check := func(n uint64) {
+		t.Helper()
+		if got, want := isPrime64(nil, n), new(big.Int).SetUint64(n).ProbablyPrime(20); got != want {
+			t.Fatalf("isPrime64(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	// The whole sieve, its edge and beyond.
+	const limit = sieveLimit + 10000
+	prime := make([]bool, limit)
+	for _, p := range sieve(limit - 1) {
+		prime[p] = true
+	}
+	for n := uint64(0); n < limit; n++ {
+		if got := isPrime64(nil, n); got != prime[n] {
+			t.Fatalf("isPrime64(%d) = %v, want %v", n, got, prime[n])
+		}
+	}
+
+	// Numbers that fool weaker tests: Carmichael numbers, strong
+	// pseudoprimes to several bases, and squares of primes.
+	for _, n := range []uint64{
+		561, 41041, 825265, 321197185, 5394826801, 232250619601, 9746347772161,
+		2047, 1373653, 25326001, 3215031751, 2152302898747, 3474749660383,
+		341550071728321, 3825123056546413051,
+		4294967291 * 4294967291, 4294967279 * 4294967291,
+		1<<61 - 1, 1<<64 - 59, 1<<64 - 1,
+	} {
+		check(n)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		check(r.Uint64() | 1)
+	}
+}
+
+func Test_isPrime_cache(t *testing.T) {
+	// Not parallel: it counts the lookups in every cache.
+	c := newResultCache(defaultCacheSize)
+	n := number{value: "170141183460469231731687303715884105727"}
+
+	misses, hits := cacheLookups.With("miss").Value(), cacheLookups.With("hit").Value()
+	for i := 0; i < 3; i++ {
+		if !isPrime(c, n) {
+			t.Fatalf("isPrime(%s) = false, want true", n)
+		}
+	}
+	if got := cacheLookups.With("miss").Value() - misses; got != 1 {
+		t.Errorf("counted %d cache misses, want 1", got)
+	}
+	if got := cacheLookups.With("hit").Value() - hits; got != 2 {
+		t.Errorf("counted %d cache hits, want 2", got)
+	}
+
+	// Other rounds are another test.
+	if !probablyPrime(c, n, 5) {
+		t.Fatalf("probablyPrime(%s, 5) = false, want true", n)
+	}
+	if got := cacheLookups.With("miss").Value() - misses; got != 2 {
+		t.Errorf("counted %d cache misses after other rounds, want 2", got)
+	}
+}
+
+// bigIsPrime is how numbers were tested before the sieve and the cache.
+func bigIsPrime(n number) bool {
+	coef, exp := n.decimal()
+	if exp != 0 {
+		return false
+	}
+	i, _ := new(big.Int).SetString(coef, 10)
+	return i.ProbablyPrime(20)
+}
+
+func BenchmarkIsPrime(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	numbers := func(n int, gen func() string) []number {
+		ns := make([]number, n)
+		for i := range ns {
+			ns[i] = number{value: json.Number(gen())}
+		}
+		return ns
+	}
+	bigPrimes := numbers(100, func() string {
+		return nextPrime(new(big.Int).Rand(r, new(big.Int).Lsh(big.NewInt(1), 128))).String()
+	})
+
+	workloads := []struct {
+		name    string
+		numbers []number
+	}{
+		{name: "small", numbers: numbers(10000, func() string { return fmt.Sprint(r.Intn(sieveLimit)) })},
+		{name: "64-bit", numbers: numbers(10000, func() string { return fmt.Sprint(r.Uint64()) })},
+		{name: "repeated 128-bit primes", numbers: bigPrimes},
+	}
+	c := newResultCache(defaultCacheSize)
+	impls := []struct {
+		name    string
+		isPrime func(number) bool
+	}{
+		{name: "big.Int", isPrime: bigIsPrime},
+		{name: "sieve and cache", isPrime: func(n number) bool { return isPrime(c, n) }},
+	}
+	for _, w := range workloads {
+		for _, impl := range impls {
+			w, impl := w, impl
+			b.Run(w.name+"/"+impl.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					impl.isPrime(w.numbers[i%len(w.numbers)])
+				}
+			})
+		}
+	}
+}
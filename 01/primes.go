@@ -0,0 +1,154 @@
+package primetime
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+	"slices"
+)
+
+// nextPrime returns the smallest prime greater than n.
+func nextPrime(n *big.Int) *big.Int {
+	two := big.NewInt(2)
+	if n.Cmp(two) < 0 {
+		return two
+	}
+	p := new(big.Int).Add(n, big.NewInt(1))
+	if p.Bit(0) == 0 {
+		p.Add(p, big.NewInt(1))
+	}
+	for !p.ProbablyPrime(20) {
+		p.Add(p, two)
+	}
+	return p
+}
+
+// factorize returns the prime factors of n in ascending order, repeated as
+// often as they divide n. 1 has none. The primality of the factors is
+// cached in c.
+func factorize(c *resultCache, n uint64) []uint64 {
+	factors := []uint64{}
+	for _, p := range []uint64{2, 3} {
+		for n%p == 0 {
+			factors = append(factors, p)
+			n /= p
+		}
+	}
+	// Trial division takes out the small factors, and Pollard's rho
+	// splits what is left.
+	for d := uint64(5); d < 1000 && d*d <= n; d += 2 {
+		for n%d == 0 {
+			factors = append(factors, d)
+			n /= d
+		}
+	}
+	rest := []uint64{}
+	if n > 1 {
+		rest = append(rest, n)
+	}
+	for len(rest) > 0 {
+		m := rest[len(rest)-1]
+		rest = rest[:len(rest)-1]
+		if isPrime64(c, m) {
+			factors = append(factors, m)
+			continue
+		}
+		d := rho(m)
+		rest = append(rest, d, m/d)
+	}
+	slices.Sort(factors)
+	return factors
+}
+
+// rho returns a nontrivial factor of n, which must be composite and odd,
+// by Pollard's rho method.
+func rho(n uint64) uint64 {
+	for c := uint64(1); ; c++ {
+		f := func(x uint64) uint64 {
+			return addMod(mulMod(x, x, n), c, n)
+		}
+		x, y, d := uint64(2), uint64(2), uint64(1)
+		for d == 1 {
+			x = f(x)
+			y = f(f(y))
+			d = gcd(max(x, y)-min(x, y), n)
+		}
+		// A cycle without a factor; try another polynomial.
+		if d != n {
+			return d
+		}
+	}
+}
+
+func mulMod(a, b, n uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, n)
+}
+
+func addMod(a, b, n uint64) uint64 {
+	s, carry := bits.Add64(a, b%n, 0)
+	if carry != 0 || s >= n {
+		s -= n
+	}
+	return s
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// segmentSize is the number of integers primeCount sieves at a time.
+const segmentSize = 1 << 16
+
+// primeCount returns the number of primes up to n. It sieves n in
+// segments, so its memory does not grow with n.
+func primeCount(n int64) int {
+	if n < 2 {
+		return 0
+	}
+	root := int64(math.Sqrt(float64(n)))
+	for root*root > n {
+		root--
+	}
+	for (root+1)*(root+1) <= n {
+		root++
+	}
+	base := sieve(root)
+
+	count := 0
+	composite := make([]bool, segmentSize)
+	for low := int64(2); low <= n; low += segmentSize {
+		high := min(low+segmentSize-1, n)
+		clear(composite)
+		for _, p := range base {
+			for m := max(p*p, (low+p-1)/p*p); m <= high; m += p {
+				composite[m-low] = true
+			}
+		}
+		for i := low; i <= high; i++ {
+			if !composite[i-low] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// sieve returns the primes up to n by the sieve of Eratosthenes.
+func sieve(n int64) []int64 {
+	composite := make([]bool, n+1)
+	var primes []int64
+	for i := int64(2); i <= n; i++ {
+		if composite[i] {
+			continue
+		}
+		primes = append(primes, i)
+		for m := i * i; m <= n; m += i {
+			composite[m] = true
+		}
+	}
+	return primes
+}
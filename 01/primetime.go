@@ -0,0 +1,418 @@
+package primetime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"protohackers_primetime_requests_total",
+		"Well-formed requests answered.",
+		"method",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"protohackers_primetime_errors_total",
+		"Requests that could not be answered by class: the code of a malformed request, or marshal.",
+		"class",
+	)
+	cacheLookups = metrics.NewCounterVec(
+		"protohackers_primetime_cache_lookups_total",
+		"Lookups in the cache of primality results by result: hit or miss.",
+		"result",
+	)
+	cacheEntries = metrics.NewGaugeVec(
+		"protohackers_primetime_cache_entries",
+		"Primality results in the caches of all servers.",
+	)
+)
+
+// defaultMaxLine is the default length limit of a request line.
+const defaultMaxLine = 1 << 20
+
+// Options are the settings of the service.
+type Options struct {
+	// ErrorMode is how malformed requests are answered: errorModeStrict
+	// or errorModeLenient.
+	ErrorMode string
+
+	// Workers is how many requests are evaluated at once across
+	// connections, or 0 for GOMAXPROCS.
+	Workers int
+
+	// MaxLine is the length limit of a request line in bytes, or 0 for
+	// none.
+	MaxLine int
+
+	// CacheSize is the capacity of the cache of primality results, or 0
+	// for no cache.
+	CacheSize int
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ErrorMode, "prime-errors", o.ErrorMode, "how malformed requests are answered: strict sends a line of text and disconnects, lenient sends a JSON error and reads on (primetime)")
+	fs.IntVar(&o.Workers, "prime-workers", o.Workers, "how many requests are evaluated at once across connections (0 means GOMAXPROCS) (primetime)")
+	fs.IntVar(&o.MaxLine, "prime-max-line", o.MaxLine, "length limit of a request line in bytes; longer ones are malformed (0 means no limit) (primetime)")
+	fs.IntVar(&o.CacheSize, "prime-cache-size", o.CacheSize, "how many primality results of numbers beyond the small-prime sieve are cached (0 means no cache) (primetime)")
+}
+
+// Problem is Prime Time: a line-delimited JSON primality service.
+var Problem = problem.Problem{
+	Number: 1,
+	Name:   "primetime",
+	Title:  "Prime Time",
+	NewOptions: func() problem.Options {
+		return &Options{ErrorMode: errorModeStrict, MaxLine: defaultMaxLine, CacheSize: defaultCacheSize}
+	},
+	NewServer: func(_ context.Context, opts problem.Options) (*server.Server, error) {
+		o := opts.(*Options)
+		if o.ErrorMode != errorModeStrict && o.ErrorMode != errorModeLenient {
+			return nil, fmt.Errorf("unknown error mode %q, want %s or %s", o.ErrorMode, errorModeStrict, errorModeLenient)
+		}
+		if o.Workers < 0 || o.MaxLine < 0 || o.CacheSize < 0 {
+			return nil, errors.New("prime workers, max line and cache size must not be negative")
+		}
+		return &server.Server{
+			Name:         "primetime",
+			Handler:      newPrimeServer(o.ErrorMode == errorModeLenient, o.Workers, o.MaxLine, o.CacheSize),
+			Reject:       reject,
+			IdleTimeout:  time.Minute,
+			WriteTimeout: 10 * time.Second,
+		}, nil
+	},
+	NewHTTPHandler: newHTTPHandler,
+}
+
+// maxPipelined is how many requests of a connection are read ahead of the
+// response being written.
+const maxPipelined = 256
+
+// heavyLine is the length of a request line beyond which its number may
+// take seconds to test, where those of shorter lines take milliseconds.
+const heavyLine = 512
+
+// primeServer answers the requests of a connection. It reads requests
+// ahead and evaluates them concurrently, but answers them in order. It is
+// created by newPrimeServer.
+type primeServer struct {
+	// lenient is whether malformed requests get a JSON error and leave
+	// the connection open, rather than a line of text that closes it.
+	lenient bool
+
+	// workers holds a token for each request being evaluated, bounding
+	// how many are at once across connections.
+	workers chan struct{}
+
+	// heavy holds a token for each request line longer than heavyLine
+	// being evaluated, which takes it instead of a worker token, so that
+	// huge numbers do not starve the other requests.
+	heavy chan struct{}
+
+	// maxLine is the length limit of a request line, or 0 for none.
+	maxLine int
+
+	// cache holds the results of the primality tests of numbers beyond
+	// the sieve, shared by all connections. If nil, none are cached.
+	cache *resultCache
+}
+
+// newPrimeServer returns a server that evaluates up to workers requests
+// at once, or GOMAXPROCS if workers is 0, and a quarter as many long
+// ones on top of those, takes request lines of up to
+// maxLine bytes, or of any length if maxLine is 0, and caches up to
+// cacheSize primality results.
+func newPrimeServer(lenient bool, workers, maxLine, cacheSize int) *primeServer {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &primeServer{
+		lenient: lenient,
+		workers: make(chan struct{}, workers),
+		heavy:   make(chan struct{}, max(1, workers/4)),
+		maxLine: maxLine,
+		cache:   newResultCache(cacheSize),
+	}
+}
+
+// A reply is the response to a request line.
+type reply struct {
+	// line is the response without its newline.
+	line []byte
+
+	// close is whether the connection is closed after the response.
+	close bool
+}
+
+func (s *primeServer) ServeConn(ctx context.Context, conn net.Conn) {
+	logger := logging.FromContext(ctx)
+
+	// The replies to requests are queued in the order the requests
+	// came in, each on a channel of its own that its worker sends it to.
+	pending := make(chan chan reply, maxPipelined)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		s.readRequests(ctx, conn, pending, stop)
+	}()
+	defer func() {
+		// Closing the connection ends a read the reader is blocked in.
+		close(stop)
+		conn.Close()
+		wg.Wait()
+	}()
+
+	// Responses are buffered, and written once no other is ready.
+	w := bufio.NewWriter(conn)
+	flush := func() bool {
+		if err := w.Flush(); err != nil {
+			logger.Error("failed to write to connection", slog.Any("err", err))
+			return false
+		}
+		return true
+	}
+	for {
+		var next chan reply
+		select {
+		case next = <-pending:
+		default:
+			if !flush() {
+				return
+			}
+			next = <-pending
+		}
+		if next == nil {
+			flush()
+			return
+		}
+
+		var a reply
+		select {
+		case a = <-next:
+		default:
+			if !flush() {
+				return
+			}
+			a = <-next
+		}
+
+		logger.Debug("writing to connection", slog.String("data", string(a.line)))
+		w.Write(a.line)
+		w.WriteByte('\n')
+		if a.close {
+			flush()
+			return
+		}
+	}
+}
+
+// readRequests reads request lines from r and queues their replies on
+// pending, in order, until r is done or stop is closed.
+func (s *primeServer) readRequests(ctx context.Context, r io.Reader, pending chan<- chan reply, stop <-chan struct{}) {
+	lr := newLineReader(r, s.maxLine)
+	for {
+		line, err := lr.ReadLine()
+		tooLong := errors.Is(err, errLineTooLong)
+		if err != nil && !tooLong {
+			if err != io.EOF {
+				logging.FromContext(ctx).Debug("stopped reading requests", slog.Any("err", err))
+			}
+			return
+		}
+
+		next := make(chan reply, 1)
+		select {
+		case pending <- next:
+		case <-stop:
+			return
+		}
+
+		if tooLong {
+			reqErr := &requestError{code: codeLineTooLong, err: fmt.Errorf("line is longer than %d bytes", s.maxLine)}
+			countMalformed(ctx, nil, reqErr)
+			next <- s.malformed(ctx, reqErr)
+			continue
+		}
+		tokens := s.pool(len(line))
+		select {
+		case tokens <- struct{}{}:
+		case <-stop:
+			return
+		}
+		go func() {
+			defer func() { <-tokens }()
+			next <- s.reply(ctx, line)
+		}()
+	}
+}
+
+// pool returns the tokens a request of n bytes is evaluated under.
+func (s *primeServer) pool(n int) chan struct{} {
+	if n > heavyLine {
+		return s.heavy
+	}
+	return s.workers
+}
+
+// reply evaluates a request line.
+func (s *primeServer) reply(ctx context.Context, b []byte) reply {
+	js, err := s.respond(ctx, b)
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return s.malformed(ctx, reqErr)
+	case err != nil:
+		return reply{line: []byte("failed to marshal response"), close: true}
+	}
+	return reply{line: js}
+}
+
+// malformed answers a malformed request.
+func (s *primeServer) malformed(ctx context.Context, reqErr *requestError) reply {
+	if !s.lenient {
+		return reply{line: []byte(reqErr.Error()), close: true}
+	}
+	js, err := marshal(ctx, newErrorResponse(reqErr))
+	if err != nil {
+		return reply{line: []byte("failed to marshal response"), close: true}
+	}
+	return reply{line: js}
+}
+
+// respond evaluates the request b and returns the JSON of its response,
+// counting it in the metrics. The error of a malformed request is a
+// *requestError.
+func (s *primeServer) respond(ctx context.Context, b []byte) ([]byte, error) {
+	req, err := parseRequest(b)
+	var res response
+	if err == nil {
+		res, err = req.evaluate(s.cache)
+	}
+	if err != nil {
+		var reqErr *requestError
+		errors.As(err, &reqErr)
+		countMalformed(ctx, b, reqErr)
+		return nil, reqErr
+	}
+	requestsTotal.With(req.Method).Inc()
+	return marshal(ctx, res)
+}
+
+// countMalformed counts and logs the malformed request b.
+func countMalformed(ctx context.Context, b []byte, reqErr *requestError) {
+	errorsTotal.With(reqErr.code).Inc()
+	logging.FromContext(ctx).Info("malformed request", slog.String("request", string(b)), slog.String("code", reqErr.code), slog.Any("err", reqErr))
+}
+
+// marshal returns the JSON of a response, counting and logging a failure.
+func marshal(ctx context.Context, v any) ([]byte, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		errorsTotal.With("marshal").Inc()
+		logging.FromContext(ctx).Error("failed to marshal response", slog.Any("err", err))
+		return nil, err
+	}
+	return js, nil
+}
+
+// reject answers a connection refused by the server limits with a
+// malformed response.
+func reject(ctx context.Context, conn net.Conn, err error) {
+	if _, err := conn.Write([]byte(err.Error() + "\n")); err != nil {
+		logging.FromContext(ctx).Error("failed to write to connection", slog.Any("err", err))
+	}
+}
+
+type request struct {
+	Method string `json:"method"`
+
+	// params are the params of the method, decoded by parseRequest.
+	params any
+}
+
+// parseRequest decodes a request line. Its errors are *requestError.
+func parseRequest(b []byte) (request, error) {
+	var req request
+	if err := json.Unmarshal(b, &req); err != nil {
+		return request{}, &requestError{code: codeInvalidJSON, err: err}
+	}
+	if err := req.Validate(); err != nil {
+		return request{}, &requestError{code: codeBadMethod, err: err}
+	}
+
+	params, err := methods[req.Method].decode(b)
+	if err != nil {
+		return request{}, &requestError{code: codeInvalidJSON, err: err}
+	}
+	if v, ok := params.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return request{}, paramsError(err)
+		}
+	}
+	req.params = params
+
+	return req, nil
+}
+
+func (r request) Validate() error {
+	if _, ok := methods[r.Method]; !ok {
+		return fmt.Errorf("invalid method")
+	}
+
+	return nil
+}
+
+// evaluate calls the method of the request, which caches primality
+// results in c. Its errors are *requestError.
+func (r request) evaluate(c *resultCache) (response, error) {
+	result, err := methods[r.Method].call(c, r.params)
+	if err != nil {
+		return response{}, paramsError(err)
+	}
+	return response{Method: r.Method, Result: result}, nil
+}
+
+// A response carries the result of a method, whose fields follow
+// "method".
+type response struct {
+	Method string
+	Result any
+}
+
+func (r response) MarshalJSON() ([]byte, error) {
+	method, err := json.Marshal(r.Method)
+	if err != nil {
+		return nil, err
+	}
+	result, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 2 || result[0] != '{' {
+		return nil, fmt.Errorf("result of %s is not an object: %s", r.Method, result)
+	}
+
+	b := append([]byte(`{"method":`), method...)
+	if len(result) > 2 {
+		b = append(b, ',')
+	}
+	return append(b, result[1:]...), nil
+}
@@ -0,0 +1,725 @@
+package primetime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/faultnet"
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+func Test_handleConnection(t *testing.T) {
+	serve := func() (int, context.CancelFunc, chan error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+
+		ln, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		port := ln.Addr().(*net.TCPAddr).Port
+
+		go func() {
+			srv := server.Server{Handler: newPrimeServer(false, 0, 0, 0)}
+			if err := srv.Serve(ctx, ln); err != nil {
+				errs <- err
+			}
+			close(errs)
+		}()
+
+		return port, cancel, errs
+	}
+
+	for _, p := range faultnet.Profiles() {
+		t.Run(p.Name, func(t *testing.T) {
+			t.Run("invalid request", func(t *testing.T) {
+				port, stopServer, errs := serve()
+				defer stopServer()
+
+				go func() {
+					err, ok := <-errs
+					if !ok {
+						return
+					}
+					t.Error(err)
+				}()
+
+				conn, err := net.Dial("tcp", fmt.Sprintf(":%d", port))
+				if err != nil {
+					t.Fatalf("failed to dial: %v", err)
+				}
+				conn = faultnet.Wrap(conn, p.Faults)
+				defer conn.Close()
+
+				req := []byte("failed to decode request\n")
+				if err := write(conn, req); err != nil {
+					t.Fatal(err)
+				}
+				if err := read(conn, []byte("failed to decode request\n")); err != nil {
+					t.Fatal(err)
+				}
+
+				if !isClosedConn(conn) {
+					t.Fatal("connection is not closed")
+				}
+
+				if err := conn.Close(); err != nil {
+					t.Fatalf("failed to close connection: %v", err)
+				}
+			})
+
+			t.Run("invalid request", func(t *testing.T) {
+				port, stopServer, errs := serve()
+				defer stopServer()
+
+				go func() {
+					err, ok := <-errs
+					if !ok {
+						return
+					}
+					t.Error(err)
+				}()
+
+				conn, err := net.Dial("tcp", fmt.Sprintf(":%d", port))
+				if err != nil {
+					t.Fatalf("failed to dial: %v", err)
+				}
+				conn = faultnet.Wrap(conn, p.Faults)
+				defer conn.Close()
+
+				req := []byte("{\"method\":\"unknown\"}\n")
+				if err := write(conn, req); err != nil {
+					t.Fatal(err)
+				}
+				if err := read(conn, []byte("invalid request: invalid method\n")); err != nil {
+					t.Fatal(err)
+				}
+
+				if !isClosedConn(conn) {
+					t.Fatal("connection is not closed")
+				}
+
+				if err := conn.Close(); err != nil {
+					t.Fatalf("failed to close connection: %v", err)
+				}
+			})
+
+			t.Run("invalid request", func(t *testing.T) {
+				port, stopServer, errs := serve()
+				defer stopServer()
+
+				go func() {
+					err, ok := <-errs
+					if !ok {
+						return
+					}
+					t.Error(err)
+				}()
+
+				conn, err := net.Dial("tcp", fmt.Sprintf(":%d", port))
+				if err != nil {
+					t.Fatalf("failed to dial: %v", err)
+				}
+				conn = faultnet.Wrap(conn, p.Faults)
+				defer conn.Close()
+
+				req := []byte("{\"method\":\"isPrime\"}\n")
+				if err := write(conn, req); err != nil {
+					t.Fatal(err)
+				}
+				if err := read(conn, []byte("invalid request: number is required\n")); err != nil {
+					t.Fatal(err)
+				}
+
+				if !isClosedConn(conn) {
+					t.Fatal("connection is not closed")
+				}
+
+				if err := conn.Close(); err != nil {
+					t.Fatalf("failed to close connection: %v", err)
+				}
+			})
+
+			t.Run("prime check", func(t *testing.T) {
+				port, stopServer, errs := serve()
+				defer stopServer()
+
+				go func() {
+					err, ok := <-errs
+					if !ok {
+						return
+					}
+					t.Error(err)
+				}()
+
+				conn, err := net.Dial("tcp", fmt.Sprintf(":%d", port))
+				if err != nil {
+					t.Fatalf("failed to dial: %v", err)
+				}
+				conn = faultnet.Wrap(conn, p.Faults)
+				defer conn.Close()
+
+				req := []byte("{\"method\":\"isPrime\",\"number\":7}\n")
+				if err := write(conn, req); err != nil {
+					t.Fatal(err)
+				}
+				if err := read(conn, []byte("{\"method\":\"isPrime\",\"prime\":true}\n")); err != nil {
+					t.Fatal(err)
+				}
+
+				req = []byte("{\"method\":\"isPrime\",\"number\":8}\n")
+				if err := write(conn, req); err != nil {
+					t.Fatal(err)
+				}
+				if err := read(conn, []byte("{\"method\":\"isPrime\",\"prime\":false}\n")); err != nil {
+					t.Fatal(err)
+				}
+			})
+		})
+	}
+}
+
+func Test_primeServer_lenient(t *testing.T) {
+	// Not parallel: it counts the errors metric, which the server tests
+	// add to as well.
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	client, conn := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer conn.Close()
+		newPrimeServer(true, 0, 0, 0).ServeConn(ctx, conn)
+	}()
+
+	tests := []struct {
+		in   string
+		want string
+		code string
+	}{
+		{in: `{"method":"isPrime","number":7`, want: `{"error":{"code":"invalid_json","reason":"unexpected end of JSON input"}}`, code: codeInvalidJSON},
+		{in: `{"method":"isPrime","number":"7"}`, want: `{"error":{"code":"invalid_json","reason":"number is not a number"}}`, code: codeInvalidJSON},
+		{in: `{"method":"isPrim","number":7}`, want: `{"error":{"code":"bad_method","reason":"invalid method"}}`, code: codeBadMethod},
+		{in: `{"method":"isPrime"}`, want: `{"error":{"code":"missing_number","reason":"number is required"}}`, code: codeMissingNumber},
+		{in: `{"method":"isProbablePrime","number":7,"rounds":1000}`, want: `{"error":{"code":"invalid_params","reason":"rounds is not from 0 to 100"}}`, code: codeInvalidParams},
+		{in: `{"method":"nextPrime","number":7.5}`, want: `{"error":{"code":"invalid_params","reason":"number is not an integer"}}`, code: codeInvalidParams},
+		{in: `{"method":"isPrime","number":7}`, want: `{"method":"isPrime","prime":true}`},
+	}
+	before := make(map[string]uint64)
+	for _, tt := range tests {
+		before[tt.code] = errorsTotal.With(tt.code).Value()
+	}
+
+	// The session stays open after each malformed request.
+	r := bufio.NewReader(client)
+	client.SetDeadline(time.Now().Add(time.Second))
+	for _, tt := range tests {
+		if _, err := client.Write([]byte(tt.in + "\n")); err != nil {
+			t.Fatalf("failed to write %s: %v", tt.in, err)
+		}
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read the response to %s: %v", tt.in, err)
+		}
+		if got != tt.want+"\n" {
+			t.Errorf("response to %s = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, code := range []string{codeInvalidJSON, codeBadMethod, codeMissingNumber, codeInvalidParams} {
+		want := uint64(0)
+		for _, tt := range tests {
+			if tt.code == code {
+				want++
+			}
+		}
+		if n := errorsTotal.With(code).Value() - before[code]; n != want {
+			t.Errorf("counted %d %s errors, want %d", n, code, want)
+		}
+	}
+}
+
+func Test_primeServer_pipelined(t *testing.T) {
+	t.Parallel()
+
+	// Big primes take longer than small numbers, so evaluated
+	// concurrently they finish out of order.
+	var lines, want []string
+	for i := 0; i < 200; i++ {
+		n, prime := strconv.Itoa(i), isSmallPrime(i)
+		if i%10 == 0 {
+			n, prime = "170141183460469231731687303715884105727", true
+		}
+		lines = append(lines, `{"method":"isPrime","number":`+n+`}`)
+		want = append(want, fmt.Sprintf(`{"method":"isPrime","prime":%t}`, prime))
+	}
+	// In strict mode, the answers stop at the first malformed request.
+	lines = append(lines, `{"method":"isPrime"}`, `{"method":"isPrime","number":2}`)
+	want = append(want, "invalid request: number is required")
+
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	client, conn := net.Pipe()
+	defer client.Close()
+	go newPrimeServer(false, 4, 0, defaultCacheSize).ServeConn(ctx, conn)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go client.Write([]byte(strings.Join(lines, "\n") + "\n"))
+
+	r := bufio.NewReader(client)
+	for i, w := range want {
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read response %d: %v", i, err)
+		}
+		if got != w+"\n" {
+			t.Fatalf("response %d = %q, want %q", i, got, w)
+		}
+	}
+	if rest, err := io.ReadAll(r); err != nil || len(rest) > 0 {
+		t.Errorf("read %q, %v after the malformed response, want the connection closed", rest, err)
+	}
+}
+
+func Test_primeServer_longLines(t *testing.T) {
+	t.Parallel()
+
+	const mib = 1 << 20
+	spaces := strings.Repeat(" ", 3*mib)
+	zeros := strings.Repeat("0", 3*mib)
+
+	tests := []struct {
+		name    string
+		lenient bool
+		maxLine int
+		lines   []string
+		want    []string
+	}{
+		{
+			name: "padded with whitespace",
+			lines: []string{
+				spaces + `{` + spaces + `"method":"isPrime",` + spaces + `"number":` + spaces + `7` + spaces + `}` + spaces,
+			},
+			want: []string{`{"method":"isPrime","prime":true}`},
+		},
+		{
+			name: "multi-megabyte numbers",
+			lines: []string{
+				`{"method":"isPrime","number":7.` + zeros + `}`,
+				`{"method":"isPrime","number":7` + zeros + `}`,
+				`{"method":"isPrime","number":0.` + zeros + `7}`,
+				`{"method":"isPrime","number":7.` + zeros + `1}`,
+				`{"method":"factorize","number":100000000000` + zeros + `e-` + strconv.Itoa(len(zeros)) + `}`,
+			},
+			want: []string{
+				`{"method":"isPrime","prime":true}`,
+				`{"method":"isPrime","prime":false}`,
+				`{"method":"isPrime","prime":false}`,
+				`{"method":"isPrime","prime":false}`,
+				`{"method":"factorize","factors":[2,2,2,2,2,2,2,2,2,2,2,5,5,5,5,5,5,5,5,5,5,5]}`,
+			},
+		},
+		{
+			name:    "over the limit",
+			maxLine: mib,
+			lines:   []string{`{"method":"isPrime","number":2}`, `{"method":"isPrime","number":7` + zeros + `}`, `{"method":"isPrime","number":2}`},
+			want:    []string{`{"method":"isPrime","prime":true}`, "invalid request: line is longer than 1048576 bytes"},
+		},
+		{
+			name:    "over the limit leniently",
+			lenient: true,
+			maxLine: mib,
+			lines:   []string{`{"method":"isPrime","number":7` + zeros + `}`, `{"method":"isPrime","number":2}`},
+			want:    []string{`{"error":{"code":"line_too_long","reason":"line is longer than 1048576 bytes"}}`, `{"method":"isPrime","prime":true}`},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+			client, conn := net.Pipe()
+			defer client.Close()
+			go newPrimeServer(tt.lenient, 1, tt.maxLine, 0).ServeConn(ctx, conn)
+
+			client.SetDeadline(time.Now().Add(10 * time.Second))
+			go func() {
+				for _, line := range tt.lines {
+					if _, err := client.Write([]byte(line + "\n")); err != nil {
+						return
+					}
+				}
+			}()
+
+			r := bufio.NewReader(client)
+			for i, w := range tt.want {
+				got, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("failed to read response %d: %v", i, err)
+				}
+				if got != w+"\n" {
+					t.Fatalf("response %d = %q, want %q", i, got, w)
+				}
+			}
+		})
+	}
+}
+
+func Test_primeServer_heavy(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := newPrimeServer(false, 1, 0, 0)
+	serve := func() net.Conn {
+		client, conn := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+		go srv.ServeConn(ctx, conn)
+		return client
+	}
+
+	// While the pool of long requests is busy, short ones are still
+	// answered, and long ones wait for it.
+	for i := 0; i < cap(srv.heavy); i++ {
+		srv.heavy <- struct{}{}
+	}
+
+	long := serve()
+	n := "1" + strings.Repeat("0", heavyLine) + "1"
+	if err := write(long, []byte(`{"method":"isPrime","number":`+n+"}\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	short := serve()
+	if err := write(short, []byte(`{"method":"isPrime","number":7}`+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := read(short, []byte(`{"method":"isPrime","prime":true}`+"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	long.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := long.Read(make([]byte, 1)); err == nil {
+		t.Fatal("long request answered while its pool was busy")
+	}
+
+	for i := 0; i < cap(srv.heavy); i++ {
+		<-srv.heavy
+	}
+	if err := read(long, []byte(`{"method":"isPrime","prime":false}`+"\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProblem_errorMode(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		mode    string
+		lenient bool
+		wantErr bool
+	}{
+		{mode: errorModeStrict},
+		{mode: errorModeLenient, lenient: true},
+		{mode: "loose", wantErr: true},
+	} {
+		opts := Problem.Options().(*Options)
+		opts.ErrorMode = tt.mode
+		srv, err := Problem.NewServer(context.Background(), opts)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewServer() with error mode %q succeeded, want an error", tt.mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewServer() with error mode %q error = %v", tt.mode, err)
+		}
+		if got := srv.Handler.(*primeServer).lenient; got != tt.lenient {
+			t.Errorf("NewServer() with error mode %q is lenient = %v, want %v", tt.mode, got, tt.lenient)
+		}
+	}
+}
+
+func Test_isPrime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"-1", false},
+		{"0", false},
+		{"1", false},
+		{"2", true},
+		{"3", true},
+		{"6", false},
+		{"1000039", true},
+		{"10000019", true},
+		{"1000000007", true},
+
+		// Beyond 64 bits.
+		{"18446744073709551629", true},                     // 2^64+13
+		{"18446744073709551631", false},                    // 2^64+15
+		{"170141183460469231731687303715884105727", true},  // 2^127-1
+		{"170141183460469231731687303715884105729", false}, // 2^127+1
+
+		// Negative numbers are never prime.
+		{"-0", false},
+		{"-2", false},
+		{"-7", false},
+		{"-18446744073709551629", false},
+
+		// Exponent notation.
+		{"7e0", true},
+		{"7E+0", true},
+		{"0.7e1", true},
+		{"70e-1", true},
+		{"1.3e1", true},
+		{"1e2", false},
+		{"2e1", false},
+		{"18446744073709551.629e3", true},
+		{"2e1000000000", false},
+		{"2e99999999999999999999", false},
+		{"7e-1", false},
+		{"7e-99999999999999999999", false},
+		{"0e99999999999999999999", false},
+
+		// Fractions are not integers, so not prime.
+		{"7.0", true},
+		{"7.000", true},
+		{"7.5", false},
+		{"7.000000000000000000001", false},
+		{"2.9999999999999999999999", false},
+		{"0.5", false},
+		{"-7.5", false},
+	}
+	for _, tt := range tests {
+		if got := isPrime(nil, number{value: json.Number(tt.number)}); got != tt.want {
+			t.Errorf("isPrime(%s) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+
+	isPrimeInt := func(n int64) bool {
+		return isPrime(nil, number{value: json.Number(strconv.FormatInt(n, 10))})
+	}
+
+	// Check against each continguous sequence of primes that the primes
+	// are classified as primes and the numbers in between as not.
+	contiguousPrimes := [][]int64{
+		{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47},
+		{127, 131, 137, 139, 149, 151, 157, 163, 167, 173, 179, 181},
+		{877, 881, 883, 887, 907, 911, 919, 929, 937, 941, 947, 953},
+		{2089, 2099, 2111, 2113, 2129, 2131, 2137, 2141, 2143, 2153},
+		{9857, 9859, 9871, 9883, 9887, 9901, 9907, 9923, 9929, 9931},
+		{1000003, 1000033, 1000037},
+	}
+	for _, ps := range contiguousPrimes {
+		for _, p := range ps {
+			if !isPrimeInt(p) {
+				t.Errorf("isPrime(%d) == false, want true", p)
+			}
+		}
+		for i := 1; i < len(ps); i++ {
+			for n := ps[i-1] + 1; n < ps[i]; n++ {
+				if isPrimeInt(n) {
+					t.Errorf("isPrime(%d) == true, want false", n)
+				}
+			}
+		}
+	}
+
+	// Check that the numbers obtain by multiplying any two of the following
+	// prime factors are classified as not primes
+	factors := []int64{2, 3, 41, 157, 953, 2141, 9929}
+	for i, f := range factors {
+		for j := 0; j <= i; j++ {
+			n := f * factors[j]
+			if isPrimeInt(n) {
+				t.Errorf("isPrime(%d) == true, want false", n)
+			}
+		}
+	}
+}
+
+// parseRequestTests are the cases of Test_parseRequest, and seeds of
+// FuzzParseRequest.
+var parseRequestTests = []struct {
+	name    string
+	in      string
+	want    string
+	wantErr string
+}{
+	{name: "integer", in: `{"method":"isPrime","number":7}`, want: "7"},
+	{name: "big integer", in: `{"method":"isPrime","number":18446744073709551629}`, want: "18446744073709551629"},
+	{name: "exponent", in: `{"method":"isPrime","number":-1.5E+300}`, want: "-1.5E+300"},
+	{name: "number as string", in: `{"method":"isPrime","number":"7"}`, wantErr: "failed to decode request"},
+	{name: "number as bool", in: `{"method":"isPrime","number":true}`, wantErr: "failed to decode request"},
+	{name: "number as array", in: `{"method":"isPrime","number":[7]}`, wantErr: "failed to decode request"},
+	{name: "null number", in: `{"method":"isPrime","number":null}`, wantErr: "invalid request: number is required"},
+	{name: "missing number", in: `{"method":"isPrime"}`, wantErr: "invalid request: number is required"},
+}
+
+func Test_parseRequest(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range parseRequestTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := parseRequest([]byte(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseRequest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRequest() error = %v", err)
+			}
+			if got := req.params.(numberParams).Number.String(); got != tt.want {
+				t.Errorf("parseRequest() number = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParseRequest(f *testing.F) {
+	for _, tt := range parseRequestTests {
+		f.Add([]byte(tt.in))
+	}
+	for _, tt := range methodTests {
+		f.Add([]byte(tt.in))
+	}
+
+	codes := []string{codeInvalidJSON, codeBadMethod, codeMissingNumber, codeInvalidParams}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		req, err := parseRequest(b)
+		if err != nil {
+			var reqErr *requestError
+			if !errors.As(err, &reqErr) || !slices.Contains(codes, reqErr.code) {
+				t.Fatalf("parseRequest(%q) error = %#v, want a *requestError with one of the codes %q", b, err, codes)
+			}
+			return
+		}
+
+		// A request is its method followed by the fields of its params,
+		// as a response is its method followed by those of its result.
+		js, err := json.Marshal(response{Method: req.Method, Result: req.params})
+		if err != nil {
+			t.Fatalf("failed to marshal request %q: %v", b, err)
+		}
+		got, err := parseRequest(js)
+		if err != nil {
+			t.Fatalf("parseRequest(%s) of request %q error = %v", js, b, err)
+		}
+		if !reflect.DeepEqual(got, req) {
+			t.Fatalf("parseRequest(%s) = %#v, want %#v as parsed from %q", js, got, req, b)
+		}
+	})
+}
+
+func write(conn net.Conn, payload []byte) error {
+	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		return fmt.Errorf("failed to set deadline: %v", err)
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	n, err := conn.Write(payload)
+	if err != nil {
+		return fmt.Errorf("failed to write: %v", err)
+	}
+	if n != len(payload) {
+		return fmt.Errorf("wrote %d bytes, want %d", n, len(payload))
+	}
+	return nil
+}
+
+func read(conn net.Conn, want []byte) error {
+	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		return fmt.Errorf("failed to set deadline: %v", err)
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	b, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read: %v", err)
+	}
+
+	if !bytes.Equal(b, want) {
+		return fmt.Errorf("got %q, want %q", b, want)
+	}
+	return nil
+}
+
+func isClosedConn(conn net.Conn) bool {
+	defer conn.SetReadDeadline(time.Time{})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	return errors.Is(err, io.EOF)
+}
+
+func isSmallPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func BenchmarkPrimeServer_pipelined(b *testing.B) {
+	// 1000 distinct primes of 256 bits, each a full Miller-Rabin test.
+	var req bytes.Buffer
+	p := new(big.Int).Lsh(big.NewInt(1), 255)
+	for i := 0; i < 1000; i++ {
+		p = nextPrime(p)
+		fmt.Fprintf(&req, `{"method":"isPrime","number":%s}`+"\n", p)
+	}
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// A single worker without a cache evaluates the requests one at a
+	// time, as the server did before it read ahead.
+	servers := []struct {
+		name string
+		srv  *primeServer
+	}{
+		{name: "sequential", srv: newPrimeServer(false, 1, 0, 0)},
+		{name: fmt.Sprintf("workers=%d", runtime.GOMAXPROCS(0)), srv: newPrimeServer(false, 0, 0, defaultCacheSize)},
+	}
+	for _, s := range servers {
+		srv := s.srv
+		b.Run(s.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				client, conn := net.Pipe()
+				go srv.ServeConn(ctx, conn)
+				go client.Write(req.Bytes())
+
+				r := bufio.NewReader(client)
+				for j := 0; j < 1000; j++ {
+					if _, err := r.ReadSlice('\n'); err != nil {
+						b.Fatalf("failed to read response %d: %v", j, err)
+					}
+				}
+				client.Close()
+			}
+		})
+	}
+}
@@ -1,17 +1,31 @@
-package main
+package means
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
-	"os/signal"
-	"syscall"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/server"
 )
 
-const defaultPort = "8080"
+var (
+	messagesTotal = metrics.NewCounterVec(
+		"protohackers_means_messages_total",
+		"Messages handled by type.",
+		"type",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"protohackers_means_errors_total",
+		"Errors while handling messages.",
+		"kind",
+	)
+)
 
 const (
 	MessageLen        = 9
@@ -19,84 +33,39 @@ const (
 	MessagePayloadLen = MessageLen - MessageHeaderLen
 )
 
-func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
-
-	port := flag.String("port", defaultPort, "port to listen on")
-	flag.Parse()
-
-	netListener := func() (net.Listener, error) {
-		return net.Listen("tcp", ":"+*port)
-	}
-	if err := listen(ctx, netListener); err != nil {
-		log.Fatalf("failed to listen: %v\n", err)
-	}
-}
-
-func listen(ctx context.Context, listener func() (net.Listener, error)) error {
-	ln, err := listener()
-	if err != nil {
-		return fmt.Errorf("failed to listen: %v", err)
-	}
-
-	port := ln.Addr().(*net.TCPAddr).Port
-
-	go func() {
-		<-ctx.Done()
-		if err := ln.Close(); err != nil {
-			log.Printf("failed to close listener: %v\n", err)
-		}
-	}()
-
-	log.Printf("listening on port %d\n", port)
-
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			if ctx.Err() != nil {
-				return err
-			}
-
-			log.Printf("failed to accept: %v\n", err)
-			break
-		}
-
-		go handleConnection(conn)
-	}
-
-	if err := ln.Close(); err != nil {
-		return fmt.Errorf("failed to close listener: %v", err)
-	}
-
-	return nil
-}
-
-func handleConnection(conn net.Conn) {
-	defer func() {
-		log.Printf("closing connection from %s\n", conn.RemoteAddr().String())
-		if err := conn.Close(); err != nil {
-			log.Printf("failed to close connection: %v\n", err)
-		}
-	}()
-
-	client := NewClient(conn.RemoteAddr().String())
-	log.Printf("new connection from %s\n", client.ipAddr)
+// Problem is Means to an End: per-session price averages.
+var Problem = problem.Problem{
+	Number: 2,
+	Name:   "means",
+	Title:  "Means to an End",
+	NewServer: func(context.Context, problem.Options) (*server.Server, error) {
+		return &server.Server{
+			Name:         "means",
+			Handler:      server.HandlerFunc(handleConnection),
+			IdleTimeout:  time.Minute,
+			WriteTimeout: 10 * time.Second,
+		}, nil
+	},
+}
+
+func handleConnection(ctx context.Context, conn net.Conn) {
+	logger := logging.FromContext(ctx)
+	client := NewClient(logger)
 
 	for {
 		b := make([]byte, MessageLen)
 		_, err := io.ReadAtLeast(conn, b, MessageLen)
 		if err != nil {
 			if err == io.EOF {
-				log.Printf("client %s disconnected\n", client.ipAddr)
+				logger.Debug("client disconnected")
 				return
 			}
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				log.Printf("client %s timed out\n", client.ipAddr)
+				logger.Info("client timed out")
 				return
 			}
 
-			log.Printf("failed to read from connection: %v\n", err)
+			logger.Error("failed to read from connection", slog.Any("err", err))
 			return
 		}
 
@@ -105,53 +74,46 @@ func handleConnection(conn net.Conn) {
 }
 
 type Client struct {
-	ipAddr string
-	assets map[int32]int32
+	logger *slog.Logger
+	assets priceTree
 }
 
-func NewClient(ipAddr string) *Client {
+func NewClient(logger *slog.Logger) *Client {
 	return &Client{
-		ipAddr: ipAddr,
-		assets: make(map[int32]int32, 50),
+		logger: logger,
 	}
 }
 
 func (c *Client) Handle(b []byte, w io.Writer) {
 	m, err := ParseMessage(b)
 	if err != nil {
-		log.Printf("failed to parse message: %v\n", err)
+		errorsTotal.With("parse").Inc()
+		c.logger.Error("failed to parse message", slog.Any("err", err))
 		return
 	}
 
 	switch t := m.Type(); t {
 	case MessageTypeInsert:
+		messagesTotal.With("insert").Inc()
 		im := m.(*InsertMessage)
 		c.handleInsert(im)
 	case MessageTypeQuery:
+		messagesTotal.With("query").Inc()
 		qm := m.(*QueryMessage)
 		c.handleQuery(qm, w)
 	}
 }
 
 func (c *Client) handleInsert(m *InsertMessage) {
-	log.Printf("insert message: %v\n", m)
+	c.logger.Debug("insert message", slog.Int("timestamp", int(m.Timestamp)), slog.Int("price", int(m.Price)))
 
-	c.assets[m.Timestamp] = m.Price
+	c.assets.insert(m.Timestamp, m.Price)
 }
 
 func (c *Client) handleQuery(m *QueryMessage, w io.Writer) {
-	log.Printf("query message: %v\n", m)
+	c.logger.Debug("query message", slog.Int("min_time", int(m.MinTime)), slog.Int("max_time", int(m.MaxTime)))
 
-	var (
-		sum   int64
-		count int64
-	)
-	for timestamp, price := range c.assets {
-		if timestamp >= m.MinTime && timestamp <= m.MaxTime {
-			sum += int64(price)
-			count++
-		}
-	}
+	sum, count := c.assets.sum(m.MinTime, m.MaxTime)
 
 	var avg int32
 	if count > 0 {
@@ -160,11 +122,12 @@ func (c *Client) handleQuery(m *QueryMessage, w io.Writer) {
 
 	b := marshalQueryMessageResponse(avg)
 	if _, err := w.Write(b); err != nil {
-		log.Printf("failed to write to connection: %v\n", err)
+		errorsTotal.With("write").Inc()
+		c.logger.Error("failed to write to connection", slog.Any("err", err))
 		return
 	}
 
-	log.Printf("avg price: %d\n", avg)
+	c.logger.Debug("avg price", slog.Int("avg", int(avg)))
 }
 
 func marshalQueryMessageResponse(avgPrice int32) []byte {
@@ -190,6 +153,10 @@ type Message interface {
 }
 
 func ParseMessage(b []byte) (Message, error) {
+	if len(b) < MessageHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
 	var m Message
 	switch t := MessageType(b[0]); t {
 	case MessageTypeInsert:
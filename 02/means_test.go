@@ -1,19 +1,25 @@
-package main
+package means
 
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/sklyar/protohackers/internal/faultnet"
+	"github.com/sklyar/protohackers/internal/server"
 )
 
-func Test_listen(t *testing.T) {
+func Test_handleConnection(t *testing.T) {
 	t.Parallel()
 
-	listen := func() (int, context.CancelFunc, chan error) {
+	serve := func() (int, context.CancelFunc, chan error) {
 		ctx, cancel := context.WithCancel(context.Background())
 		errs := make(chan error, 1)
 
@@ -24,10 +30,8 @@ func Test_listen(t *testing.T) {
 		port := ln.Addr().(*net.TCPAddr).Port
 
 		go func() {
-			listener := func() (net.Listener, error) {
-				return ln, nil
-			}
-			if err := listen(ctx, listener); err != nil && ctx.Err() == nil {
+			srv := server.Server{Handler: server.HandlerFunc(handleConnection)}
+			if err := srv.Serve(ctx, ln); err != nil {
 				errs <- err
 			}
 			close(errs)
@@ -36,92 +40,120 @@ func Test_listen(t *testing.T) {
 		return port, cancel, errs
 	}
 
-	t.Run("session with multiple messages", func(t *testing.T) {
-		t.Parallel()
+	for _, p := range faultnet.Profiles() {
+		p := p
+		t.Run(p.Name+"/session with multiple messages", func(t *testing.T) {
+			t.Parallel()
 
-		port, stopServer, errs := listen()
-		defer stopServer()
+			port, stopServer, errs := serve()
+			defer stopServer()
 
-		go func() {
-			err, ok := <-errs
-			if !ok {
-				return
+			go func() {
+				err, ok := <-errs
+				if !ok {
+					return
+				}
+				t.Error(err)
+			}()
+
+			conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
 			}
-			t.Fatal(err)
-		}()
+			conn = faultnet.Wrap(conn, p.Faults)
+			defer conn.Close()
 
-		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
-		if err != nil {
-			t.Fatalf("failed to dial: %v", err)
-		}
-		defer conn.Close()
+			req := []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65} // I 12345 101
+			if err := write(conn, req); err != nil {
+				t.Fatal(err)
+			}
 
-		req := []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65} // I 12345 101
-		if err := write(conn, req); err != nil {
-			t.Fatal(err)
-		}
+			req = []byte{0x49, 0x00, 0x00, 0xa0, 0x00, 0x00, 0x00, 0x00, 0x05} // I 40960 5
+			if err := write(conn, req); err != nil {
+				t.Fatal(err)
+			}
 
-		req = []byte{0x49, 0x00, 0x00, 0xa0, 0x00, 0x00, 0x00, 0x00, 0x05} // I 40960 5
-		if err := write(conn, req); err != nil {
-			t.Fatal(err)
-		}
+			req = []byte{0x49, 0x00, 0x00, 0x30, 0x3a, 0x00, 0x00, 0x00, 0x66} // I 12346 102
+			if err := write(conn, req); err != nil {
+				t.Fatal(err)
+			}
 
-		req = []byte{0x49, 0x00, 0x00, 0x30, 0x3a, 0x00, 0x00, 0x00, 0x66} // I 12346 102
-		if err := write(conn, req); err != nil {
-			t.Fatal(err)
-		}
+			req = []byte{0x49, 0x00, 0x00, 0x30, 0x3b, 0x00, 0x00, 0x00, 0x64} // I 12347 100
+			if err := write(conn, req); err != nil {
+				t.Fatal(err)
+			}
 
-		req = []byte{0x49, 0x00, 0x00, 0x30, 0x3b, 0x00, 0x00, 0x00, 0x64} // I 12347 100
-		if err := write(conn, req); err != nil {
-			t.Fatal(err)
-		}
+			req = []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00} // Q 12288 16384
+			if err := write(conn, req); err != nil {
+				t.Fatal(err)
+			}
+			want := []byte{0x00, 0x00, 0x00, 0x65} // 101
+			if err := read(conn, want); err != nil {
+				t.Fatal(err)
+			}
 
-		req = []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00} // Q 12288 16384
-		if err := write(conn, req); err != nil {
-			t.Fatal(err)
-		}
-		want := []byte{0x00, 0x00, 0x00, 0x65} // 101
-		if err := read(conn, want); err != nil {
-			t.Fatal(err)
-		}
+			req = []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00} // Q 12288 16384
+			if err := write(conn, req); err != nil {
+				t.Fatal(err)
+			}
+			want = []byte{0x00, 0x00, 0x00, 0x65} // 101
+			if err := read(conn, want); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
 
-		req = []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00} // Q 12288 16384
-		if err := write(conn, req); err != nil {
-			t.Fatal(err)
-		}
-		want = []byte{0x00, 0x00, 0x00, 0x65} // 101
-		if err := read(conn, want); err != nil {
-			t.Fatal(err)
-		}
-	})
+// parseMessageTests are the cases of TestParseMessage, and the seeds of
+// FuzzParseMessage.
+var parseMessageTests = []struct {
+	name  string
+	input []byte
+	want  Message
+
+	wantErr bool
+}{
+	{
+		name:    "unknown message type",
+		input:   []byte{0x45, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}, // E 12345 101
+		wantErr: true,
+	},
+	{
+		name:  "insert message",
+		input: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}, // I 12345 101
+		want:  &InsertMessage{Timestamp: 12345, Price: 101},
+	},
+	{
+		name:  "insert message with negative price",
+		input: []byte{0x49, 0x00, 0x00, 0xa0, 0x00, 0xff, 0xff, 0xff, 0xfb}, // I 40960 -5
+		want:  &InsertMessage{Timestamp: 40960, Price: -5},
+	},
+	{
+		name:  "query message",
+		input: []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00}, // Q 12288 16384
+		want:  &QueryMessage{MinTime: 12288, MaxTime: 16384},
+	},
+	{
+		name:    "short message",
+		input:   []byte{0x49, 0x00, 0x00, 0x30, 0x39}, // I 12345
+		wantErr: true,
+	},
+	{
+		name:    "long message",
+		input:   []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00}, // Q 12288 16384 0
+		wantErr: true,
+	},
+	{
+		name:    "empty message",
+		input:   []byte{},
+		wantErr: true,
+	},
 }
 
 func TestParseMessage(t *testing.T) {
 	t.Parallel()
 
-	tests := []struct {
-		name  string
-		input []byte
-		want  Message
-
-		wantErr bool
-	}{
-		{
-			name:    "unknown message type",
-			input:   []byte{0x45, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}, // E 12345 101
-			wantErr: true,
-		},
-		{
-			name:  "insert message",
-			input: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}, // I 12345 101
-			want:  &InsertMessage{Timestamp: 12345, Price: 101},
-		},
-		{
-			name:  "insert message with negative price",
-			input: []byte{0x49, 0x00, 0x00, 0xa0, 0x00, 0xff, 0xff, 0xff, 0xfb}, // I 40960 -5
-			want:  &InsertMessage{Timestamp: 40960, Price: -5}},
-	}
-	for _, tt := range tests {
+	for _, tt := range parseMessageTests {
 		tt := tt
 
 		t.Run(tt.name, func(t *testing.T) {
@@ -139,6 +171,43 @@ func TestParseMessage(t *testing.T) {
 	}
 }
 
+func FuzzParseMessage(f *testing.F) {
+	for _, tt := range parseMessageTests {
+		f.Add(tt.input)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m, err := ParseMessage(b)
+		valid := len(b) == MessageLen && (b[0] == byte(MessageTypeInsert) || b[0] == byte(MessageTypeQuery))
+		if err != nil {
+			if valid {
+				t.Fatalf("ParseMessage(%x) error = %v", b, err)
+			}
+			return
+		}
+		if !valid {
+			t.Fatalf("ParseMessage(%x) = %v, want an error", b, m)
+		}
+		if got := marshalMessage(m); !bytes.Equal(got, b) {
+			t.Fatalf("ParseMessage(%x) = %v, which marshals to %x", b, m, got)
+		}
+	})
+}
+
+// marshalMessage is the inverse of ParseMessage.
+func marshalMessage(m Message) []byte {
+	var a, b int32
+	switch m := m.(type) {
+	case *InsertMessage:
+		a, b = m.Timestamp, m.Price
+	case *QueryMessage:
+		a, b = m.MinTime, m.MaxTime
+	}
+	msg := []byte{byte(m.Type())}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(a))
+	return binary.BigEndian.AppendUint32(msg, uint32(b))
+}
+
 func TestMarshalQueryMessageResponse(t *testing.T) {
 	t.Parallel()
 
@@ -191,7 +260,7 @@ func TestClientHandle(t *testing.T) {
 	}{
 		{
 			name:   "query with no assets",
-			client: NewClient("127.0.0.1:1001"),
+			client: NewClient(discardLogger),
 			session: []any{
 				queryMessage{
 					request:  []byte{0x51, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00, 0x40, 0x00}, // Q 12288 16384
@@ -201,7 +270,7 @@ func TestClientHandle(t *testing.T) {
 		},
 		{
 			name:   "query with one asset",
-			client: NewClient("127.0.0.1:1001"),
+			client: NewClient(discardLogger),
 			session: []any{
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}}, // I 12345 101
 				queryMessage{
@@ -212,7 +281,7 @@ func TestClientHandle(t *testing.T) {
 		},
 		{
 			name:   "correct positive average price",
-			client: NewClient("127.0.0.1:1000"),
+			client: NewClient(discardLogger),
 			session: []any{
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}}, // I 12345 101
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x3a, 0x00, 0x00, 0x00, 0x66}}, // I 12346 102
@@ -226,7 +295,7 @@ func TestClientHandle(t *testing.T) {
 		},
 		{
 			name:   "correct negative average price",
-			client: NewClient("127.0.0.1:1000"),
+			client: NewClient(discardLogger),
 			session: []any{
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0xff, 0xff, 0xff, 0xff}}, // I 12345 -1
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x3a, 0xff, 0xff, 0xff, 0xfe}}, // I 12346 -2
@@ -241,7 +310,7 @@ func TestClientHandle(t *testing.T) {
 		},
 		{
 			name:   "correct average price with zero",
-			client: NewClient("127.0.0.1:1000"),
+			client: NewClient(discardLogger),
 			session: []any{
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x00}}, // I 12345 0
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x3a, 0x00, 0x00, 0x00, 0x00}}, // I 12346 0
@@ -253,7 +322,7 @@ func TestClientHandle(t *testing.T) {
 		},
 		{
 			name:   "correct average price for range",
-			client: NewClient("127.0.0.1:1000"),
+			client: NewClient(discardLogger),
 			session: []any{
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x39, 0x00, 0x00, 0x00, 0x65}}, // I 12345 101
 				insertMessage{request: []byte{0x49, 0x00, 0x00, 0x30, 0x3a, 0x00, 0x00, 0x00, 0x66}}, // I 12346 102
@@ -295,6 +364,8 @@ func TestClientHandle(t *testing.T) {
 	}
 }
 
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
 func write(conn net.Conn, payload []byte) error {
 	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
 		return fmt.Errorf("failed to set deadline: %v", err)
@@ -0,0 +1,199 @@
+package means
+
+import "sort"
+
+// degree is the minimum degree of the nodes of a priceTree: nodes other
+// than the root hold from degree-1 to 2*degree-1 prices.
+const degree = 32
+
+// A priceTree holds the prices of a session by timestamp. It is a B-tree
+// whose nodes know the sum and the count of the prices below them, so that
+// both inserting and summing a range take logarithmic time.
+type priceTree struct {
+	root *priceNode
+}
+
+type priceNode struct {
+	timestamps []int32
+	prices     []int32
+
+	// children is nil for leaves, and has one more entry than
+	// timestamps otherwise.
+	children []*priceNode
+
+	// sum and count are of the prices in the subtree. The sum wraps
+	// around on overflow.
+	sum   int64
+	count int64
+}
+
+func newPriceNode(leaf bool) *priceNode {
+	n := &priceNode{
+		timestamps: make([]int32, 0, 2*degree-1),
+		prices:     make([]int32, 0, 2*degree-1),
+	}
+	if !leaf {
+		n.children = make([]*priceNode, 0, 2*degree)
+	}
+	return n
+}
+
+func (n *priceNode) leaf() bool {
+	return n.children == nil
+}
+
+func (n *priceNode) full() bool {
+	return len(n.timestamps) == 2*degree-1
+}
+
+// insert sets the price at timestamp, replacing the one there was.
+func (t *priceTree) insert(timestamp, price int32) {
+	if t.root == nil {
+		t.root = newPriceNode(true)
+	}
+	if t.root.replace(timestamp, price) {
+		return
+	}
+
+	if t.root.full() {
+		root := newPriceNode(false)
+		root.children = append(root.children, t.root)
+		root.sum, root.count = t.root.sum, t.root.count
+		root.split(0)
+		t.root = root
+	}
+	t.root.insert(timestamp, price)
+}
+
+// replace sets the price at timestamp if the subtree has one, and reports
+// whether it did.
+func (n *priceNode) replace(timestamp, price int32) bool {
+	i := n.search(timestamp)
+	if i < len(n.timestamps) && n.timestamps[i] == timestamp {
+		n.sum += int64(price) - int64(n.prices[i])
+		n.prices[i] = price
+		return true
+	}
+	if n.leaf() {
+		return false
+	}
+
+	old := n.children[i].sum
+	if !n.children[i].replace(timestamp, price) {
+		return false
+	}
+	n.sum += n.children[i].sum - old
+	return true
+}
+
+// insert adds a price at a timestamp the subtree does not have. n must not
+// be full.
+func (n *priceNode) insert(timestamp, price int32) {
+	n.sum += int64(price)
+	n.count++
+
+	i := n.search(timestamp)
+	if n.leaf() {
+		n.timestamps = insertAt(n.timestamps, i, timestamp)
+		n.prices = insertAt(n.prices, i, price)
+		return
+	}
+
+	if n.children[i].full() {
+		n.split(i)
+		if timestamp > n.timestamps[i] {
+			i++
+		}
+	}
+	n.children[i].insert(timestamp, price)
+}
+
+// split moves the upper half of the full child i of n to a new child i+1,
+// and its median up into n.
+func (n *priceNode) split(i int) {
+	left := n.children[i]
+	right := newPriceNode(left.leaf())
+
+	right.timestamps = append(right.timestamps, left.timestamps[degree:]...)
+	right.prices = append(right.prices, left.prices[degree:]...)
+	for _, p := range right.prices {
+		right.sum += int64(p)
+	}
+	right.count = int64(len(right.prices))
+	if !left.leaf() {
+		right.children = append(right.children, left.children[degree:]...)
+		for _, c := range right.children {
+			right.sum += c.sum
+			right.count += c.count
+		}
+		clear(left.children[degree:])
+		left.children = left.children[:degree]
+	}
+
+	timestamp, price := left.timestamps[degree-1], left.prices[degree-1]
+	left.timestamps = left.timestamps[:degree-1]
+	left.prices = left.prices[:degree-1]
+	left.sum -= right.sum + int64(price)
+	left.count -= right.count + 1
+
+	n.timestamps = insertAt(n.timestamps, i, timestamp)
+	n.prices = insertAt(n.prices, i, price)
+	n.children = insertAt(n.children, i+1, right)
+}
+
+// search returns the index of the first timestamp of n not before
+// timestamp.
+func (n *priceNode) search(timestamp int32) int {
+	return sort.Search(len(n.timestamps), func(i int) bool { return n.timestamps[i] >= timestamp })
+}
+
+// sum returns the sum and the count of the prices from minTime to maxTime
+// inclusive. There are none if minTime is after maxTime.
+func (t *priceTree) sum(minTime, maxTime int32) (sum, count int64) {
+	if minTime > maxTime {
+		return 0, 0
+	}
+	sumTo, countTo := t.before(maxTime, true)
+	sumFrom, countFrom := t.before(minTime, false)
+	return sumTo - sumFrom, countTo - countFrom
+}
+
+// before returns the sum and the count of the prices before timestamp, or
+// up to it if inclusive.
+func (t *priceTree) before(timestamp int32, inclusive bool) (sum, count int64) {
+	for n := t.root; n != nil; {
+		i := n.search(timestamp)
+		if inclusive && i < len(n.timestamps) && n.timestamps[i] == timestamp {
+			i++
+		}
+		for _, p := range n.prices[:i] {
+			sum += int64(p)
+		}
+		count += int64(i)
+		if n.leaf() {
+			break
+		}
+		for _, c := range n.children[:i] {
+			sum += c.sum
+			count += c.count
+		}
+		n = n.children[i]
+	}
+	return sum, count
+}
+
+// len returns the number of prices in the tree.
+func (t *priceTree) len() int64 {
+	if t.root == nil {
+		return 0
+	}
+	return t.root.count
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
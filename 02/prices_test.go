@@ -0,0 +1,179 @@
+package means
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func Test_priceTree(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		inserts    int
+		timestamps func(r *rand.Rand) int32
+		prices     func(r *rand.Rand) int32
+	}{
+		{
+			name:       "ascending",
+			inserts:    10000,
+			timestamps: counter(0),
+			prices:     func(r *rand.Rand) int32 { return r.Int31n(1000) - 500 },
+		},
+		{
+			name:       "descending",
+			inserts:    10000,
+			timestamps: counter(-1),
+			prices:     func(r *rand.Rand) int32 { return r.Int31n(1000) - 500 },
+		},
+		{
+			name:       "random with replacements",
+			inserts:    20000,
+			timestamps: func(r *rand.Rand) int32 { return r.Int31n(5000) - 2500 },
+			prices:     func(r *rand.Rand) int32 { return r.Int31() - r.Int31() },
+		},
+		{
+			name:       "extremes",
+			inserts:    5000,
+			timestamps: func(r *rand.Rand) int32 { return int32(r.Uint32()) },
+			prices: func(r *rand.Rand) int32 {
+				if r.Intn(2) == 0 {
+					return math.MaxInt32
+				}
+				return math.MinInt32
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := rand.New(rand.NewSource(1))
+			var tree priceTree
+			model := priceMap{}
+			var timestamps []int32
+			for i := 0; i < tt.inserts; i++ {
+				timestamp, price := tt.timestamps(r), tt.prices(r)
+				tree.insert(timestamp, price)
+				model[timestamp] = price
+				timestamps = append(timestamps, timestamp)
+
+				if i%97 != 0 {
+					continue
+				}
+				// Query around inserted timestamps, so that the bounds
+				// hit some of them.
+				minTime, maxTime := timestamps[r.Intn(len(timestamps))], timestamps[r.Intn(len(timestamps))]
+				checkSum(t, &tree, model, minTime+int32(r.Intn(3)-1), maxTime)
+			}
+
+			if got, want := tree.len(), int64(len(model)); got != want {
+				t.Errorf("len() = %d, want %d", got, want)
+			}
+			checkSum(t, &tree, model, math.MinInt32, math.MaxInt32)
+			checkSum(t, &tree, model, math.MaxInt32, math.MinInt32)
+			checkSum(t, &tree, model, math.MaxInt32, math.MaxInt32)
+			checkSum(t, &tree, model, math.MinInt32, math.MinInt32)
+			for i := 0; i < 1000; i++ {
+				checkSum(t, &tree, model, int32(r.Uint32()), int32(r.Uint32()))
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+
+		var tree priceTree
+		checkSum(t, &tree, priceMap{}, math.MinInt32, math.MaxInt32)
+	})
+}
+
+func checkSum(t *testing.T, tree *priceTree, model priceMap, minTime, maxTime int32) {
+	t.Helper()
+
+	sum, count := tree.sum(minTime, maxTime)
+	wantSum, wantCount := model.sum(minTime, maxTime)
+	if sum != wantSum || count != wantCount {
+		t.Fatalf("sum(%d, %d) = %d, %d, want %d, %d", minTime, maxTime, sum, count, wantSum, wantCount)
+	}
+}
+
+// counter returns successive timestamps, from 0 in steps of step.
+func counter(step int32) func(*rand.Rand) int32 {
+	var next int32
+	return func(*rand.Rand) int32 {
+		next += step
+		return next
+	}
+}
+
+// priceMap holds prices the way the sessions first did, and serves as a
+// model of priceTree.
+type priceMap map[int32]int32
+
+func (m priceMap) sum(minTime, maxTime int32) (sum, count int64) {
+	for timestamp, price := range m {
+		if timestamp >= minTime && timestamp <= maxTime {
+			sum += int64(price)
+			count++
+		}
+	}
+	return sum, count
+}
+
+const benchmarkInserts = 1_000_000
+
+func BenchmarkPriceTree_insert(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	timestamps := make([]int32, benchmarkInserts)
+	for i := range timestamps {
+		timestamps[i] = int32(r.Uint32())
+	}
+
+	for _, order := range []string{"ascending", "random"} {
+		b.Run(order, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var tree priceTree
+				for j, timestamp := range timestamps {
+					if order == "ascending" {
+						timestamp = int32(j)
+					}
+					tree.insert(timestamp, int32(j))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkClient_query queries random ranges of a session of a million
+// prices, as stored by the tree and as they were by a map.
+func BenchmarkClient_query(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	client := NewClient(discardLogger)
+	model := priceMap{}
+	for i := 0; i < benchmarkInserts; i++ {
+		timestamp, price := int32(r.Uint32()), r.Int31n(10000)
+		client.handleInsert(&InsertMessage{Timestamp: timestamp, Price: price})
+		model[timestamp] = price
+	}
+	queries := make([]*QueryMessage, 1024)
+	for i := range queries {
+		queries[i] = &QueryMessage{MinTime: int32(r.Uint32()), MaxTime: int32(r.Uint32())}
+	}
+
+	b.Run(fmt.Sprintf("tree/%d", benchmarkInserts), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			client.handleQuery(queries[i%len(queries)], io.Discard)
+		}
+	})
+	b.Run(fmt.Sprintf("map/%d", benchmarkInserts), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			q := queries[i%len(queries)]
+			model.sum(q.MinTime, q.MaxTime)
+		}
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package budgetchat
 
 import (
 	"bufio"
@@ -9,10 +9,14 @@ import (
 
 type Client struct {
 	conn net.Conn
+
+	// r buffers what was read past the current message, so it must live
+	// as long as the connection.
+	r *bufio.Reader
 }
 
 func NewClient(conn net.Conn) *Client {
-	return &Client{conn: conn}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}
 }
 
 func (c *Client) Send(msg string) error {
@@ -31,7 +35,7 @@ func (c *Client) Close() {
 }
 
 func (c *Client) receive() (string, error) {
-	msg, err := bufio.NewReader(c.conn).ReadBytes('\n')
+	msg, err := c.r.ReadBytes('\n')
 	if err != nil {
 		return "", fmt.Errorf("failed to read: %w", err)
 	}
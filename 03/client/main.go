@@ -3,16 +3,23 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net"
 	"os"
+
+	"github.com/sklyar/protohackers/internal/tlsconfig"
 )
 
 func main() {
 	addr := flag.String("addr", "", "")
+	useTLS := flag.Bool("tls", false, "connect over TLS")
+	caFile := flag.String("tls-ca", "", "PEM file of the CAs to verify the server with (system roots if empty)")
+	certFile := flag.String("tls-cert", "", "PEM client certificate file, for servers that require one")
+	keyFile := flag.String("tls-key", "", "PEM client key file")
 	flag.Parse()
 
 	if addr == nil || *addr == "" {
@@ -20,7 +27,19 @@ func main() {
 		os.Exit(1)
 	}
 
-	conn, err := net.Dial("tcp", *addr)
+	var conn net.Conn
+	var err error
+	if *useTLS {
+		var cfg *tls.Config
+		cfg, err = tlsconfig.Client(*caFile, *certFile, *keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid tls settings: %s\n", err)
+			os.Exit(1)
+		}
+		conn, err = tls.Dial("tcp", *addr, cfg)
+	} else {
+		conn, err = net.Dial("tcp", *addr)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to connect server: %s\n: %s", *addr, err)
 		os.Exit(1)
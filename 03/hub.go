@@ -1,14 +1,20 @@
-package main
+package budgetchat
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 	"sync"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
 )
 
-const greetingPhrase = "Welcome to budgetchat! What shall I call you?"
+// defaultGreeting is the first message sent to every client.
+const defaultGreeting = "Welcome to budgetchat! What shall I call you?"
 
 type EventType int
 
@@ -19,6 +25,34 @@ const (
 	EventTypePresence
 )
 
+func (t EventType) String() string {
+	switch t {
+	case EventTypeMessage:
+		return "message"
+	case EventTypeJoin:
+		return "join"
+	case EventTypeLeave:
+		return "leave"
+	case EventTypePresence:
+		return "presence"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+var (
+	eventsTotal = metrics.NewCounterVec(
+		"protohackers_budgetchat_events_total",
+		"Room events dispatched by type.",
+		"type",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"protohackers_budgetchat_errors_total",
+		"Errors while serving clients.",
+		"kind",
+	)
+)
+
 type Event struct {
 	From string
 	Type EventType
@@ -27,36 +61,43 @@ type Event struct {
 }
 
 type Hub struct {
+	logger   *slog.Logger
+	greeting string
+
 	clients map[string]*Client
 	mu      sync.RWMutex
 
 	events chan Event
 }
 
-func NewHub() *Hub {
+func NewHub(logger *slog.Logger, greeting string) *Hub {
 	return &Hub{
-		clients: make(map[string]*Client),
-		events:  make(chan Event, 100),
+		logger:   logger,
+		greeting: greeting,
+		clients:  make(map[string]*Client),
+		events:   make(chan Event, 100),
 	}
 }
 
-func (h *Hub) Register(client *Client) error {
-	if err := client.Send(greetingPhrase); err != nil {
-		return fmt.Errorf("failed to send greeting: %w", err)
+// Register greets the client, reads its name and announces it to the room.
+// The returned name identifies the client in a subsequent call to Serve.
+func (h *Hub) Register(client *Client) (string, error) {
+	if err := client.Send(h.greeting); err != nil {
+		return "", fmt.Errorf("failed to send greeting: %w", err)
 	}
 
 	name, err := client.Receive()
 	if err != nil {
-		return fmt.Errorf("failed to read name: %w", err)
+		return "", fmt.Errorf("failed to read name: %w", err)
 	}
 
 	if err := validateName(name); err != nil {
 		defer client.Close()
 
 		if err := client.Send(fmt.Sprintf("failed to register: %s", err)); err != nil {
-			return fmt.Errorf("failed to send error message: %w", err)
+			return "", fmt.Errorf("failed to send error message: %w", err)
 		}
-		return err
+		return "", err
 	}
 
 	h.mu.Lock()
@@ -73,27 +114,37 @@ func (h *Hub) Register(client *Client) error {
 		Type: EventTypePresence,
 	}
 
-	go h.handleClient(name, client)
-
-	return nil
+	return name, nil
 }
 
-func (h *Hub) Run() {
-	for event := range h.events {
+// Run dispatches room events until ctx is cancelled.
+func (h *Hub) Run(ctx context.Context) {
+	for {
+		var event Event
+		select {
+		case event = <-h.events:
+		case <-ctx.Done():
+			return
+		}
+
+		eventsTotal.With(event.Type.String()).Inc()
+
 		switch event.Type {
 		case EventTypeMessage:
 			msg := fmt.Sprintf("[%s] %s", event.From, event.Message)
 			h.broadcast(event.From, msg)
 
-			fmt.Println(msg)
+			h.logger.Info(msg)
 		case EventTypeJoin:
 			msg := fmt.Sprintf("* %s has entered the room", event.From)
 			h.broadcast(event.From, msg)
 
-			fmt.Println(msg)
+			h.logger.Info(msg)
 		case EventTypeLeave:
 			msg := fmt.Sprintf("* %s has left the room", event.From)
 			h.broadcast(event.From, msg)
+
+			h.logger.Info(msg)
 		case EventTypePresence:
 			h.mu.RLock()
 			client := h.clients[event.From]
@@ -109,10 +160,11 @@ func (h *Hub) Run() {
 
 			msg := fmt.Sprintf("* The room contains: %s", strings.Join(names, ", "))
 			if err := client.Send(msg); err != nil {
-				fmt.Printf("failed to send message: %s\n", err)
+				errorsTotal.With("send").Inc()
+				h.logger.Error("failed to send message", slog.String("to", event.From), slog.Any("err", err))
 			}
 
-			fmt.Println(msg)
+			h.logger.Debug(msg, slog.String("to", event.From))
 		}
 	}
 }
@@ -129,7 +181,9 @@ func (h *Hub) allClientNames() []string {
 	return names
 }
 
-func (h *Hub) handleClient(name string, client *Client) {
+// Serve relays messages from a registered client to the room until the
+// client disconnects.
+func (h *Hub) Serve(ctx context.Context, name string, client *Client) {
 	defer func() {
 		h.mu.Lock()
 		delete(h.clients, name)
@@ -147,7 +201,8 @@ func (h *Hub) handleClient(name string, client *Client) {
 			if errors.Is(err, io.EOF) {
 				return
 			}
-			fmt.Printf("failed to read message: %s\n", err)
+			errorsTotal.With("receive").Inc()
+			logging.FromContext(ctx).Error("failed to read message", slog.Any("err", err))
 			return
 		}
 
@@ -169,7 +224,8 @@ func (h *Hub) broadcast(from string, msg string) {
 		}
 
 		if err := client.Send(msg); err != nil {
-			fmt.Printf("failed to send message: %s\n", err)
+			errorsTotal.With("send").Inc()
+			h.logger.Error("failed to send message", slog.String("to", name), slog.Any("err", err))
 		}
 	}
 }
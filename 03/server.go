@@ -0,0 +1,88 @@
+package budgetchat
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+// Options are the settings of the chat room.
+type Options struct {
+	// Greeting is the first message sent to every client.
+	Greeting string
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Greeting, "chat-greeting", o.Greeting, "first message sent to every chat client (budgetchat)")
+}
+
+// Problem is Budget Chat: a single chat room.
+var Problem = problem.Problem{
+	Number: 3,
+	Name:   "budgetchat",
+	Title:  "Budget Chat",
+	NewOptions: func() problem.Options {
+		return &Options{Greeting: defaultGreeting}
+	},
+	NewServer: func(ctx context.Context, opts problem.Options) (*server.Server, error) {
+		o := opts.(*Options)
+		if o.Greeting == "" {
+			return nil, errors.New("chat greeting must not be empty")
+		}
+		s := NewServer(logging.FromContext(ctx), o.Greeting)
+
+		// The hub runs until ctx is done, which is only once the
+		// server has drained: departing clients still publish their
+		// leave events meanwhile.
+		go s.hub.Run(ctx)
+
+		// Chat members may stay silent indefinitely, but a member that
+		// stops reading must not stall the broadcast.
+		return &server.Server{
+			Name:         "budgetchat",
+			Handler:      s,
+			Reject:       reject,
+			WriteTimeout: 10 * time.Second,
+		}, nil
+	},
+}
+
+type Server struct {
+	hub *Hub
+}
+
+func NewServer(logger *slog.Logger, greeting string) *Server {
+	return &Server{
+		hub: NewHub(logger, greeting),
+	}
+}
+
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) {
+	client := NewClient(conn)
+
+	name, err := s.hub.Register(client)
+	if err != nil {
+		errorsTotal.With("register").Inc()
+		logging.FromContext(ctx).Info("failed to register", slog.Any("err", err))
+		return
+	}
+
+	logger := logging.FromContext(ctx).With(slog.String("name", name))
+	s.hub.Serve(logging.NewContext(ctx, logger), name, client)
+}
+
+// reject tells a client refused by the server limits why it cannot join.
+func reject(ctx context.Context, conn net.Conn, err error) {
+	if err := NewClient(conn).Send(fmt.Sprintf("failed to register: %s", err)); err != nil {
+		logging.FromContext(ctx).Error("failed to send message", slog.Any("err", err))
+	}
+}
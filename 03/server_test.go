@@ -0,0 +1,150 @@
+package budgetchat
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/faultnet"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestClient_Receive(t *testing.T) {
+	t.Parallel()
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	client := NewClient(local)
+	defer client.Close()
+
+	go remote.Write([]byte("one\ntwo\n"))
+	local.SetReadDeadline(time.Now().Add(time.Second))
+
+	for _, want := range []string{"one", "two"} {
+		got, err := client.Receive()
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Receive() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range faultnet.Profiles() {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			t.Parallel()
+
+			addr := serve(t)
+
+			alice := join(t, addr, "alice", p.Faults)
+			alice.expect(t, "* The room contains: ")
+			bob := join(t, addr, "bob", p.Faults)
+			bob.expect(t, "* The room contains: alice")
+			alice.expect(t, "* bob has entered the room")
+
+			bob.send(t, "hi alice\nhow are you?\n")
+			alice.expect(t, "[bob] hi alice")
+			alice.expect(t, "[bob] how are you?")
+			alice.send(t, "fine\n")
+			bob.expect(t, "[alice] fine")
+
+			bob.Close()
+			alice.expect(t, "* bob has left the room")
+		})
+	}
+}
+
+func TestServer_reset(t *testing.T) {
+	t.Parallel()
+
+	addr := serve(t)
+
+	alice := join(t, addr, "alice", faultnet.Faults{})
+	alice.expect(t, "* The room contains: ")
+
+	// bob's connection is reset in the middle of his first message, after
+	// his name and 5 bytes of it.
+	bob := join(t, addr, "bob", faultnet.Faults{ResetAfter: len("bob\n") + 5})
+	alice.expect(t, "* bob has entered the room")
+	bob.Write([]byte("hello alice\n"))
+
+	alice.expect(t, "* bob has left the room")
+}
+
+// serve starts a chat server that runs until the test is over, and returns
+// its address.
+func serve(t *testing.T) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := NewServer(discardLogger, defaultGreeting)
+	go s.hub.Run(ctx)
+	go func() {
+		srv := server.Server{Handler: s, Logger: discardLogger}
+		srv.Serve(ctx, ln)
+	}()
+	return ln.Addr().String()
+}
+
+// testClient is a chat member on the test side.
+type testClient struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// join connects to the server at addr with faults injected into what the
+// client sends, and joins the room as name.
+func join(t *testing.T, addr, name string, f faultnet.Faults) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	c := &testClient{Conn: faultnet.Wrap(conn, f), r: bufio.NewReader(conn)}
+	t.Cleanup(func() { c.Close() })
+
+	c.expect(t, defaultGreeting)
+	c.send(t, name+"\n")
+	return c
+}
+
+func (c *testClient) send(t *testing.T, msg string) {
+	t.Helper()
+
+	if _, err := c.Write([]byte(msg)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+}
+
+func (c *testClient) expect(t *testing.T, want string) {
+	t.Helper()
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read %q: %v", want, err)
+	}
+	if got := strings.TrimSuffix(line, "\n"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -20,28 +20,28 @@ func main() {
 
 	conn, err := net.Dial("udp", *addr)
 	if err != nil {
-		slog.Error("failed to connect server", err)
+		slog.Error("failed to connect server", slog.Any("err", err))
 		os.Exit(1)
 	}
 	defer conn.Close()
 
 	b, err := bufio.NewReader(os.Stdin).ReadBytes('\n')
 	if err != nil {
-		slog.Error("failed to read from stdin", err)
+		slog.Error("failed to read from stdin", slog.Any("err", err))
 		os.Exit(1)
 	}
 
 	b = b[:len(b)-1]
 
 	if _, err := conn.Write(b); err != nil {
-		slog.Error("failed to write to conn", err)
+		slog.Error("failed to write to conn", slog.Any("err", err))
 		os.Exit(1)
 	}
 
 	b = make([]byte, 1024)
 	n, err := conn.Read(b)
 	if err != nil {
-		slog.Error("failed to read from conn", err)
+		slog.Error("failed to read from conn", slog.Any("err", err))
 		os.Exit(1)
 	}
 
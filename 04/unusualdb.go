@@ -0,0 +1,173 @@
+package unusualdb
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+type command uint8
+
+const (
+	commandInsert command = iota
+	commandRetrieve
+	commandVersion
+)
+
+func (c command) String() string {
+	switch c {
+	case commandInsert:
+		return "insert"
+	case commandRetrieve:
+		return "retrieve"
+	case commandVersion:
+		return "version"
+	default:
+		return fmt.Sprintf("command(%d)", uint8(c))
+	}
+}
+
+var (
+	commandsTotal = metrics.NewCounterVec(
+		"protohackers_unusualdb_commands_total",
+		"Requests handled by command.",
+		"command",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"protohackers_unusualdb_errors_total",
+		"Errors while handling requests.",
+		"kind",
+	)
+)
+
+// defaultVersion is the version reported for the version key.
+const defaultVersion = "1.0.0"
+
+// maxPacketSize is the size of the largest datagram a client may send.
+const maxPacketSize = 1000
+
+func determineCommand(msg string) command {
+	if msg == "version" {
+		return commandVersion
+	}
+
+	if strings.Contains(msg, "=") {
+		return commandInsert
+	}
+
+	return commandRetrieve
+}
+
+// Options are the settings of the database.
+type Options struct {
+	// Version is the version reported for the version key.
+	Version string
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Version, "db-version", o.Version, "version reported for the version key (unusualdb)")
+}
+
+// Problem is Unusual Database Program: a key-value store over UDP.
+var Problem = problem.Problem{
+	Number: 4,
+	Name:   "unusualdb",
+	Title:  "Unusual Database Program",
+	NewOptions: func() problem.Options {
+		return &Options{Version: defaultVersion}
+	},
+	NewPacketServer: func(_ context.Context, opts problem.Options) (*server.PacketServer, error) {
+		return &server.PacketServer{
+			Name:          "unusualdb",
+			Handler:       NewServer(opts.(*Options).Version),
+			MaxPacketSize: maxPacketSize,
+		}, nil
+	},
+}
+
+type Server struct {
+	version string
+
+	store map[string]string
+	mu    sync.RWMutex
+}
+
+func NewServer(version string) *Server {
+	return &Server{
+		version: version,
+		store:   make(map[string]string),
+	}
+}
+
+func (s *Server) ServePacket(ctx context.Context, pc net.PacketConn, addr net.Addr, payload []byte) {
+	logger := logging.FromContext(ctx)
+	msg := string(payload)
+
+	cmd := determineCommand(msg)
+	commandsTotal.With(cmd.String()).Inc()
+
+	switch cmd {
+	case commandInsert:
+		s.handleInsert(logger, msg)
+	case commandRetrieve:
+		s.handleRetrieve(logger, pc, addr, msg)
+	case commandVersion:
+		s.handleVersion(logger, pc, addr)
+	}
+
+	logger.Debug("received message", slog.String("msg", msg))
+}
+
+func (s *Server) handleInsert(logger *slog.Logger, msg string) {
+	parts := strings.SplitN(msg, "=", 2)
+	if len(parts) != 2 {
+		errorsTotal.With("bad_message").Inc()
+		logger.Error("bad message", slog.String("msg", msg))
+		return
+	}
+
+	key, value := parts[0], parts[1]
+	if key == "version" {
+		return
+	}
+
+	s.mu.Lock()
+	s.store[key] = value
+	s.mu.Unlock()
+}
+
+func (s *Server) handleRetrieve(logger *slog.Logger, pc net.PacketConn, addr net.Addr, key string) {
+	s.mu.RLock()
+	value := s.store[key]
+	s.mu.RUnlock()
+
+	_, err := pc.WriteTo(newResponse(key, value), addr)
+	if err != nil {
+		errorsTotal.With("write").Inc()
+		logger.Error("failed to write", slog.Any("err", err))
+		return
+	}
+}
+
+func (s *Server) handleVersion(logger *slog.Logger, pc net.PacketConn, addr net.Addr) {
+	_, err := pc.WriteTo(newResponse("version", s.version), addr)
+	if err != nil {
+		errorsTotal.With("write").Inc()
+		logger.Error("failed to write", slog.Any("err", err))
+		return
+	}
+}
+
+func newResponse(key, value string) []byte {
+	return []byte(fmt.Sprintf("%s=%s", key, value))
+}
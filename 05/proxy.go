@@ -0,0 +1,210 @@
+package mobinthemiddle
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/proxyproto"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+// defaultTonyAddress is the Boguscoin address that replaces every other.
+const defaultTonyAddress = "7YWHMfk9JZe0LM0g1ZauHuiSxhI"
+
+// Directions in which messages are relayed.
+const (
+	directionUpstream   = "upstream"
+	directionDownstream = "downstream"
+)
+
+var (
+	messagesTotal = metrics.NewCounterVec(
+		"protohackers_mobinthemiddle_messages_total",
+		"Messages relayed by direction.",
+		"direction",
+	)
+	rewritesTotal = metrics.NewCounterVec(
+		"protohackers_mobinthemiddle_rewrites_total",
+		"Messages with a rewritten Boguscoin address by direction.",
+		"direction",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"protohackers_mobinthemiddle_errors_total",
+		"Errors while relaying messages.",
+		"kind",
+	)
+)
+
+// Options are the settings of the proxy.
+type Options struct {
+	// UpstreamAddr is the address of the chat server the proxy relays to.
+	UpstreamAddr string
+
+	// TonyAddress is the Boguscoin address that replaces every other.
+	TonyAddress string
+
+	// UpstreamProxyProtocol is the version of the PROXY protocol header
+	// sent upstream, or 0 for none.
+	UpstreamProxyProtocol int
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.UpstreamAddr, "upstream-addr", o.UpstreamAddr, "address of the chat server to proxy (mobinthemiddle)")
+	fs.StringVar(&o.TonyAddress, "tony-address", o.TonyAddress, "Boguscoin address that replaces every other (mobinthemiddle)")
+	fs.IntVar(&o.UpstreamProxyProtocol, "upstream-proxy-protocol", o.UpstreamProxyProtocol, "PROXY protocol version (1 or 2) of the header sent to the chat server with the client address, or 0 for none (mobinthemiddle)")
+}
+
+// Problem is Mob in the Middle: a rewriting proxy for Budget Chat.
+var Problem = problem.Problem{
+	Number: 5,
+	Name:   "mobinthemiddle",
+	Title:  "Mob in the Middle",
+	NewOptions: func() problem.Options {
+		return &Options{TonyAddress: defaultTonyAddress}
+	},
+	NewServer: func(_ context.Context, opts problem.Options) (*server.Server, error) {
+		o := opts.(*Options)
+		if o.UpstreamAddr == "" {
+			return nil, errors.New("upstream address must be set")
+		}
+		if !isBogusCoinAddress(o.TonyAddress) {
+			return nil, fmt.Errorf("invalid Boguscoin address %q", o.TonyAddress)
+		}
+		if o.UpstreamProxyProtocol < 0 || o.UpstreamProxyProtocol > 2 {
+			return nil, fmt.Errorf("invalid PROXY protocol version %d", o.UpstreamProxyProtocol)
+		}
+		return &server.Server{
+			Name: "mobinthemiddle",
+			Handler: &Proxy{
+				upstreamAddr:  o.UpstreamAddr,
+				tonyAddress:   o.TonyAddress,
+				proxyProtocol: o.UpstreamProxyProtocol,
+			},
+			WriteTimeout: 10 * time.Second,
+		}, nil
+	},
+}
+
+// Proxy relays chat traffic between a client and the upstream server,
+// rewriting Boguscoin addresses in both directions.
+type Proxy struct {
+	upstreamAddr string
+	tonyAddress  string
+
+	// proxyProtocol is the version of the PROXY protocol header that
+	// tells the upstream the client address, or 0 for none.
+	proxyProtocol int
+}
+
+func (p *Proxy) ServeConn(ctx context.Context, conn net.Conn) {
+	logger := logging.FromContext(ctx)
+
+	upstreamConn, err := net.Dial("tcp", p.upstreamAddr)
+	if err != nil {
+		errorsTotal.With("dial").Inc()
+		logger.Error("failed to connect server", slog.Any("err", err))
+		return
+	}
+	defer upstreamConn.Close()
+
+	if p.proxyProtocol != 0 {
+		h := proxyproto.Header{Version: p.proxyProtocol, Source: conn.RemoteAddr(), Destination: conn.LocalAddr()}
+		b, err := h.Format()
+		if err == nil {
+			_, err = upstreamConn.Write(b)
+		}
+		if err != nil {
+			errorsTotal.With("write").Inc()
+			logger.Error("failed to send the PROXY protocol header", slog.Any("err", err))
+			return
+		}
+	}
+
+	// Whichever side hangs up first closes the other one, so that both
+	// directions finish before the connection is released.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.proxy(logger, upstreamConn, conn, directionDownstream)
+		conn.Close()
+	}()
+
+	p.proxy(logger, conn, upstreamConn, directionUpstream)
+	upstreamConn.Close()
+	wg.Wait()
+}
+
+func (p *Proxy) proxy(logger *slog.Logger, src, dst net.Conn, direction string) {
+	logger = logger.With(slog.String("direction", direction))
+
+	// The reader keeps what it read past the current message, so it must
+	// serve the whole connection.
+	r := bufio.NewReader(src)
+	for {
+		msg, err := r.ReadString('\n')
+		if err != nil {
+			logger.Debug("failed to read message", slog.Any("err", err))
+			return
+		}
+		logger.Debug("received message", slog.String("data", msg))
+
+		messagesTotal.With(direction).Inc()
+
+		if rewritten := replaceAddress(msg, p.tonyAddress); rewritten != msg {
+			rewritesTotal.With(direction).Inc()
+			msg = rewritten
+		}
+
+		_, err = dst.Write([]byte(msg))
+		if err != nil {
+			errorsTotal.With("write").Inc()
+			logger.Error("failed to write message", slog.Any("err", err))
+			return
+		}
+	}
+}
+
+// isBogusCoinAddress reports whether input is a Boguscoin address: 26 to
+// 35 alphanumeric characters starting with a 7.
+func isBogusCoinAddress(input string) bool {
+	if len(input) < 26 || len(input) > 35 || input[0] != '7' {
+		return false
+	}
+	for _, c := range []byte(input) {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func replaceAddress(input, replacement string) string {
+	words := strings.Split(strings.Trim(input, "\n"), " ")
+
+	var isBogus bool
+	for i, word := range words {
+		if isBogusCoinAddress(word) {
+			words[i] = replacement
+			isBogus = true
+		}
+	}
+
+	if !isBogus {
+		return input
+	}
+
+	return strings.Join(words, " ") + "\n"
+}
@@ -0,0 +1,202 @@
+package mobinthemiddle
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/faultnet"
+	"github.com/sklyar/protohackers/internal/proxyproto"
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range faultnet.Profiles() {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The upstream sends two lines at once, then reports every
+			// line it receives. Its writes go through the faults too.
+			upstream, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer upstream.Close()
+			received := make(chan string, 10)
+			go func() {
+				conn, err := faultnet.Listener(upstream, p.Faults).Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				conn.Write([]byte("Welcome! Pay 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX\nWho are you?\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					received <- line
+					conn.Write([]byte("[bob] " + line))
+				}
+			}()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			go func() {
+				srv := server.Server{
+					Handler: &Proxy{upstreamAddr: upstream.Addr().String(), tonyAddress: defaultTonyAddress},
+					Logger:  discardLogger,
+				}
+				srv.Serve(ctx, ln)
+			}()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			r := bufio.NewReader(conn)
+			conn = faultnet.Wrap(conn, p.Faults)
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+			expect := func(want string) {
+				t.Helper()
+
+				line, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("failed to read %q: %v", want, err)
+				}
+				if got := strings.TrimSuffix(line, "\n"); got != want {
+					t.Fatalf("got %q, want %q", got, want)
+				}
+			}
+			expectUpstream := func(want string) {
+				t.Helper()
+
+				select {
+				case line := <-received:
+					if got := strings.TrimSuffix(line, "\n"); got != want {
+						t.Fatalf("upstream got %q, want %q", got, want)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("upstream did not receive %q", want)
+				}
+			}
+
+			expect("Welcome! Pay " + defaultTonyAddress)
+			expect("Who are you?")
+
+			if _, err := conn.Write([]byte("Send to 7F1u3wSD5RbOHQmupo9nx4TnhQ please\nthanks\n")); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+			expectUpstream("Send to " + defaultTonyAddress + " please")
+			expectUpstream("thanks")
+			expect("[bob] Send to " + defaultTonyAddress + " please")
+			expect("[bob] thanks")
+		})
+	}
+}
+
+func TestProxy_proxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	for _, version := range []int{1, 2} {
+		version := version
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			upstream, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer upstream.Close()
+			headers := make(chan *proxyproto.Header, 1)
+			go func() {
+				conn, err := upstream.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				h, err := proxyproto.Read(bufio.NewReader(conn))
+				if err != nil {
+					t.Errorf("failed to read the header: %v", err)
+				}
+				headers <- h
+			}()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			go func() {
+				srv := server.Server{
+					Handler: &Proxy{upstreamAddr: upstream.Addr().String(), tonyAddress: defaultTonyAddress, proxyProtocol: version},
+					Logger:  discardLogger,
+				}
+				srv.Serve(ctx, ln)
+			}()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			select {
+			case h := <-headers:
+				if h == nil || h.Version != version || h.Source.String() != conn.LocalAddr().String() || h.Destination.String() != ln.Addr().String() {
+					t.Errorf("upstream got header %+v, want version %d from %s to %s", h, version, conn.LocalAddr(), ln.Addr())
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("upstream got no header")
+			}
+		})
+	}
+}
+
+func TestReplaceAddress(t *testing.T) {
+	t.Parallel()
+
+	const tony = defaultTonyAddress
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"hello\n", "hello\n"},
+		{"7F1u3wSD5RbOHQmupo9nx4TnhQ\n", tony + "\n"},
+		{"pay 7F1u3wSD5RbOHQmupo9nx4TnhQ now\n", "pay " + tony + " now\n"},
+		{"pay 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX\n", "pay " + tony + "\n"},
+		{"7YWHMfk9JZe0LM0g1ZauHuiSxhI 7LOrwbDlS8NujgjddyogWgIM93MV5N2VR\n", tony + " " + tony + "\n"},
+		{"too short 7F1u3wSD5RbOHQmupo9nx4Tn\n", "too short 7F1u3wSD5RbOHQmupo9nx4Tn\n"},
+		{"too long 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX12345\n", "too long 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX12345\n"},
+		{"wrong start 8F1u3wSD5RbOHQmupo9nx4TnhQ\n", "wrong start 8F1u3wSD5RbOHQmupo9nx4TnhQ\n"},
+		{"product ID 7jFBixq0RRM2Za3ZAM7pgsUOCFtIS-1234\n", "product ID 7jFBixq0RRM2Za3ZAM7pgsUOCFtIS-1234\n"},
+	}
+	for _, tt := range tests {
+		if got := replaceAddress(tt.input, tony); got != tt.want {
+			t.Errorf("replaceAddress(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
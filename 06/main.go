@@ -1,14 +0,0 @@
-package main
-
-import (
-	"context"
-	"os/signal"
-	"syscall"
-)
-
-func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
-
-	_ = ctx
-}
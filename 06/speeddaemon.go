@@ -0,0 +1,11 @@
+package speeddaemon
+
+import "github.com/sklyar/protohackers/internal/problem"
+
+// Problem is Speed Daemon. Only its wire protocol is implemented so far, so
+// it has no server.
+var Problem = problem.Problem{
+	Number: 6,
+	Name:   "speeddaemon",
+	Title:  "Speed Daemon",
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/check"
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/problem"
+)
+
+// errChecksFailed is returned when a scenario fails.
+var errChecksFailed = errors.New("checks failed")
+
+func checkProblems(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: protohackers check [flags] [<problem>...]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", "", "address of a running server to check; by default local servers are started")
+	timeout := fs.Duration("timeout", check.DefaultTimeout, "how long to wait for each expected response")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(fs)
+	options := registerProblemFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+	if err := setFromEnv(fs); err != nil {
+		return err
+	}
+	if *addr != "" && fs.NArg() != 1 {
+		fmt.Fprint(stderr, "protohackers: check -addr needs exactly one problem\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	var targets []problem.Problem
+	for _, name := range fs.Args() {
+		p, ok := problem.Lookup(problems, name)
+		if !ok {
+			return fmt.Errorf("unknown problem %q", name)
+		}
+		if p.Network() == "" {
+			return fmt.Errorf("problem %s has no server", p.Name)
+		}
+		if len(check.Scenarios(p.Name)) == 0 {
+			return fmt.Errorf("problem %s has no scenarios", p.Name)
+		}
+		targets = append(targets, p)
+	}
+	if len(targets) == 0 {
+		for _, p := range problems {
+			if p.Network() != "" && len(check.Scenarios(p.Name)) > 0 {
+				targets = append(targets, p)
+			}
+		}
+	}
+
+	logger, err := logOpts.New(stderr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Scenarios only rely on the settings given explicitly, unless they
+	// run against local servers, which use every setting.
+	settings := make(map[string]string)
+	visit := fs.Visit
+	if *addr == "" {
+		visit = fs.VisitAll
+	}
+	visit(func(f *flag.Flag) { settings[f.Name] = f.Value.String() })
+
+	failed := false
+	for _, p := range targets {
+		cfg := check.Config{Addr: *addr, Timeout: *timeout, Settings: settings}
+		if cfg.Addr == "" {
+			if cfg.Addr, err = startLocalServer(ctx, p, options, logger); err != nil {
+				return fmt.Errorf("%s: %w", p.Name, err)
+			}
+		}
+
+		for _, res := range check.Run(ctx, cfg, check.Scenarios(p.Name)) {
+			name := p.Name + "/" + res.Name
+			if !res.Failed() {
+				fmt.Fprintf(stdout, "ok   %s (%s)\n", name, res.Duration.Round(time.Millisecond))
+				continue
+			}
+			failed = true
+			fmt.Fprintf(stdout, "FAIL %s (%s)\n", name, res.Duration.Round(time.Millisecond))
+			for _, f := range res.Failures {
+				fmt.Fprintf(stdout, "\t%s\n", strings.ReplaceAll(f, "\n", "\n\t"))
+			}
+		}
+	}
+
+	if failed {
+		return errChecksFailed
+	}
+	return nil
+}
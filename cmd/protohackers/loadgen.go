@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sklyar/protohackers/internal/loadgen"
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/problem"
+)
+
+// errThresholdExceeded is returned when a load run breaks one of the limits
+// it was given.
+var errThresholdExceeded = errors.New("load thresholds exceeded")
+
+func loadgenProblem(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: protohackers loadgen [flags] <problem>\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	var opts loadgen.Options
+	fs.StringVar(&opts.Addr, "addr", "", "address of a running server to load; by default a local server is started")
+	fs.IntVar(&opts.Clients, "clients", loadgen.DefaultClients, "number of concurrent clients")
+	fs.DurationVar(&opts.Duration, "duration", loadgen.DefaultDuration, "how long to generate load; 0 runs until every client made -requests requests")
+	fs.IntVar(&opts.Requests, "requests", 0, "number of requests every client makes; 0 means no limit")
+	fs.Float64Var(&opts.Rate, "rate", 0, "requests per second every client makes; 0 means as fast as possible")
+	fs.DurationVar(&opts.Timeout, "timeout", loadgen.DefaultTimeout, "how long a request may take")
+	maxP99 := fs.Duration("max-p99", 0, "fail if the 99th percentile latency exceeds this; 0 means no limit")
+	maxErrors := fs.Int("max-errors", -1, "fail if there are more errors than this; -1 means no limit")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(fs)
+	options := registerProblemFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+	if err := setFromEnv(fs); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || (opts.Duration <= 0 && opts.Requests <= 0) {
+		fmt.Fprint(stderr, "protohackers: loadgen needs one problem and a -duration or -requests\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	p, ok := problem.Lookup(problems, fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("unknown problem %q", fs.Arg(0))
+	}
+	w, ok := loadgen.Lookup(p.Name)
+	if !ok {
+		return fmt.Errorf("problem %s has no workload", p.Name)
+	}
+
+	logger, err := logOpts.New(stderr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.Addr == "" {
+		// The speeddaemon workload is ready for a server that does not
+		// exist yet; it can only be pointed at one with -addr.
+		if p.Network() == "" {
+			return fmt.Errorf("problem %s has no server to start; give the address of one with -addr", p.Name)
+		}
+		if opts.Addr, err = startLocalServer(ctx, p, options, logger); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+
+	report := loadgen.Run(ctx, w, opts)
+	if _, err := report.WriteTo(stdout); err != nil {
+		return err
+	}
+
+	if *maxP99 > 0 && report.Percentile(99) > *maxP99 {
+		return fmt.Errorf("%w: p99 latency %s is above %s", errThresholdExceeded, report.Percentile(99), *maxP99)
+	}
+	if *maxErrors >= 0 && report.ErrorCount() > *maxErrors {
+		return fmt.Errorf("%w: %d errors, at most %d allowed", errThresholdExceeded, report.ErrorCount(), *maxErrors)
+	}
+	return nil
+}
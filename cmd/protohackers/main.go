@@ -0,0 +1,163 @@
+// Command protohackers serves the protohackers.com solutions in this
+// repository.
+//
+// Usage:
+//
+//	protohackers serve [flags] <problem>[=<addr>]...
+//	protohackers replay [flags] <capture>...
+//	protohackers check [flags] [<problem>...]
+//	protohackers loadgen [flags] <problem>
+//	protohackers list
+//
+// A problem is referred to by number, name or alias, as shown by list.
+// The address of a served problem may list several separated by commas,
+// each prefixed with its network if that is not the problem's default, as
+// in echo=:7,udp://:7,unix:///run/echo.sock.
+// Every flag falls back to the environment variable named after it, so
+// -metrics-addr may also be set with METRICS_ADDR.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	smoketest "github.com/sklyar/protohackers/00"
+	primetime "github.com/sklyar/protohackers/01"
+	means "github.com/sklyar/protohackers/02"
+	budgetchat "github.com/sklyar/protohackers/03"
+	unusualdb "github.com/sklyar/protohackers/04"
+	mobinthemiddle "github.com/sklyar/protohackers/05"
+	speeddaemon "github.com/sklyar/protohackers/06"
+	"github.com/sklyar/protohackers/internal/problem"
+)
+
+// problems are the problems the command knows about, in order.
+var problems = []problem.Problem{
+	smoketest.Problem,
+	primetime.Problem,
+	means.Problem,
+	budgetchat.Problem,
+	unusualdb.Problem,
+	mobinthemiddle.Problem,
+	speeddaemon.Problem,
+}
+
+const usage = `usage: protohackers <command> [arguments]
+
+commands:
+  serve [flags] <problem>[=<addr>]...  serve one or more problems
+  replay [flags] <capture>...          replay captured sessions against a server
+  check [flags] [<problem>...]         run conformance scenarios against servers
+  loadgen [flags] <problem>            generate load against a server
+  list                                 list the available problems
+
+Run "protohackers <command> -h" for the flags of a command.
+`
+
+// errUsage is returned for invalid command lines, after the problem has
+// been reported.
+var errUsage = errors.New("usage error")
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "protohackers: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errUsage
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "serve":
+		return serve(ctx, args, stderr)
+	case "replay":
+		return replay(ctx, args, stdout, stderr)
+	case "check":
+		return checkProblems(ctx, args, stdout, stderr)
+	case "loadgen":
+		return loadgenProblem(ctx, args, stdout, stderr)
+	case "list":
+		return list(stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprintf(stderr, "protohackers: unknown command %q\n\n%s", cmd, usage)
+		return errUsage
+	}
+}
+
+func list(w io.Writer) error {
+	for _, p := range problems {
+		network := p.Network()
+		if network == "" {
+			network = "-"
+		}
+
+		name := p.Name
+		for _, alias := range p.Aliases {
+			name += ", " + alias
+		}
+
+		if _, err := fmt.Fprintf(w, "%02d  %-4s %-22s %s\n", p.Number, network, name, p.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerProblemFlags registers the flags of every problem on fs, and
+// returns the options they set by problem number.
+func registerProblemFlags(fs *flag.FlagSet) map[int]problem.Options {
+	options := make(map[int]problem.Options)
+	for _, p := range problems {
+		if opts := p.Options(); opts != nil {
+			opts.RegisterFlags(fs)
+			options[p.Number] = opts
+		}
+	}
+	return options
+}
+
+// setFromEnv sets every flag in fs that was not given on the command line
+// from the environment variable named after it: -metrics-addr falls back to
+// METRICS_ADDR.
+func setFromEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		name := envName(f.Name)
+		if v, ok := os.LookupEnv(name); ok {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", v, name, serr)
+			}
+		}
+	})
+	return err
+}
+
+func envName(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
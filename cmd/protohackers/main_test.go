@@ -0,0 +1,845 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	means "github.com/sklyar/protohackers/02"
+	"github.com/sklyar/protohackers/internal/capture"
+	"github.com/sklyar/protohackers/internal/check"
+	"github.com/sklyar/protohackers/internal/config"
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/server"
+	"github.com/sklyar/protohackers/internal/tlsconfig"
+)
+
+func TestParseTargets(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		Problems: map[string]map[string]string{
+			"echo":      {"addr": ":7000", "idle-timeout": "5s"},
+			"unusualdb": {"addr": ":7004"},
+			"means":     nil,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		cfg     *config.Config
+		addr    string
+		addrSet bool
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "single problem on default address",
+			args: []string{"echo"},
+			want: []string{"smoketest@:8080"},
+		},
+		{
+			name: "single problem with address",
+			args: []string{"1=:9001"},
+			want: []string{"primetime@:9001"},
+		},
+		{
+			name: "several problems",
+			args: []string{"00=:9000", "BudgetChat=:9003", "unusualdb=:9004"},
+			want: []string{"smoketest@:9000", "budgetchat@:9003", "unusualdb@:9004"},
+		},
+		{
+			name:    "explicit address",
+			args:    []string{"echo"},
+			cfg:     cfg,
+			addr:    ":6000",
+			addrSet: true,
+			want:    []string{"smoketest@:6000"},
+		},
+		{
+			name: "address from config",
+			args: []string{"echo"},
+			cfg:  cfg,
+			want: []string{"smoketest@:7000"},
+		},
+		{
+			name: "argument address over config",
+			args: []string{"0=:6000", "4"},
+			cfg:  cfg,
+			want: []string{"smoketest@:6000", "unusualdb@:7004"},
+		},
+		{
+			name:    "configured problems",
+			cfg:     cfg,
+			wantErr: "problem 02 means needs an address when serving several problems",
+		},
+		{
+			name: "configured problems with addresses",
+			cfg: &config.Config{Problems: map[string]map[string]string{
+				"4": {"addr": ":7004"},
+				"0": {"addr": ":7000"},
+			}},
+			want: []string{"smoketest@:7000", "unusualdb@:7004"},
+		},
+		{
+			name:    "unknown configured problem",
+			cfg:     &config.Config{Problems: map[string]map[string]string{"tetris": nil}},
+			wantErr: `config: unknown problem "tetris"`,
+		},
+		{
+			name:    "problem configured twice",
+			cfg:     &config.Config{Problems: map[string]map[string]string{"0": nil, "echo": nil}},
+			wantErr: "config: problem 00 smoketest is configured more than once",
+		},
+		{
+			name:    "no problem",
+			wantErr: "no problem to serve",
+		},
+		{
+			name:    "unknown problem",
+			args:    []string{"tetris"},
+			wantErr: `unknown problem "tetris"`,
+		},
+		{
+			name:    "problem without server",
+			args:    []string{"6"},
+			wantErr: "problem 06 speeddaemon has no server",
+		},
+		{
+			name:    "several problems without addresses",
+			args:    []string{"0=:9000", "1"},
+			wantErr: "problem 01 primetime needs an address when serving several problems",
+		},
+		{
+			name:    "empty address",
+			args:    []string{"0="},
+			wantErr: "empty address for problem 00 smoketest",
+		},
+		{
+			name: "several listeners",
+			args: []string{"echo=:7000,udp://:7000,unix:///tmp/echo.sock", "unusualdb=udp://:7004"},
+			want: []string{"smoketest@:7000,udp://:7000,unix:///tmp/echo.sock", "unusualdb@udp://:7004"},
+		},
+		{
+			name:    "empty listener",
+			args:    []string{"echo=:7000,"},
+			wantErr: "empty address for problem 00 smoketest",
+		},
+		{
+			name:    "unknown network",
+			args:    []string{"echo=sctp://:7000"},
+			wantErr: `unknown network "sctp" for problem 00 smoketest`,
+		},
+		{
+			name: "tls listener",
+			args: []string{"budgetchat=:9003,tls://:9443"},
+			want: []string{"budgetchat@:9003,tls://:9443"},
+		},
+		{
+			name:    "tls over udp",
+			args:    []string{"unusualdb=tls://:7004"},
+			wantErr: "problem 04 unusualdb cannot be served over tls",
+		},
+		{
+			name: "http listener",
+			args: []string{"primetime=:9001,http://:8081"},
+			want: []string{"primetime@:9001,http://:8081"},
+		},
+		{
+			name:    "http without gateway",
+			args:    []string{"echo=http://:7000"},
+			wantErr: "problem 00 smoketest cannot be served over http",
+		},
+		{
+			name:    "unsupported network",
+			args:    []string{"means=udp://:7002"},
+			wantErr: "problem 02 means cannot be served over udp",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, addr := tt.cfg, tt.addr
+			if cfg == nil {
+				cfg = &config.Config{}
+			}
+			if addr == "" {
+				addr = defaultAddr
+			}
+
+			targets, err := parseTargets(tt.args, cfg, addr, tt.addrSet)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseTargets() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTargets() error = %v", err)
+			}
+
+			got := make([]string, len(targets))
+			for i, target := range targets {
+				got[i] = target.problem.Name + "@" + target.addr
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("parseTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetFromEnv(t *testing.T) {
+	t.Setenv("METRICS_ADDR", ":9100")
+	t.Setenv("IDLE_TIMEOUT", "5s")
+	t.Setenv("ADDR", ":9999")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addr := fs.String("addr", defaultAddr, "")
+	metricsAddr := fs.String("metrics-addr", "", "")
+	var srv server.Server
+	srv.RegisterFlags(fs)
+
+	if err := fs.Parse([]string{"-addr", ":7000"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if err := setFromEnv(fs); err != nil {
+		t.Fatalf("setFromEnv() error = %v", err)
+	}
+
+	if *addr != ":7000" {
+		t.Errorf("addr = %q, want the command line value %q", *addr, ":7000")
+	}
+	if *metricsAddr != ":9100" {
+		t.Errorf("metrics-addr = %q, want %q", *metricsAddr, ":9100")
+	}
+	if srv.IdleTimeout != 5*time.Second {
+		t.Errorf("idle-timeout = %v, want %v", srv.IdleTimeout, 5*time.Second)
+	}
+
+	t.Setenv("MAX_CONNS", "many")
+	if err := setFromEnv(fs); err == nil {
+		t.Error("setFromEnv() with an invalid value succeeded")
+	}
+}
+
+func TestApplyServerFlags(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var defaults server.Server
+	defaults.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-max-conns", "3"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	srv := server.Server{IdleTimeout: time.Minute}
+	if err := applyServerFlags(&srv, fs); err != nil {
+		t.Fatalf("applyServerFlags() error = %v", err)
+	}
+	if srv.MaxConns != 3 {
+		t.Errorf("MaxConns = %d, want %d", srv.MaxConns, 3)
+	}
+	if srv.IdleTimeout != time.Minute {
+		t.Errorf("IdleTimeout = %v, want the problem default %v", srv.IdleTimeout, time.Minute)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	t.Parallel()
+
+	type settings struct {
+		ShutdownTimeout, IdleTimeout time.Duration
+		MaxConns, MaxConnsPerIP      int
+	}
+	tests := []struct {
+		name string
+		args []string
+		want settings
+	}{
+		{
+			name: "problem settings",
+			want: settings{ShutdownTimeout: 5 * time.Second, MaxConns: 3, MaxConnsPerIP: 2, IdleTimeout: time.Minute},
+		},
+		{
+			name: "flags",
+			args: []string{"-max-conns", "7", "-shutdown-timeout", "1s"},
+			want: settings{ShutdownTimeout: time.Second, MaxConns: 7, MaxConnsPerIP: 2, IdleTimeout: time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("capture-dir", "", "")
+			fs.Bool("proxy-protocol", false, "")
+			var logOpts logging.Options
+			logOpts.RegisterFlags(fs)
+			var defaults server.Server
+			defaults.RegisterFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			var srv *server.Server
+			p := problem.Problem{Name: "preset", NewServer: func(context.Context, problem.Options) (*server.Server, error) {
+				srv = &server.Server{
+					Handler:         server.HandlerFunc(func(context.Context, net.Conn) {}),
+					ShutdownTimeout: 5 * time.Second,
+					MaxConns:        3,
+					MaxConnsPerIP:   2,
+					IdleTimeout:     time.Minute,
+				}
+				return srv, nil
+			}}
+			target := target{problem: p, listeners: []listenAddr{{network: problem.NetworkTCP, addr: "127.0.0.1:0"}}}
+			noSkip := func(string) bool { return false }
+
+			inst, err := prepare(context.Background(), target, fs, noSkip, io.Discard, "", nil)
+			if err != nil {
+				t.Fatalf("prepare() error = %v", err)
+			}
+			inst.close()
+
+			got := settings{ShutdownTimeout: srv.ShutdownTimeout, MaxConns: srv.MaxConns, MaxConnsPerIP: srv.MaxConnsPerIP, IdleTimeout: srv.IdleTimeout}
+			if got != tt.want {
+				t.Errorf("server settings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepare_options(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("capture-dir", "", "")
+	fs.Bool("proxy-protocol", false, "")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(fs)
+
+	var greetings []string
+	p := problem.Problem{
+		Name:       "greeter",
+		NewOptions: func() problem.Options { return &greeterOptions{greeting: "hello"} },
+		NewServer: func(_ context.Context, opts problem.Options) (*server.Server, error) {
+			greetings = append(greetings, opts.(*greeterOptions).greeting)
+			return &server.Server{Handler: server.HandlerFunc(func(context.Context, net.Conn) {})}, nil
+		},
+	}
+	p.Options().RegisterFlags(fs)
+	if err := fs.Parse([]string{"-greeting", "hey"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// Servers of the same problem get options of their own, so the
+	// config of one does not leak into the other.
+	noSkip := func(string) bool { return false }
+	for _, settings := range []map[string]string{{"greeting": "hi"}, nil} {
+		target := target{problem: p, listeners: []listenAddr{{network: problem.NetworkTCP, addr: "127.0.0.1:0"}}, settings: settings}
+		inst, err := prepare(context.Background(), target, fs, noSkip, io.Discard, "", nil)
+		if err != nil {
+			t.Fatalf("prepare() error = %v", err)
+		}
+		inst.close()
+	}
+	if want := []string{"hi", "hey"}; !slices.Equal(greetings, want) {
+		t.Errorf("greetings = %q, want %q", greetings, want)
+	}
+}
+
+// greeterOptions are the options of the problem of TestPrepare_options.
+type greeterOptions struct {
+	greeting string
+}
+
+func (o *greeterOptions) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.greeting, "greeting", o.greeting, "")
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+
+		var stdout strings.Builder
+		if err := run(context.Background(), []string{"list"}, &stdout, io.Discard); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if lines := strings.Count(stdout.String(), "\n"); lines != len(problems) {
+			t.Errorf("list printed %d lines, want %d", lines, len(problems))
+		}
+		if !strings.Contains(stdout.String(), "smoketest, echo") {
+			t.Errorf("list output %q does not mention the echo alias", stdout.String())
+		}
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		t.Parallel()
+
+		if err := run(context.Background(), []string{"frobnicate"}, io.Discard, io.Discard); !errors.Is(err, errUsage) {
+			t.Errorf("run() error = %v, want %v", err, errUsage)
+		}
+	})
+
+	t.Run("serve", func(t *testing.T) {
+		t.Parallel()
+
+		echoAddr, chatAddr := freeAddr(t), freeAddr(t)
+
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		cfg := "log-level: warn\nproblems:\n" +
+			"  budgetchat:\n    addr: " + chatAddr + "\n    chat-greeting: Who goes there?\n"
+		if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		captureDir := t.TempDir()
+
+		sock := filepath.Join(t.TempDir(), "echo.sock")
+		echoListeners := echoAddr + ",udp://" + echoAddr + ",unix://" + sock
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- run(ctx, []string{"serve", "-config", path, "-capture-dir", captureDir, "echo=" + echoListeners, "budgetchat"}, io.Discard, io.Discard)
+		}()
+
+		// Every listener is up once one of them accepts.
+		for _, conn := range []net.Conn{dial(t, echoAddr), dialNetwork(t, "udp", echoAddr), dialNetwork(t, "unix", sock)} {
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write([]byte("ping\n")); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+			if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "ping\n" {
+				t.Fatalf("echo over %s = %q, %v, want %q", conn.LocalAddr().Network(), line, err, "ping\n")
+			}
+			conn.Close()
+		}
+
+		conn := dial(t, chatAddr)
+		if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "Who goes there?\n" {
+			t.Fatalf("greeting = %q, %v, want %q", line, err, "Who goes there?\n")
+		}
+		conn.Close()
+
+		cancel()
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("serve did not stop")
+		}
+
+		// Every echo transport records a session of its own.
+		for name, want := range map[string]int{"smoketest": 3, "budgetchat": 1} {
+			if captures, _ := filepath.Glob(filepath.Join(captureDir, name, "*.jsonl")); len(captures) != want {
+				t.Errorf("got %d %s captures, want %d", len(captures), name, want)
+			}
+		}
+	})
+}
+
+func TestServe_tls(t *testing.T) {
+	t.Parallel()
+
+	t.Run("self-signed", func(t *testing.T) {
+		t.Parallel()
+
+		addr := freeAddr(t)
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- run(ctx, []string{"serve", "-log-level", "warn", "-tls-self-signed-ca", caFile, "echo=tls://" + addr}, io.Discard, io.Discard)
+		}()
+
+		// The CA file is written before the server listens.
+		conn := dial(t, addr)
+		cfg, err := tlsconfig.Client(caFile, "", "")
+		if err != nil {
+			t.Fatalf("Client() error = %v", err)
+		}
+		cfg.ServerName = "localhost"
+		tc := tls.Client(conn, cfg)
+		tc.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := tc.Write([]byte("ping\n")); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if line, err := bufio.NewReader(tc).ReadString('\n'); err != nil || line != "ping\n" {
+			t.Fatalf("echo = %q, %v, want %q", line, err, "ping\n")
+		}
+		tc.Close()
+
+		cancel()
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("serve did not stop")
+		}
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		t.Parallel()
+
+		err := run(context.Background(), []string{"serve", "echo=tls://" + freeAddr(t)}, io.Discard, io.Discard)
+		if err == nil || !strings.HasPrefix(err.Error(), "tls: no certificate") {
+			t.Errorf("run() error = %v, want a missing certificate", err)
+		}
+	})
+}
+
+func TestServe_http(t *testing.T) {
+	t.Parallel()
+
+	addr, httpAddr := freeAddr(t), freeAddr(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- run(ctx, []string{"serve", "-log-level", "warn", "primetime=" + addr + ",http://" + httpAddr}, io.Discard, io.Discard)
+	}()
+
+	// Every listener is up once one of them accepts.
+	conn := dial(t, addr)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(`{"method":"isPrime","number":7}` + "\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != `{"method":"isPrime","prime":true}`+"\n" {
+		t.Fatalf("response over tcp = %q, %v", line, err)
+	}
+	conn.Close()
+
+	resp, err := http.Post("http://"+httpAddr, "application/json", strings.NewReader(`{"method":"isPrime","number":8}`))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || string(body) != `{"method":"isPrime","prime":false}`+"\n" {
+		t.Fatalf("response over http = %d %q, %v", resp.StatusCode, body, err)
+	}
+	http.DefaultClient.CloseIdleConnections()
+
+	cancel()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not stop")
+	}
+}
+
+func TestServe_metricsAddr(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// A busy metrics address fails the command rather than only being
+	// logged.
+	err = run(context.Background(), []string{"serve", "-metrics-addr", ln.Addr().String(), "echo=127.0.0.1:0"}, io.Discard, io.Discard)
+	if err == nil || !strings.HasPrefix(err.Error(), "metrics: ") {
+		t.Errorf("run() error = %v, want a metrics listen error", err)
+	}
+}
+
+func TestServe_proxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	addr := freeAddr(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- run(ctx, []string{"serve", "-log-level", "error", "-proxy-protocol", "echo=" + addr}, io.Discard, io.Discard)
+	}()
+
+	conn := dial(t, addr)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 12345 8080\r\nping\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("echo = %q, %v, want %q", line, err, "ping\n")
+	}
+	conn.Close()
+
+	conn = dial(t, addr)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("ping\n"))
+	if b, err := io.ReadAll(conn); len(b) != 0 || err != nil {
+		t.Errorf("without a header read %q, %v, want the connection closed", b, err)
+	}
+	conn.Close()
+
+	cancel()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not stop")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	insert := func(timestamp, price byte) []byte { return []byte{'I', 0, 0, 0, timestamp, 0, 0, 0, price} }
+	query := []byte{'Q', 0, 0, 0, 0, 0, 0, 0, 10}
+
+	session := func(avg byte) string {
+		records := []capture.Record{
+			{Dir: capture.DirIn, Data: insert(1, 100)},
+			{Dir: capture.DirIn, Data: append(insert(2, 102), query...)},
+			{Dir: capture.DirOut, Data: []byte{0, 0, 0, avg}},
+		}
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.Encode(capture.Header{Network: "tcp"})
+		for _, rec := range records {
+			enc.Encode(rec)
+		}
+		return b.String()
+	}
+
+	dir := t.TempDir()
+	good, bad := filepath.Join(dir, "good.jsonl"), filepath.Join(dir, "bad.jsonl")
+	if err := os.WriteFile(good, []byte(session(101)), 0o600); err != nil {
+		t.Fatalf("failed to write capture: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte(session(100)), 0o600); err != nil {
+		t.Fatalf("failed to write capture: %v", err)
+	}
+
+	var stdout strings.Builder
+	err := run(context.Background(), []string{"replay", "-problem", "means", good, bad}, &stdout, io.Discard)
+	if !errors.Is(err, errMismatch) {
+		t.Errorf("run() error = %v, want %v", err, errMismatch)
+	}
+	want := "ok   " + good + "\nFAIL " + bad + "\nresponse 1:\n\t- \"\\x00\\x00\\x00d\"\n\t+ \"\\x00\\x00\\x00e\"\n"
+	if stdout.String() != want {
+		t.Errorf("replay output:\n%s\nwant:\n%s", stdout.String(), want)
+	}
+
+	err = run(context.Background(), []string{"replay", "-problem", "unusualdb", good}, io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "cannot replay a tcp session against a udp server") {
+		t.Errorf("run() error = %v, want a network mismatch", err)
+	}
+
+	if err := run(context.Background(), []string{"replay", good}, io.Discard, io.Discard); !errors.Is(err, errUsage) {
+		t.Errorf("run() without a server error = %v, want %v", err, errUsage)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	// Without problems, every problem that has scenarios is checked.
+	var stdout strings.Builder
+	if err := run(context.Background(), []string{"check", "-log-level", "error"}, &stdout, io.Discard); err != nil {
+		t.Fatalf("run() error = %v\n%s", err, stdout.String())
+	}
+	for _, name := range check.Problems() {
+		for _, s := range check.Scenarios(name) {
+			if !strings.Contains(stdout.String(), "ok   "+name+"/"+s.Name+" (") {
+				t.Errorf("check output does not report %s/%s as passing:\n%s", name, s.Name, stdout.String())
+			}
+		}
+	}
+
+	// A means server does not echo, so checking it as smoketest fails.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, err := startLocal(ctx, means.Problem, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("startLocal() error = %v", err)
+	}
+
+	stdout.Reset()
+	err = run(context.Background(), []string{"check", "-addr", addr, "-timeout", "100ms", "echo"}, &stdout, io.Discard)
+	if !errors.Is(err, errChecksFailed) {
+		t.Errorf("run() error = %v, want %v", err, errChecksFailed)
+	}
+	if !strings.Contains(stdout.String(), "FAIL smoketest/echo (") || !strings.Contains(stdout.String(), "\tclient: failed to read 13 bytes") {
+		t.Errorf("check output does not report smoketest/echo as failing:\n%s", stdout.String())
+	}
+
+	if err := run(context.Background(), []string{"check", "-addr", addr, "echo", "means"}, io.Discard, io.Discard); !errors.Is(err, errUsage) {
+		t.Errorf("run() with an address and several problems error = %v, want %v", err, errUsage)
+	}
+	if err := run(context.Background(), []string{"check", "speeddaemon"}, io.Discard, io.Discard); err == nil || err.Error() != "problem speeddaemon has no server" {
+		t.Errorf("run() for a problem without a server error = %v", err)
+	}
+}
+
+func TestLoadgen(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"smoketest", "primetime", "means", "budgetchat", "unusualdb", "mobinthemiddle"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout strings.Builder
+			args := []string{"loadgen", "-log-level", "error", "-clients", "3", "-duration", "0", "-requests", "20", "-max-errors", "0", name}
+			if err := run(context.Background(), args, &stdout, io.Discard); err != nil {
+				t.Fatalf("run() error = %v\n%s", err, stdout.String())
+			}
+			if !strings.Contains(stdout.String(), "requests  60 (") {
+				t.Errorf("loadgen did not report 60 requests:\n%s", stdout.String())
+			}
+		})
+	}
+
+	if err := run(context.Background(), []string{"loadgen", "speeddaemon"}, io.Discard, io.Discard); err == nil || !strings.Contains(err.Error(), "give the address of one with -addr") {
+		t.Errorf("run() for a problem without a server error = %v", err)
+	}
+	if err := run(context.Background(), []string{"loadgen", "echo", "means"}, io.Discard, io.Discard); !errors.Is(err, errUsage) {
+		t.Errorf("run() with two problems error = %v, want %v", err, errUsage)
+	}
+}
+
+func TestServe_config(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown top-level setting",
+			config:  "idle-timeout: 5s\n",
+			wantErr: "invalid config: CONFIG: idle-timeout: unknown setting",
+		},
+		{
+			name:    "unknown problem setting",
+			config:  "problems:\n  echo:\n    upstream-addr: localhost:1\n",
+			wantErr: "smoketest: invalid config: CONFIG: problems.smoketest.upstream-addr: unknown setting",
+		},
+		{
+			name:    "invalid value",
+			config:  "problems:\n  echo:\n    max-conns: many\n",
+			wantErr: `smoketest: invalid config: CONFIG: problems.smoketest.max-conns: invalid value "many": parse error`,
+		},
+		{
+			name:    "invalid problem setting",
+			config:  "problems:\n  5:\n    upstream-addr: localhost:1\n    tony-address: tony\n",
+			wantErr: `mobinthemiddle: invalid Boguscoin address "tony"`,
+		},
+		{
+			name:    "invalid log level",
+			config:  "problems:\n  echo:\n    log-level: loud\n",
+			wantErr: `smoketest: invalid config: CONFIG: problems.smoketest: invalid log level "loud"`,
+		},
+		{
+			name:    "malformed file",
+			config:  "problems: [\n",
+			wantErr: "invalid config: CONFIG: yaml: line 1: did not find expected node content",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			args := append([]string{"serve", "-config", path, "-addr", "127.0.0.1:0"}, tt.args...)
+			err := run(context.Background(), args, io.Discard, io.Discard)
+			if want := strings.ReplaceAll(tt.wantErr, "CONFIG", path); err == nil || err.Error() != want {
+				t.Errorf("run() error = %v, want %q", err, want)
+			}
+		})
+	}
+}
+
+// freeAddr returns a loopback address that was free a moment ago.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// dialNetwork connects to addr on network without retrying.
+func dialNetwork(t *testing.T, network, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return conn
+}
+
+// dial connects to addr, retrying while the server starts.
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed to dial %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
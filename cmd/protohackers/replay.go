@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+
+	budgetchat "github.com/sklyar/protohackers/03"
+	mobinthemiddle "github.com/sklyar/protohackers/05"
+	"github.com/sklyar/protohackers/internal/capture"
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/problem"
+)
+
+// errMismatch is returned when a replayed session does not match its
+// capture.
+var errMismatch = errors.New("replayed sessions did not match their captures")
+
+func replay(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: protohackers replay [flags] <capture>...\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", "", "address of a running server to replay against")
+	name := fs.String("problem", "", "problem to start a local server for and replay against")
+	timeout := fs.Duration("timeout", capture.DefaultReplayTimeout, "how long to wait for each recorded response")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(fs)
+	options := registerProblemFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+	if err := setFromEnv(fs); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 || (*addr == "") == (*name == "") {
+		fmt.Fprint(stderr, "protohackers: replay needs captures and exactly one of -addr and -problem\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	logger, err := logOpts.New(stderr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	network := ""
+	if *name != "" {
+		p, ok := problem.Lookup(problems, *name)
+		if !ok {
+			return fmt.Errorf("unknown problem %q", *name)
+		}
+		if *addr, err = startLocal(ctx, p, options[p.Number], logger.With(slog.Int("problem", p.Number))); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		network = p.Network()
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		s, err := capture.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if network != "" && s.Network != network {
+			return fmt.Errorf("%s: cannot replay a %s session against a %s server", path, s.Network, network)
+		}
+
+		res, err := capture.Replay(ctx, s, *addr, *timeout)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if diff := res.Diff(); diff != "" {
+			failed = true
+			fmt.Fprintf(stdout, "FAIL %s\n%s", path, diff)
+			continue
+		}
+		fmt.Fprintf(stdout, "ok   %s\n", path)
+	}
+
+	if failed {
+		return errMismatch
+	}
+	return nil
+}
+
+// startLocal starts a server for p with opts on a loopback port that runs
+// until ctx is done, and returns its address.
+func startLocal(ctx context.Context, p problem.Problem, opts problem.Options, logger *slog.Logger) (addr string, err error) {
+	ctx = logging.NewContext(ctx, logger)
+
+	// As in serve, work the problem runs in the background outlives ctx,
+	// so that it keeps going while the server drains, and stops once the
+	// server has returned.
+	bgCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+
+	switch p.Network() {
+	case problem.NetworkTCP:
+		srv, err := p.NewServer(bgCtx, opts)
+		if err != nil {
+			return "", err
+		}
+		srv.Logger = logger
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", err
+		}
+		go func() {
+			defer stop()
+			if err := srv.Serve(ctx, ln); err != nil {
+				logger.Error("failed to serve", slog.Any("err", err))
+			}
+		}()
+		return ln.Addr().String(), nil
+
+	case problem.NetworkUDP:
+		srv, err := p.NewPacketServer(bgCtx, opts)
+		if err != nil {
+			return "", err
+		}
+		srv.Logger = logger
+
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return "", err
+		}
+		go func() {
+			defer stop()
+			if err := srv.Serve(ctx, pc); err != nil {
+				logger.Error("failed to serve", slog.Any("err", err))
+			}
+		}()
+		return pc.LocalAddr().String(), nil
+
+	default:
+		return "", errors.New("no server")
+	}
+}
+
+// startLocalServer is startLocal for problems whose options, by number,
+// are returned by registerProblemFlags. A proxy that was not given an
+// upstream gets a local budgetchat server to relay to.
+func startLocalServer(ctx context.Context, p problem.Problem, options map[int]problem.Options, logger *slog.Logger) (string, error) {
+	if o, ok := options[p.Number].(*mobinthemiddle.Options); ok && o.UpstreamAddr == "" {
+		upstream, err := startLocal(ctx, budgetchat.Problem, options[budgetchat.Problem.Number], logger.With(slog.Int("problem", budgetchat.Problem.Number)))
+		if err != nil {
+			return "", fmt.Errorf("failed to start the upstream server: %w", err)
+		}
+		o.UpstreamAddr = upstream
+	}
+	return startLocal(ctx, p, options[p.Number], logger.With(slog.Int("problem", p.Number)))
+}
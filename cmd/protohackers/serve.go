@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sklyar/protohackers/internal/capture"
+	"github.com/sklyar/protohackers/internal/config"
+	"github.com/sklyar/protohackers/internal/logging"
+	"github.com/sklyar/protohackers/internal/metrics"
+	"github.com/sklyar/protohackers/internal/problem"
+	"github.com/sklyar/protohackers/internal/proxyproto"
+	"github.com/sklyar/protohackers/internal/server"
+	"github.com/sklyar/protohackers/internal/tlsconfig"
+)
+
+const defaultAddr = ":8080"
+
+// globalFlags are the flags that apply to the whole process rather than to
+// a single problem. Only they may be set at the top level of a config file.
+var globalFlags = []string{
+	"metrics-addr", "capture-dir", "log-format", "log-level",
+	"tls-cert", "tls-key", "tls-self-signed-ca", "tls-client-ca",
+	"proxy-protocol",
+}
+
+// networkTLS is the network of listeners that accept TLS over TCP.
+const networkTLS = "tls"
+
+// A target is a problem to serve and the addresses to serve it on.
+type target struct {
+	problem problem.Problem
+
+	// addr is the address as given, and listeners the addresses it
+	// lists.
+	addr      string
+	listeners []listenAddr
+
+	// settings are the problem settings from the config file, keyed by
+	// flag name.
+	settings map[string]string
+}
+
+// An instance is a target ready to be served.
+type instance struct {
+	target
+	serve func(ctx context.Context) error
+	close func()
+}
+
+func serve(ctx context.Context, args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: protohackers serve [flags] [<problem>[=<addr>]...]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	configPath := fs.String("config", "", "YAML file to read settings from; without problem arguments, every problem it configures is served")
+	addr := fs.String("addr", defaultAddr, "address to listen on when serving a single problem; a comma-separated list listens on each, and a udp://, unix://, tls:// or http:// prefix picks the network")
+	metricsAddr := fs.String("metrics-addr", "", "address to serve Prometheus metrics on (disabled if empty)")
+	fs.Bool("proxy-protocol", false, "require a PROXY protocol v1 or v2 header from every TCP, Unix socket, TLS and HTTP connection, and take the client address from it")
+	fs.String("capture-dir", "", "directory to record the traffic of every session to, in a subdirectory per problem (disabled if empty)")
+	var logOpts logging.Options
+	logOpts.RegisterFlags(fs)
+	var tlsOpts tlsconfig.Options
+	tlsOpts.RegisterFlags(fs)
+	// The server flags override the defaults of every TCP problem; their
+	// own defaults are only shown in the usage message.
+	var defaults server.Server
+	defaults.RegisterFlags(fs)
+	// Likewise, every server gets options of its own, which start from
+	// the values of the problem flags.
+	registerProblemFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+	if err := setFromEnv(fs); err != nil {
+		return err
+	}
+
+	// Flags given on the command line or through the environment take
+	// precedence over the config file.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	skip := func(name string) bool { return explicit[name] }
+
+	cfg := &config.Config{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if err := config.Apply(subset(fs, globalFlags), cfg.Settings, skip, *configPath+": "); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	targets, err := parseTargets(fs.Args(), cfg, *addr, explicit["addr"])
+	if err != nil {
+		fmt.Fprintf(stderr, "protohackers: %s\n", err)
+		fs.Usage()
+		return errUsage
+	}
+
+	logger, err := logOpts.New(stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	var tlsConfig *tls.Config
+	if hasTLSListener(targets) {
+		if tlsConfig, err = tlsOpts.Config(); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Every server is set up before any of them starts, so that a bad
+	// setting or a busy address fails the command at startup.
+	instances := make([]instance, 0, len(targets))
+	defer func() {
+		for _, inst := range instances {
+			inst.close()
+		}
+	}()
+	for _, t := range targets {
+		inst, err := prepare(ctx, t, fs, skip, stderr, *configPath, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.problem.Name, err)
+		}
+		instances = append(instances, inst)
+	}
+
+	if *metricsAddr != "" {
+		ln, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			return fmt.Errorf("metrics: %w", err)
+		}
+		go func() {
+			if err := metrics.Serve(ctx, ln); err != nil {
+				logger.Error("failed to serve metrics", slog.Any("err", err))
+			}
+		}()
+	}
+
+	// A server stopping with an error brings the others down with it.
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, inst := range instances {
+		wg.Add(1)
+		go func(inst instance) {
+			defer wg.Done()
+
+			if err := inst.serve(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", inst.problem.Name, err))
+				mu.Unlock()
+				cancel()
+			}
+		}(inst)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// prepare sets up the server of t and starts listening. Settings are
+// applied in increasing order of precedence: the problem defaults, the
+// config file, then the flags in fs given on the command line or through
+// the environment. Listeners on networkTLS accept TLS with tlsConfig.
+func prepare(ctx context.Context, t target, fs *flag.FlagSet, skip func(string) bool, stderr io.Writer, configPath string, tlsConfig *tls.Config) (inst instance, err error) {
+	section := fmt.Sprintf("%s: problems.%s", configPath, t.problem.Name)
+	prefix := section + "."
+
+	// The log flags start from the process-wide values, which the
+	// problem settings may then refine.
+	var logOpts logging.Options
+	logFlags := flag.NewFlagSet("", flag.ContinueOnError)
+	logOpts.RegisterFlags(logFlags)
+	logFlags.VisitAll(func(f *flag.Flag) {
+		_ = logFlags.Set(f.Name, fs.Lookup(f.Name).Value.String())
+	})
+
+	// So do the problem options, which the server gets a value of its
+	// own of.
+	opts := t.problem.Options()
+	problemFlags := flag.NewFlagSet("", flag.ContinueOnError)
+	if opts != nil {
+		opts.RegisterFlags(problemFlags)
+	}
+	problemFlags.VisitAll(func(f *flag.Flag) {
+		_ = problemFlags.Set(f.Name, fs.Lookup(f.Name).Value.String())
+	})
+
+	var serverNames server.Server
+	serverFlags := flag.NewFlagSet("", flag.ContinueOnError)
+	if t.problem.NewServer != nil {
+		serverNames.RegisterFlags(serverFlags)
+	}
+
+	logSettings, problemSettings, serverSettings := map[string]string{}, map[string]string{}, map[string]string{}
+	for name, value := range t.settings {
+		switch {
+		case logFlags.Lookup(name) != nil:
+			logSettings[name] = value
+		case problemFlags.Lookup(name) != nil:
+			problemSettings[name] = value
+		case serverFlags.Lookup(name) != nil:
+			serverSettings[name] = value
+		default:
+			return instance{}, fmt.Errorf("invalid config: %s%s: unknown setting", prefix, name)
+		}
+	}
+	if err := config.Apply(logFlags, logSettings, skip, prefix); err != nil {
+		return instance{}, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.Apply(problemFlags, problemSettings, skip, prefix); err != nil {
+		return instance{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	logger, err := logOpts.New(stderr)
+	if err != nil {
+		return instance{}, fmt.Errorf("invalid config: %s: %w", section, err)
+	}
+	logger = logger.With(slog.Int("problem", t.problem.Number))
+
+	var recorder *capture.Recorder
+	if dir := fs.Lookup("capture-dir").Value.String(); dir != "" {
+		recorder = &capture.Recorder{Dir: filepath.Join(dir, t.problem.Name), Logger: logger}
+	}
+
+	// Work the problem runs in the background outlives ctx, so that it
+	// keeps going while the server drains, and stops once it is closed.
+	bgCtx, stop := context.WithCancel(logging.NewContext(context.WithoutCancel(ctx), logger))
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+
+	var (
+		srv         *server.Server
+		packetSrv   *server.PacketServer
+		httpHandler http.Handler
+		serves      []func(ctx context.Context) error
+		closers     []io.Closer
+	)
+	defer func() {
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+		}
+	}()
+	for _, l := range t.listeners {
+		switch l.network {
+		case problem.NetworkTCP, problem.NetworkUnix, networkTLS, problem.NetworkHTTP:
+			// Stream listeners share a server, and with it the
+			// connection limits. HTTP listeners serve a gateway to it.
+			if srv == nil {
+				if srv, err = t.problem.NewServer(bgCtx, opts); err != nil {
+					return instance{}, err
+				}
+				overrides := flag.NewFlagSet("", flag.ContinueOnError)
+				srv.RegisterFlags(overrides)
+				if err := config.Apply(overrides, serverSettings, skip, prefix); err != nil {
+					return instance{}, fmt.Errorf("invalid config: %w", err)
+				}
+				if err := applyServerFlags(srv, fs); err != nil {
+					return instance{}, err
+				}
+				srv.Logger = logger
+			}
+
+			if l.network == problem.NetworkHTTP && httpHandler == nil {
+				if httpHandler, err = t.problem.NewHTTPHandler(srv); err != nil {
+					return instance{}, err
+				}
+			}
+
+			network := l.network
+			if network == networkTLS || network == problem.NetworkHTTP {
+				network = problem.NetworkTCP
+			}
+			ln, err := net.Listen(network, l.addr)
+			if err != nil {
+				return instance{}, err
+			}
+			closers = append(closers, ln)
+			if fs.Lookup("proxy-protocol").Value.String() == "true" {
+				ln = proxyproto.Listener(ln, 0, srv.MaxConns, logger)
+				closers = append(closers, ln)
+			}
+			// The recorder wraps TLS, so that captures hold the
+			// plaintext and replay against plain listeners.
+			if l.network == networkTLS {
+				ln = tls.NewListener(ln, tlsConfig)
+			}
+			// HTTP is not recorded: its captures would not replay
+			// against the problem protocol.
+			if recorder != nil && l.network != problem.NetworkHTTP {
+				ln = recorder.Listener(ln)
+			}
+			logger.Info("listening", slog.String("network", l.network), slog.String("addr", ln.Addr().String()))
+
+			srv := srv
+			if l.network == problem.NetworkHTTP {
+				h := httpHandler
+				serves = append(serves, func(ctx context.Context) error { return srv.ServeHTTPHandler(ctx, ln, h) })
+				break
+			}
+			serves = append(serves, func(ctx context.Context) error { return srv.Serve(ctx, ln) })
+
+		case problem.NetworkUDP:
+			if packetSrv == nil {
+				if packetSrv, err = t.problem.NewPacketServer(bgCtx, opts); err != nil {
+					return instance{}, err
+				}
+				packetSrv.Logger = logger
+			}
+
+			pc, err := net.ListenPacket(l.network, l.addr)
+			if err != nil {
+				return instance{}, err
+			}
+			closers = append(closers, pc)
+			if recorder != nil {
+				pc = recorder.PacketConn(pc)
+			}
+			logger.Info("listening", slog.String("network", l.network), slog.String("addr", pc.LocalAddr().String()))
+
+			srv := packetSrv
+			serves = append(serves, func(ctx context.Context) error { return srv.Serve(ctx, pc) })
+		}
+	}
+	if len(serves) == 0 {
+		return instance{}, errors.New("no server")
+	}
+
+	return instance{
+		target: t,
+		serve:  func(ctx context.Context) error { return serveAll(ctx, serves) },
+		close: func() {
+			for _, c := range closers {
+				c.Close()
+			}
+			stop()
+		},
+	}, nil
+}
+
+// serveAll runs every serve function until they have all returned. One of
+// them failing stops the others.
+func serveAll(ctx context.Context, serves []func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(serves))
+	var wg sync.WaitGroup
+	for i, serve := range serves {
+		wg.Add(1)
+		go func(i int, serve func(ctx context.Context) error) {
+			defer wg.Done()
+
+			if errs[i] = serve(ctx); errs[i] != nil {
+				cancel()
+			}
+		}(i, serve)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// A listenAddr is an address to listen on and the network it is on.
+type listenAddr struct {
+	network string
+	addr    string
+}
+
+// parseListenAddrs parses a comma-separated list of addresses to serve p
+// on. Each address may name its network as in "udp://:7000" or
+// "unix:///run/echo.sock"; those that do not are on the network p is
+// served over by default. "tls://:7443" accepts TLS over TCP, and
+// "http://:8081" serves the HTTP gateway of problems that have one.
+func parseListenAddrs(p problem.Problem, s string) ([]listenAddr, error) {
+	var addrs []listenAddr
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		network, addr, ok := strings.Cut(field, "://")
+		if !ok {
+			network, addr = p.Network(), field
+		}
+		switch {
+		case addr == "":
+			return nil, fmt.Errorf("empty address for problem %s", p)
+		case network != problem.NetworkTCP && network != problem.NetworkUDP && network != problem.NetworkUnix && network != networkTLS && network != problem.NetworkHTTP:
+			return nil, fmt.Errorf("unknown network %q for problem %s", network, p)
+		case network == networkTLS && !p.Serves(problem.NetworkTCP):
+			return nil, fmt.Errorf("problem %s cannot be served over tls", p)
+		case network != networkTLS && !p.Serves(network):
+			return nil, fmt.Errorf("problem %s cannot be served over %s", p, network)
+		}
+		addrs = append(addrs, listenAddr{network: network, addr: addr})
+	}
+	return addrs, nil
+}
+
+// applyServerFlags overrides the settings of srv with the server flags set
+// in fs, either on the command line or from the environment.
+func applyServerFlags(srv *server.Server, fs *flag.FlagSet) error {
+	overrides := flag.NewFlagSet("", flag.ContinueOnError)
+	srv.RegisterFlags(overrides)
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil && overrides.Lookup(f.Name) != nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	return err
+}
+
+// parseTargets parses the <problem>[=<addr>] arguments of serve. Without
+// arguments, the problems configured in cfg are served. The address may
+// list several, see parseListenAddrs.
+//
+// A problem without an address in its argument is served on addr if it is
+// the only one and addrSet reports that addr was given explicitly, then on
+// the address from cfg, and finally on addr if it is the only one.
+func parseTargets(args []string, cfg *config.Config, addr string, addrSet bool) ([]target, error) {
+	sections := make(map[int]map[string]string, len(cfg.Problems))
+	for key, settings := range cfg.Problems {
+		p, ok := problem.Lookup(problems, key)
+		if !ok {
+			return nil, fmt.Errorf("config: unknown problem %q", key)
+		}
+		if _, ok := sections[p.Number]; ok {
+			return nil, fmt.Errorf("config: problem %s is configured more than once", p)
+		}
+		if settings == nil {
+			settings = map[string]string{}
+		}
+		sections[p.Number] = settings
+	}
+
+	if len(args) == 0 {
+		for n := range sections {
+			args = append(args, strconv.Itoa(n))
+		}
+		sort.Slice(args, func(i, j int) bool {
+			a, _ := strconv.Atoi(args[i])
+			b, _ := strconv.Atoi(args[j])
+			return a < b
+		})
+	}
+	if len(args) == 0 {
+		return nil, errors.New("no problem to serve")
+	}
+
+	targets := make([]target, 0, len(args))
+	for _, arg := range args {
+		name, targetAddr, hasAddr := strings.Cut(arg, "=")
+
+		p, ok := problem.Lookup(problems, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown problem %q", name)
+		}
+		if p.Network() == "" {
+			return nil, fmt.Errorf("problem %s has no server", p)
+		}
+
+		settings := make(map[string]string, len(sections[p.Number]))
+		for k, v := range sections[p.Number] {
+			settings[k] = v
+		}
+		cfgAddr := settings["addr"]
+		delete(settings, "addr")
+
+		single := len(args) == 1
+		switch {
+		case hasAddr && targetAddr == "":
+			return nil, fmt.Errorf("empty address for problem %s", p)
+		case hasAddr:
+		case single && addrSet:
+			targetAddr = addr
+		case cfgAddr != "":
+			targetAddr = cfgAddr
+		case single:
+			targetAddr = addr
+		default:
+			return nil, fmt.Errorf("problem %s needs an address when serving several problems", p)
+		}
+
+		listeners, err := parseListenAddrs(p, targetAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, target{problem: p, addr: targetAddr, listeners: listeners, settings: settings})
+	}
+	return targets, nil
+}
+
+// hasTLSListener reports whether any of targets listens on networkTLS.
+func hasTLSListener(targets []target) bool {
+	for _, t := range targets {
+		for _, l := range t.listeners {
+			if l.network == networkTLS {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subset returns a flag set sharing the named flags of fs.
+func subset(fs *flag.FlagSet, names []string) *flag.FlagSet {
+	sub := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		sub.Var(f.Value, f.Name, f.Usage)
+	}
+	return sub
+}
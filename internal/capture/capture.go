@@ -0,0 +1,316 @@
+// Package capture records the bytes exchanged over connections so that
+// sessions can be inspected and replayed later.
+//
+// A capture is a file of JSON lines. The first line is a Header describing
+// the session; every following line is a Record of the bytes read from or
+// written to the peer.
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Directions of recorded bytes, from the point of view of the server.
+const (
+	// DirIn marks bytes received from the peer.
+	DirIn = "in"
+	// DirOut marks bytes sent to the peer.
+	DirOut = "out"
+)
+
+// Header describes a captured session.
+type Header struct {
+	Network    string    `json:"network"`
+	LocalAddr  string    `json:"local_addr"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Start      time.Time `json:"start"`
+}
+
+// Record is a chunk of bytes exchanged with a peer.
+type Record struct {
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`
+	// Peer is the address of the peer for packet captures, which hold the
+	// datagrams of every peer.
+	Peer string `json:"peer,omitempty"`
+	Data []byte `json:"data"`
+}
+
+// Session is a captured session read back from a file.
+type Session struct {
+	Header
+	Records []Record
+}
+
+// ReadFile reads the capture at path.
+func ReadFile(path string) (*Session, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Read reads a capture from r.
+func Read(r io.Reader) (*Session, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var s Session
+	if err := dec.Decode(&s.Header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing header")
+		}
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return &s, nil
+			}
+			return nil, fmt.Errorf("invalid record %d: %w", len(s.Records)+1, err)
+		}
+		if rec.Dir != DirIn && rec.Dir != DirOut {
+			return nil, fmt.Errorf("invalid record %d: unknown direction %q", len(s.Records)+1, rec.Dir)
+		}
+		s.Records = append(s.Records, rec)
+	}
+}
+
+// A Recorder writes captures to files in a directory, one per connection
+// accepted from a listener or one per packet connection.
+type Recorder struct {
+	// Dir is the directory captures are written to. It is created if it
+	// does not exist.
+	Dir string
+
+	// Logger logs capture failures. If nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	seq atomic.Uint64
+}
+
+// Listener returns a listener whose accepted connections are captured.
+func (r *Recorder) Listener(ln net.Listener) net.Listener {
+	return &listener{Listener: ln, r: r}
+}
+
+// PacketConn returns a packet connection whose datagrams are captured.
+// Capture failures leave pc working, uncaptured.
+func (r *Recorder) PacketConn(pc net.PacketConn) net.PacketConn {
+	w, err := r.create(Header{
+		Network:   pc.LocalAddr().Network(),
+		LocalAddr: pc.LocalAddr().String(),
+		Start:     time.Now(),
+	})
+	if err != nil {
+		r.logger().Error("failed to start capture", slog.Any("err", err))
+		return pc
+	}
+	return &packetConn{PacketConn: pc, w: w}
+}
+
+// Conn returns conn with its traffic captured. The capture file is only
+// created once conn exchanges its first bytes, so connections closed
+// before that, such as those refused by a server, leave none. Capture
+// failures leave conn working, uncaptured.
+func (r *Recorder) Conn(conn net.Conn) net.Conn {
+	return &captureConn{
+		Conn: conn,
+		r:    r,
+		h: Header{
+			Network:    conn.LocalAddr().Network(),
+			LocalAddr:  conn.LocalAddr().String(),
+			RemoteAddr: conn.RemoteAddr().String(),
+			Start:      time.Now(),
+		},
+	}
+}
+
+func (r *Recorder) create(h Header) (*writer, error) {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s-%06d.jsonl", h.Start.UTC().Format("20060102T150405.000"), h.Network, r.seq.Add(1))
+	path := filepath.Join(r.Dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &writer{f: f, enc: json.NewEncoder(f), logger: r.logger().With(slog.String("capture", path))}
+	if err := w.enc.Encode(h); err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.logger.Debug("capturing session", slog.String("remote_addr", h.RemoteAddr))
+	return w, nil
+}
+
+func (r *Recorder) logger() *slog.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return slog.Default()
+}
+
+// writer appends records to a capture file. The first failure to write is
+// logged and ends the capture.
+type writer struct {
+	mu     sync.Mutex
+	f      *os.File
+	enc    *json.Encoder
+	logger *slog.Logger
+	failed bool
+}
+
+func (w *writer) record(dir string, peer net.Addr, b []byte) {
+	rec := Record{Time: time.Now(), Dir: dir, Data: b}
+	if peer != nil {
+		rec.Peer = peer.String()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failed {
+		return
+	}
+	if err := w.enc.Encode(rec); err != nil {
+		w.failed = true
+		w.logger.Error("failed to write capture", slog.Any("err", err))
+	}
+}
+
+func (w *writer) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.f.Close(); err != nil && !w.failed {
+		w.logger.Error("failed to close capture", slog.Any("err", err))
+	}
+	w.failed = true
+}
+
+type listener struct {
+	net.Listener
+	r *Recorder
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.r.Conn(conn), nil
+}
+
+type captureConn struct {
+	net.Conn
+	r *Recorder
+	h Header
+
+	mu      sync.Mutex
+	w       *writer // nil until started, or if the capture failed
+	started bool
+	closed  bool
+}
+
+// record appends b to the capture, creating it on the first call.
+func (c *captureConn) record(dir string, b []byte) {
+	c.mu.Lock()
+	if !c.started && !c.closed {
+		c.started = true
+		w, err := c.r.create(c.h)
+		if err != nil {
+			c.r.logger().Error("failed to start capture", slog.Any("err", err), slog.String("remote_addr", c.h.RemoteAddr))
+		}
+		c.w = w
+	}
+	w := c.w
+	c.mu.Unlock()
+
+	if w != nil {
+		w.record(dir, nil, b)
+	}
+}
+
+func (c *captureConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(DirIn, b[:n])
+	}
+	return n, err
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.record(DirOut, b[:n])
+	}
+	return n, err
+}
+
+func (c *captureConn) Close() error {
+	err := c.Conn.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed && c.w != nil {
+		c.w.close()
+	}
+	c.closed = true
+	return err
+}
+
+// NetConn returns the captured connection.
+func (c *captureConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+type packetConn struct {
+	net.PacketConn
+	w *writer
+
+	closeOnce sync.Once
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	if err == nil {
+		c.w.record(DirIn, addr, b[:n])
+	}
+	return n, addr, err
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	if err == nil {
+		c.w.record(DirOut, addr, b[:n])
+	}
+	return n, err
+}
+
+func (c *packetConn) Close() error {
+	err := c.PacketConn.Close()
+	c.closeOnce.Do(c.w.close)
+	return err
+}
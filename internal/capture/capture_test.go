@@ -0,0 +1,347 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestRecorder_Listener(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r := &Recorder{Dir: dir, Logger: discardLogger}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ln = r.Listener(ln)
+	defer ln.Close()
+	done := serveStream(ln, bytes.ToUpper)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	exchange(t, conn, "hello\n", "HELLO\n")
+	exchange(t, conn, "again\n", "AGAIN\n")
+	conn.Close()
+	<-done
+
+	s := readOnly(t, dir)
+	if s.Network != "tcp" || s.LocalAddr != ln.Addr().String() || s.RemoteAddr != conn.LocalAddr().String() {
+		t.Errorf("header = %+v, want a tcp session from %s to %s", s.Header, conn.LocalAddr(), ln.Addr())
+	}
+	want := []string{"in hello\n", "out HELLO\n", "in again\n", "out AGAIN\n"}
+	if got := records(s); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	for _, rec := range s.Records {
+		if rec.Time.Before(s.Start) {
+			t.Errorf("record at %v precedes the session start %v", rec.Time, s.Start)
+		}
+	}
+}
+
+func TestRecorder_Conn_silent(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r := &Recorder{Dir: dir, Logger: discardLogger}
+
+	// A connection closed before exchanging any bytes, as servers do with
+	// the connections they refuse, leaves no capture behind.
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := r.Conn(server)
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read capture dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("capture dir holds %d files, want none", len(entries))
+	}
+}
+
+func TestRecorder_PacketConn(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r := &Recorder{Dir: dir, Logger: discardLogger}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	pc = r.PacketConn(pc)
+	go servePackets(pc, bytes.ToUpper)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	exchange(t, conn, "hello", "HELLO")
+	pc.Close()
+
+	s := readOnly(t, dir)
+	if s.Network != "udp" || s.RemoteAddr != "" {
+		t.Errorf("header = %+v, want a udp session without a remote address", s.Header)
+	}
+	want := []string{"in hello", "out HELLO"}
+	if got := records(s); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	for _, rec := range s.Records {
+		if rec.Peer != conn.LocalAddr().String() {
+			t.Errorf("record peer = %q, want %q", rec.Peer, conn.LocalAddr())
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{name: "empty", in: "", wantErr: "missing header"},
+		{name: "bad header", in: "nope\n", wantErr: "invalid header"},
+		{name: "bad record", in: `{"network":"tcp"}` + "\n" + `{"dir":"sideways","data":""}`, wantErr: `invalid record 1: unknown direction "sideways"`},
+		{name: "header only", in: `{"network":"tcp"}`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Read(strings.NewReader(tt.in))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("Read() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	stream := &Session{
+		Header: Header{Network: "tcp"},
+		Records: []Record{
+			{Dir: DirIn, Data: []byte("hel")},
+			{Dir: DirIn, Data: []byte("lo\n")},
+			{Dir: DirOut, Data: []byte("hello\n")},
+			{Dir: DirIn, Data: []byte("bye\n")},
+			{Dir: DirOut, Data: []byte("bye\n")},
+		},
+	}
+	unixStream := &Session{Header: Header{Network: "unix"}, Records: stream.Records}
+	packets := &Session{
+		Header: Header{Network: "udp"},
+		Records: []Record{
+			{Dir: DirIn, Peer: "a", Data: []byte("one")},
+			{Dir: DirOut, Peer: "a", Data: []byte("one")},
+			{Dir: DirIn, Peer: "b", Data: []byte("two")},
+			{Dir: DirOut, Peer: "b", Data: []byte("two")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		session  *Session
+		reply    func([]byte) []byte
+		wantDiff string
+	}{
+		{
+			name:    "stream match",
+			session: stream,
+			reply:   func(b []byte) []byte { return b },
+		},
+		{
+			name:     "stream mismatch",
+			session:  stream,
+			reply:    bytes.ToUpper,
+			wantDiff: "response 1:\n\t- \"hello\\n\"\n\t+ \"HELLO\\n\"\nresponse 2:\n\t- \"bye\\n\"\n\t+ \"BYE\\n\"\n",
+		},
+		{
+			name:     "stream extra response",
+			session:  stream,
+			reply:    func(b []byte) []byte { return append(b, '!') },
+			wantDiff: "response 2:\n\t- \"bye\\n\"\n\t+ \"!bye\"\nresponse 3:\n\t+ \"\\n!\"\n",
+		},
+		{
+			name:    "unix stream match",
+			session: unixStream,
+			reply:   func(b []byte) []byte { return b },
+		},
+		{
+			name:    "packet match",
+			session: packets,
+			reply:   func(b []byte) []byte { return b },
+		},
+		{
+			name:     "packet mismatch",
+			session:  packets,
+			reply:    bytes.ToUpper,
+			wantDiff: "peer a response 1:\n\t- \"one\"\n\t+ \"ONE\"\npeer b response 1:\n\t- \"two\"\n\t+ \"TWO\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var addr string
+			switch tt.session.Network {
+			case "tcp":
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				defer ln.Close()
+				serveStream(ln, tt.reply)
+				addr = ln.Addr().String()
+			case "unix":
+				addr = filepath.Join(t.TempDir(), "replay.sock")
+				ln, err := net.Listen("unix", addr)
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				defer ln.Close()
+				serveStream(ln, tt.reply)
+			default:
+				pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				defer pc.Close()
+				go servePackets(pc, tt.reply)
+				addr = pc.LocalAddr().String()
+			}
+
+			res, err := Replay(context.Background(), tt.session, addr, 200*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+			if got := res.Diff(); got != tt.wantDiff {
+				t.Errorf("Diff() = %q, want %q", got, tt.wantDiff)
+			}
+			if res.OK() != (tt.wantDiff == "") {
+				t.Errorf("OK() = %v, want %v", res.OK(), tt.wantDiff == "")
+			}
+		})
+	}
+}
+
+// serveStream answers every line of every connection accepted from ln
+// with reply applied to it, until ln is closed. The returned channel is
+// closed once a connection is over.
+func serveStream(ln net.Listener, reply func([]byte) []byte) <-chan struct{} {
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer once.Do(func() { close(done) })
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					conn.Write(reply(line))
+				}
+			}()
+		}
+	}()
+	return done
+}
+
+// servePackets answers every datagram read from pc with reply applied to
+// it, until pc is closed.
+func servePackets(pc net.PacketConn, reply func([]byte) []byte) {
+	b := make([]byte, 1024)
+	for {
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		pc.WriteTo(reply(b[:n]), addr)
+	}
+}
+
+func exchange(t *testing.T, conn net.Conn, send, want string) {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(send)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	b := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+}
+
+// readOnly reads the only capture in dir.
+func readOnly(t *testing.T, dir string) *Session {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d captures, want 1", len(entries))
+	}
+
+	s, err := ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return s
+}
+
+func records(s *Session) []string {
+	var recs []string
+	for _, rec := range s.Records {
+		recs = append(recs, rec.Dir+" "+string(rec.Data))
+	}
+	return recs
+}
@@ -0,0 +1,299 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultReplayTimeout is how long Replay waits for each expected response.
+const DefaultReplayTimeout = time.Second
+
+// maxDiffs is the number of mismatches described by Result.Diff.
+const maxDiffs = 10
+
+// Stream is what one peer of a replayed session expected and received.
+type Stream struct {
+	// Peer is the address the peer had when the session was captured.
+	Peer string
+
+	// Want holds the responses in the capture, one per recorded chunk.
+	Want [][]byte
+
+	// Got holds the responses received during the replay. Stream
+	// responses are split at the boundaries of the recorded chunks, so
+	// that they line up with Want.
+	Got [][]byte
+}
+
+// Result is the outcome of a replay.
+type Result struct {
+	Streams []Stream
+}
+
+// OK reports whether every response matched the capture.
+func (r *Result) OK() bool {
+	return r.Diff() == ""
+}
+
+// Diff describes the responses that did not match the capture, or returns
+// an empty string if they all did.
+func (r *Result) Diff() string {
+	var b strings.Builder
+	n := 0
+	for _, s := range r.Streams {
+		for i := 0; i < len(s.Want) || i < len(s.Got); i++ {
+			var want, got []byte
+			if i < len(s.Want) {
+				want = s.Want[i]
+			}
+			if i < len(s.Got) {
+				got = s.Got[i]
+			}
+			if i < len(s.Want) && i < len(s.Got) && bytes.Equal(want, got) {
+				continue
+			}
+
+			if n++; n > maxDiffs {
+				b.WriteString("...\n")
+				return b.String()
+			}
+			if len(r.Streams) > 1 {
+				fmt.Fprintf(&b, "peer %s ", s.Peer)
+			}
+			fmt.Fprintf(&b, "response %d:\n", i+1)
+			if i < len(s.Want) {
+				fmt.Fprintf(&b, "\t- %q\n", want)
+			}
+			if i < len(s.Got) {
+				fmt.Fprintf(&b, "\t+ %q\n", got)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Replay re-drives the peers of s against the server at addr: it sends
+// what they sent, waiting up to timeout for each recorded response before
+// moving on, and collects what the server answers. Sessions captured on a
+// Unix socket are replayed against the socket at path addr.
+func Replay(ctx context.Context, s *Session, addr string, timeout time.Duration) (*Result, error) {
+	if timeout <= 0 {
+		timeout = DefaultReplayTimeout
+	}
+
+	switch s.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		stream, err := replayStream(ctx, s, addr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Streams: []Stream{stream}}, nil
+	case "udp", "udp4", "udp6":
+		return replayPackets(ctx, s, addr, timeout)
+	default:
+		return nil, fmt.Errorf("cannot replay %s sessions", s.Network)
+	}
+}
+
+func replayStream(ctx context.Context, s *Session, addr string, timeout time.Duration) (Stream, error) {
+	network := "tcp"
+	if s.Network == "unix" {
+		network = "unix"
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	chunks := make(chan []byte)
+	go readChunks(conn, chunks)
+	defer func() {
+		conn.Close()
+		for range chunks {
+		}
+	}()
+
+	stream := Stream{Peer: s.RemoteAddr}
+	var (
+		got      []byte
+		expected int
+	)
+	// receive collects responses until n bytes arrived, the server closed
+	// the connection or the timeout expired.
+	receive := func(n int, timeout time.Duration) error {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		for len(got) < n {
+			select {
+			case b, ok := <-chunks:
+				if !ok {
+					return nil
+				}
+				got = append(got, b...)
+			case <-timer.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	for _, rec := range s.Records {
+		switch rec.Dir {
+		case DirIn:
+			if _, err := conn.Write(rec.Data); err != nil {
+				return Stream{}, fmt.Errorf("failed to send: %w", err)
+			}
+		case DirOut:
+			stream.Want = append(stream.Want, rec.Data)
+			expected += len(rec.Data)
+			if err := receive(expected, timeout); err != nil {
+				return Stream{}, err
+			}
+		}
+	}
+
+	// Signal the end of the session, then collect anything else the server
+	// sends until it hangs up.
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+	if err := receive(math.MaxInt, timeout); err != nil {
+		return Stream{}, err
+	}
+
+	stream.Got = split(got, stream.Want)
+	return stream, nil
+}
+
+func replayPackets(ctx context.Context, s *Session, addr string, timeout time.Duration) (*Result, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every recorded peer gets its own socket, so that the server tells
+	// them apart as it did when the session was captured.
+	type peer struct {
+		conn   *net.UDPConn
+		chunks chan []byte
+		stream *Stream
+	}
+	peers := make(map[string]*peer)
+	var order []string
+	defer func() {
+		for _, p := range peers {
+			p.conn.Close()
+			for range p.chunks {
+			}
+		}
+	}()
+
+	get := func(name string) (*peer, error) {
+		if p, ok := peers[name]; ok {
+			return p, nil
+		}
+		conn, err := net.DialUDP("udp", nil, raddr)
+		if err != nil {
+			return nil, err
+		}
+		p := &peer{conn: conn, chunks: make(chan []byte), stream: &Stream{Peer: name}}
+		go readChunks(conn, p.chunks)
+		peers[name] = p
+		order = append(order, name)
+		return p, nil
+	}
+	receive := func(p *peer, timeout time.Duration) error {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case b, ok := <-p.chunks:
+			if ok {
+				p.stream.Got = append(p.stream.Got, b)
+			}
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	for _, rec := range s.Records {
+		p, err := get(rec.Peer)
+		if err != nil {
+			return nil, err
+		}
+		switch rec.Dir {
+		case DirIn:
+			if _, err := p.conn.Write(rec.Data); err != nil {
+				return nil, fmt.Errorf("failed to send: %w", err)
+			}
+		case DirOut:
+			p.stream.Want = append(p.stream.Want, rec.Data)
+			if err := receive(p, timeout); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var res Result
+	for _, name := range order {
+		p := peers[name]
+		// Pick up responses the server sent but the capture does not have.
+		for {
+			n := len(p.stream.Got)
+			if err := receive(p, timeout/10); err != nil {
+				return nil, err
+			}
+			if len(p.stream.Got) == n {
+				break
+			}
+		}
+		res.Streams = append(res.Streams, *p.stream)
+	}
+	return &res, nil
+}
+
+// readChunks sends what it reads from conn to chunks until conn fails.
+func readChunks(conn net.Conn, chunks chan<- []byte) {
+	defer close(chunks)
+
+	for {
+		b := make([]byte, 64*1024)
+		n, err := conn.Read(b)
+		if n > 0 {
+			chunks <- b[:n]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// split cuts b at the boundaries of the chunks in like. Bytes beyond them
+// form a chunk of their own.
+func split(b []byte, like [][]byte) [][]byte {
+	var chunks [][]byte
+	for _, c := range like {
+		if len(b) == 0 {
+			break
+		}
+		n := min(len(c), len(b))
+		chunks = append(chunks, b[:n])
+		b = b[n:]
+	}
+	if len(b) > 0 {
+		chunks = append(chunks, b)
+	}
+	return chunks
+}
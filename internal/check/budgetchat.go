@@ -0,0 +1,98 @@
+package check
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+func init() {
+	register("budgetchat",
+		Scenario{Name: "join, chat and leave", Run: func(t *T) {
+			alice, aliceName := joinChat(t, "alice")
+			bob, bobName := joinChat(t, "bob")
+			alice.ExpectLine(fmt.Sprintf("* %s has entered the room", bobName))
+
+			bob.SendLine("hi alice")
+			alice.ExpectLine(fmt.Sprintf("[%s] hi alice", bobName))
+			alice.SendLine("hi bob")
+			bob.ExpectLine(fmt.Sprintf("[%s] hi bob", aliceName))
+
+			bob.Close()
+			alice.ExpectLine(fmt.Sprintf("* %s has left the room", bobName))
+			alice.ExpectSilence()
+		}},
+		Scenario{Name: "no echo to the sender", Run: func(t *T) {
+			alice, _ := joinChat(t, "alice")
+			alice.SendLine("anyone here?")
+			alice.ExpectSilence()
+		}},
+		Scenario{Name: "room members in join order", Run: func(t *T) {
+			alice, aliceName := joinChat(t, "alice")
+			bob, bobName := joinChat(t, "bob")
+			alice.ExpectLine(fmt.Sprintf("* %s has entered the room", bobName))
+			_, carolName := joinChat(t, "carol", aliceName, bobName)
+			alice.ExpectLine(fmt.Sprintf("* %s has entered the room", carolName))
+			bob.ExpectLine(fmt.Sprintf("* %s has entered the room", carolName))
+		}},
+		Scenario{Name: "unregistered clients", Run: func(t *T) {
+			lurker := t.Dial("lurker")
+			lurker.ReadLine()
+
+			alice, _ := joinChat(t, "alice")
+			alice.SendLine("hello?")
+			alice.ExpectSilence()
+			lurker.ExpectSilence()
+		}},
+		Scenario{Name: "invalid name", Run: func(t *T) {
+			alice, _ := joinChat(t, "alice")
+
+			c := t.Dial("client")
+			c.ReadLine()
+			c.SendLine("no spaces allowed")
+			c.ReadToEOF()
+			alice.ExpectSilence()
+		}},
+		Scenario{Name: "empty name", Run: func(t *T) {
+			c := t.Dial("client")
+			c.ReadLine()
+			c.SendLine("")
+			c.ReadToEOF()
+		}},
+	)
+}
+
+// joinChat connects a client and joins the room with a unique name based on
+// name. It checks that the room contains the members in want, and returns
+// the client and its name.
+func joinChat(t *T, name string, want ...string) (*Client, string) {
+	// Other clients may be in the room when checking a shared server, so
+	// names are made unique and only the expected members are looked for.
+	name = fmt.Sprintf("%s%04d", name, rand.Intn(10000))
+
+	c := t.Dial(name)
+	c.ReadLine()
+	c.SendLine(name)
+
+	line := c.ReadLine()
+	const prefix = "* The room contains:"
+	if !strings.HasPrefix(line, prefix) {
+		t.Fatalf("%s: got %q, want the room members", name, line)
+	}
+	var members []string
+	for _, m := range strings.Split(strings.TrimPrefix(line, prefix), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	if slices.Contains(members, name) {
+		t.Fatalf("%s: room members %q include the new client", name, members)
+	}
+	for _, w := range want {
+		if !slices.Contains(members, w) {
+			t.Fatalf("%s: room members %q do not include %s", name, members, w)
+		}
+	}
+	return c, name
+}
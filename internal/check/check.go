@@ -0,0 +1,298 @@
+// Package check runs scripted client scenarios against problem servers,
+// in the spirit of the protohackers.com test suite, so that a server can be
+// checked locally before it is submitted.
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is how long a scenario waits for each expected response.
+const DefaultTimeout = 2 * time.Second
+
+// A Scenario is a scripted exchange with a server.
+type Scenario struct {
+	Name string
+	Run  func(t *T)
+}
+
+// scenarios are the scenarios of every problem, keyed by problem name.
+var scenarios = map[string][]Scenario{}
+
+// register adds the scenarios of a problem. It is called from the init
+// functions of the files holding them.
+func register(problem string, s ...Scenario) {
+	scenarios[problem] = append(scenarios[problem], s...)
+}
+
+// Scenarios returns the scenarios of the named problem.
+func Scenarios(problem string) []Scenario {
+	return scenarios[problem]
+}
+
+// Problems returns the names of the problems that have scenarios, sorted.
+func Problems() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config is the environment scenarios run in.
+type Config struct {
+	// Addr is the address of the server under test.
+	Addr string
+
+	// Timeout is how long to wait for each expected response. If zero,
+	// DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Settings are problem settings the scenarios depend on, such as the
+	// address mobinthemiddle rewrites Boguscoin addresses to, keyed by
+	// flag name.
+	Settings map[string]string
+}
+
+// Result is the outcome of a scenario.
+type Result struct {
+	Name     string
+	Failures []string
+	Duration time.Duration
+}
+
+// Failed reports whether the scenario failed.
+func (r Result) Failed() bool {
+	return len(r.Failures) > 0
+}
+
+// Run runs the scenarios one after another and reports their results.
+func Run(ctx context.Context, cfg Config, scenarios []Scenario) []Result {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	results := make([]Result, 0, len(scenarios))
+	for _, s := range scenarios {
+		results = append(results, run(ctx, cfg, s))
+	}
+	return results
+}
+
+func run(ctx context.Context, cfg Config, s Scenario) Result {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := &T{ctx: ctx, cfg: cfg}
+	start := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer t.closeAll()
+		s.Run(t)
+	}()
+	<-done
+
+	return Result{Name: s.Name, Failures: t.failures, Duration: time.Since(start)}
+}
+
+// T is the state of a running scenario. Its Fatal methods stop the
+// scenario; they must be called from the goroutine running it.
+type T struct {
+	ctx context.Context
+	cfg Config
+
+	mu       sync.Mutex
+	failures []string
+	closers  []io.Closer
+}
+
+// Setting returns the problem setting with the given flag name.
+func (t *T) Setting(name string) string {
+	return t.cfg.Settings[name]
+}
+
+// Errorf records a failure and lets the scenario continue.
+func (t *T) Errorf(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+// Fatalf records a failure and stops the scenario.
+func (t *T) Fatalf(format string, args ...any) {
+	t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (t *T) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range t.closers {
+		c.Close()
+	}
+}
+
+func (t *T) track(c io.Closer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closers = append(t.closers, c)
+}
+
+// Dial connects a client named name to the server over TCP.
+func (t *T) Dial(name string) *Client {
+	var d net.Dialer
+	conn, err := d.DialContext(t.ctx, "tcp", t.cfg.Addr)
+	if err != nil {
+		t.Fatalf("%s: failed to connect: %v", name, err)
+	}
+	t.track(conn)
+
+	return &Client{t: t, name: name, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// DialUDP creates a client named name that talks to the server over UDP.
+func (t *T) DialUDP(name string) *Client {
+	conn, err := net.Dial("udp", t.cfg.Addr)
+	if err != nil {
+		t.Fatalf("%s: failed to connect: %v", name, err)
+	}
+	t.track(conn)
+
+	return &Client{t: t, name: name, conn: conn, udp: true}
+}
+
+// Client is a connection to the server under test. Its methods stop the
+// scenario on unexpected responses.
+type Client struct {
+	t    *T
+	name string
+	conn net.Conn
+	r    *bufio.Reader
+	udp  bool
+}
+
+// Send sends b as is.
+func (c *Client) Send(b []byte) {
+	c.conn.SetWriteDeadline(time.Now().Add(c.t.cfg.Timeout))
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatalf("%s: failed to send %q: %v", c.name, b, err)
+	}
+}
+
+// SendLine sends line followed by a newline.
+func (c *Client) SendLine(line string) {
+	c.Send([]byte(line + "\n"))
+}
+
+// ExpectLine reads a line and fails unless it is want.
+func (c *Client) ExpectLine(want string) {
+	if got := c.ReadLine(); got != want {
+		c.t.Fatalf("%s: unexpected line\n\twant %q\n\tgot  %q", c.name, want, got)
+	}
+}
+
+// ReadLine reads a line and returns it without the newline.
+func (c *Client) ReadLine() string {
+	c.conn.SetReadDeadline(time.Now().Add(c.t.cfg.Timeout))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("%s: failed to read a line: %v (got %q)", c.name, err, line)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// Expect reads len(want) bytes and fails unless they are want.
+func (c *Client) Expect(want []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(c.t.cfg.Timeout))
+	got := make([]byte, len(want))
+	if n, err := io.ReadFull(c.r, got); err != nil {
+		c.t.Fatalf("%s: failed to read %d bytes: %v (got %q)", c.name, len(want), err, got[:n])
+	}
+	if !bytes.Equal(got, want) {
+		c.t.Fatalf("%s: unexpected response\n\twant %q\n\tgot  %q", c.name, want, got)
+	}
+}
+
+// ReadPacket reads a datagram.
+func (c *Client) ReadPacket() []byte {
+	c.conn.SetReadDeadline(time.Now().Add(c.t.cfg.Timeout))
+	b := make([]byte, 64*1024)
+	n, err := c.conn.Read(b)
+	if err != nil {
+		c.t.Fatalf("%s: failed to read a datagram: %v", c.name, err)
+	}
+	return b[:n]
+}
+
+// ExpectPacket reads a datagram and fails unless it is want.
+func (c *Client) ExpectPacket(want string) {
+	if got := c.ReadPacket(); string(got) != want {
+		c.t.Fatalf("%s: unexpected datagram\n\twant %q\n\tgot  %q", c.name, want, got)
+	}
+}
+
+// ExpectClosed fails unless the server closes the connection without
+// sending anything more.
+func (c *Client) ExpectClosed() {
+	if b := c.ReadToEOF(); len(b) > 0 {
+		c.t.Fatalf("%s: unexpected data before the connection closed: %q", c.name, b)
+	}
+}
+
+// ReadToEOF reads until the server closes the connection and returns what
+// it sent.
+func (c *Client) ReadToEOF() []byte {
+	c.conn.SetReadDeadline(time.Now().Add(c.t.cfg.Timeout))
+	b, err := io.ReadAll(c.r)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		c.t.Fatalf("%s: connection still open (got %q)", c.name, b)
+	}
+	return b
+}
+
+// ExpectSilence fails if the server sends anything for a while.
+func (c *Client) ExpectSilence() {
+	c.conn.SetReadDeadline(time.Now().Add(c.t.cfg.Timeout / 4))
+	if c.udp {
+		b := make([]byte, 64*1024)
+		if n, err := c.conn.Read(b); err == nil {
+			c.t.Fatalf("%s: unexpected datagram %q", c.name, b[:n])
+		}
+		return
+	}
+	if line, err := c.r.ReadString('\n'); len(line) > 0 || err == nil {
+		c.t.Fatalf("%s: unexpected data %q", c.name, line)
+	}
+}
+
+// CloseWrite signals the server that the client has nothing more to send.
+func (c *Client) CloseWrite() {
+	if cw, ok := c.conn.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil {
+			c.t.Fatalf("%s: failed to close the connection for writing: %v", c.name, err)
+		}
+	}
+}
+
+// Close closes the connection.
+func (c *Client) Close() {
+	c.conn.Close()
+}
@@ -0,0 +1,105 @@
+package check
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	reached := false
+	scenarios := []Scenario{
+		{Name: "pass", Run: func(t *T) {
+			c := t.Dial("client")
+			c.SendLine("hello")
+			c.ExpectLine("hello")
+		}},
+		{Name: "errors", Run: func(t *T) {
+			t.Errorf("first")
+			t.Errorf("second")
+		}},
+		{Name: "fatal", Run: func(t *T) {
+			c := t.Dial("client")
+			c.SendLine("hello")
+			c.ExpectLine("goodbye")
+			reached = true
+		}},
+		{Name: "silence", Run: func(t *T) {
+			c := t.Dial("client")
+			c.SendLine("hello")
+			c.ExpectSilence()
+		}},
+		{Name: "closed", Run: func(t *T) {
+			c := t.Dial("client")
+			c.Send([]byte("bye"))
+			c.CloseWrite()
+			c.Expect([]byte("bye"))
+			c.ExpectClosed()
+		}},
+	}
+
+	results := Run(context.Background(), Config{Addr: ln.Addr().String(), Timeout: 200 * time.Millisecond}, scenarios)
+
+	want := map[string][]string{
+		"pass":    nil,
+		"errors":  {"first", "second"},
+		"fatal":   {"client: unexpected line\n\twant \"goodbye\"\n\tgot  \"hello\""},
+		"silence": {"client: unexpected data \"hello\\n\""},
+		"closed":  nil,
+	}
+	for _, res := range results {
+		if !reflect.DeepEqual(res.Failures, want[res.Name]) {
+			t.Errorf("%s: failures = %q, want %q", res.Name, res.Failures, want[res.Name])
+		}
+		if res.Failed() != (len(want[res.Name]) > 0) {
+			t.Errorf("%s: Failed() = %v", res.Name, res.Failed())
+		}
+	}
+	if len(results) != len(scenarios) {
+		t.Errorf("got %d results, want %d", len(results), len(scenarios))
+	}
+	if reached {
+		t.Error("scenario continued after a fatal failure")
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	t.Parallel()
+
+	want := []string{"budgetchat", "means", "mobinthemiddle", "primetime", "smoketest", "unusualdb"}
+	if got := Problems(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Problems() = %q, want %q", got, want)
+	}
+	for _, name := range want {
+		seen := make(map[string]bool)
+		for _, s := range Scenarios(name) {
+			if seen[s.Name] {
+				t.Errorf("%s: duplicate scenario %q", name, s.Name)
+			}
+			seen[s.Name] = true
+		}
+	}
+}
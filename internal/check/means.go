@@ -0,0 +1,77 @@
+package check
+
+import "encoding/binary"
+
+func init() {
+	register("means",
+		Scenario{Name: "example session", Run: func(t *T) {
+			c := t.Dial("client")
+			c.Send(meansMessage('I', 12345, 101))
+			c.Send(meansMessage('I', 12346, 102))
+			c.Send(meansMessage('I', 12347, 100))
+			c.Send(meansMessage('I', 40960, 5))
+			c.Send(meansMessage('Q', 12288, 16384))
+			c.Expect(meansMean(101))
+		}},
+		Scenario{Name: "session isolation", Run: func(t *T) {
+			a := t.Dial("a")
+			b := t.Dial("b")
+			a.Send(meansMessage('I', 1, 100))
+			b.Send(meansMessage('I', 1, 10))
+			b.Send(meansMessage('I', 2, 20))
+			a.Send(meansMessage('Q', 0, 10))
+			b.Send(meansMessage('Q', 0, 10))
+			a.Expect(meansMean(100))
+			b.Expect(meansMean(15))
+		}},
+		Scenario{Name: "empty ranges", Run: func(t *T) {
+			c := t.Dial("client")
+			c.Send(meansMessage('Q', 0, 100))
+			c.Expect(meansMean(0))
+			c.Send(meansMessage('I', 50, 7))
+			c.Send(meansMessage('Q', 100, 0))
+			c.Expect(meansMean(0))
+		}},
+		Scenario{Name: "negative values", Run: func(t *T) {
+			c := t.Dial("client")
+			c.Send(meansMessage('I', -100, -5))
+			c.Send(meansMessage('I', -50, -15))
+			c.Send(meansMessage('I', 50, 1000))
+			c.Send(meansMessage('Q', -1000, 0))
+			c.Expect(meansMean(-10))
+		}},
+		Scenario{Name: "large values", Run: func(t *T) {
+			c := t.Dial("client")
+			c.Send(meansMessage('I', 1, 2147483647))
+			c.Send(meansMessage('I', 2, 2147483647))
+			c.Send(meansMessage('Q', 1, 2))
+			c.Expect(meansMean(2147483647))
+		}},
+		Scenario{Name: "split messages", Run: func(t *T) {
+			var b []byte
+			b = append(b, meansMessage('I', 10, 30)...)
+			b = append(b, meansMessage('I', 20, 40)...)
+			b = append(b, meansMessage('Q', 0, 100)...)
+
+			c := t.Dial("client")
+			for i := range b {
+				c.Send(b[i : i+1])
+			}
+			c.Expect(meansMean(35))
+		}},
+	)
+}
+
+// meansMessage encodes a means message of type typ.
+func meansMessage(typ byte, a, b int32) []byte {
+	m := make([]byte, 9)
+	m[0] = typ
+	binary.BigEndian.PutUint32(m[1:], uint32(a))
+	binary.BigEndian.PutUint32(m[5:], uint32(b))
+	return m
+}
+
+// meansMean encodes the answer to a query.
+func meansMean(mean int32) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(mean))
+}
@@ -0,0 +1,75 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	register("mobinthemiddle",
+		Scenario{Name: "rewrite Boguscoin addresses", Run: func(t *T) {
+			alice, _ := joinChat(t, "alice")
+			bob, bobName := joinChat(t, "bob")
+			alice.ExpectLine(fmt.Sprintf("* %s has entered the room", bobName))
+
+			tony := t.Setting("tony-address")
+			for _, tt := range []struct {
+				send string
+				want string
+			}{
+				{"Hi alice, please send payment to 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX", "Hi alice, please send payment to TONY"},
+				{"7F1u3wSD5RbOHQmupo9nx4TnhQ is my address", "TONY is my address"},
+				{"Send 7YWHMfk9JZe0LM0g1ZauHuiSxhI or 7LOrwbDlS8NujgjddyogWgIM93MV5N2VR", "Send TONY or TONY"},
+				{"Please pay the ticket price of 15 Boguscoins to one of these addresses: 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX 7adNeSwJkMakpEcln9HEtthSRtxdmEHOT8T", "Please pay the ticket price of 15 Boguscoins to one of these addresses: TONY TONY"},
+			} {
+				bob.SendLine(tt.send)
+				got := alice.ReadLine()
+				if tony == "" {
+					tony = learnTonyAddress(t, got, tt.want, bobName)
+				}
+				if want := fmt.Sprintf("[%s] %s", bobName, strings.ReplaceAll(tt.want, "TONY", tony)); got != want {
+					t.Fatalf("alice: unexpected line\n\twant %q\n\tgot  %q", want, got)
+				}
+			}
+		}},
+		Scenario{Name: "leave other words alone", Run: func(t *T) {
+			alice, _ := joinChat(t, "alice")
+			bob, bobName := joinChat(t, "bob")
+			alice.ExpectLine(fmt.Sprintf("* %s has entered the room", bobName))
+
+			for _, msg := range []string{
+				"This is a normal message",
+				"Too short: 7iKDZEwPZSqIvDnHvVN2r0hUW",
+				"Too long: 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX12345",
+				"Wrong start: 8iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX",
+				"This is a product ID, not a Boguscoin: 7jFBixq0RRM2Za3ZAM7pgsUOCFtIS-1234",
+			} {
+				bob.SendLine(msg)
+				alice.ExpectLine(fmt.Sprintf("[%s] %s", bobName, msg))
+			}
+		}},
+		Scenario{Name: "several lines at once", Run: func(t *T) {
+			alice, _ := joinChat(t, "alice")
+			bob, bobName := joinChat(t, "bob")
+			alice.ExpectLine(fmt.Sprintf("* %s has entered the room", bobName))
+
+			bob.Send([]byte("one\ntwo\nthree\n"))
+			for _, msg := range []string{"one", "two", "three"} {
+				alice.ExpectLine(fmt.Sprintf("[%s] %s", bobName, msg))
+			}
+		}},
+	)
+}
+
+// learnTonyAddress finds the address the server rewrote to in got, a
+// message from name that should read like want with TONY standing for the
+// address, for checks against a server whose address is not configured.
+func learnTonyAddress(t *T, got, want, name string) string {
+	prefix, suffix, _ := strings.Cut(fmt.Sprintf("[%s] %s", name, want), "TONY")
+	suffix, _, _ = strings.Cut(suffix, "TONY")
+	if !strings.HasPrefix(got, prefix) || !strings.HasSuffix(got, suffix) {
+		t.Fatalf("alice: got %q, want a message with a rewritten address", got)
+	}
+	tony, _, _ := strings.Cut(strings.TrimPrefix(got, prefix), " ")
+	return strings.TrimSuffix(tony, suffix)
+}
@@ -0,0 +1,97 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	register("primetime",
+		Scenario{Name: "well-formed requests", Run: func(t *T) {
+			c := t.Dial("client")
+			for _, tt := range []struct {
+				number string
+				prime  bool
+			}{
+				{"2", true},
+				{"7", true},
+				{"8", false},
+				{"1", false},
+				{"0", false},
+				{"-7", false},
+				{"7919", true},
+				{"1.5", false},
+				{"7.5", false},
+				{"1000000000000000000000", false},
+			} {
+				c.SendLine(`{"method":"isPrime","number":` + tt.number + `}`)
+				c.ExpectLine(fmt.Sprintf(`{"method":"isPrime","prime":%t}`, tt.prime))
+			}
+		}},
+		Scenario{Name: "extra fields", Run: func(t *T) {
+			c := t.Dial("client")
+			c.SendLine(`{"number":13,"extra":[1,2,3],"method":"isPrime"}`)
+			c.ExpectLine(`{"method":"isPrime","prime":true}`)
+		}},
+		Scenario{Name: "pipelined requests", Run: func(t *T) {
+			var b strings.Builder
+			for i := 0; i < 100; i++ {
+				fmt.Fprintf(&b, `{"method":"isPrime","number":%d}`+"\n", i)
+			}
+
+			c := t.Dial("client")
+			c.Send([]byte(b.String()))
+			for i := 0; i < 100; i++ {
+				c.ExpectLine(fmt.Sprintf(`{"method":"isPrime","prime":%t}`, isSmallPrime(i)))
+			}
+		}},
+		malformedScenario("invalid JSON", `{"method":"isPrime","number":7`),
+		malformedScenario("wrong method", `{"method":"isPrim","number":7}`),
+		malformedScenario("missing method", `{"number":7}`),
+		malformedScenario("missing number", `{"method":"isPrime"}`),
+		malformedScenario("number as string", `{"method":"isPrime","number":"7"}`),
+		malformedScenario("not an object", `["isPrime",7]`),
+		Scenario{Name: "malformed request after a valid one", Run: func(t *T) {
+			c := t.Dial("client")
+			c.SendLine(`{"method":"isPrime","number":3}`)
+			c.SendLine(`nope`)
+			c.ExpectLine(`{"method":"isPrime","prime":true}`)
+			expectMalformed(c)
+		}},
+	)
+}
+
+// malformedScenario checks that request is answered with a malformed
+// response, after which the server disconnects.
+func malformedScenario(name, request string) Scenario {
+	return Scenario{Name: "malformed request: " + name, Run: func(t *T) {
+		c := t.Dial("client")
+		c.SendLine(request)
+		expectMalformed(c)
+	}}
+}
+
+func expectMalformed(c *Client) {
+	line := c.ReadLine()
+	var res struct {
+		Method *string `json:"method"`
+		Prime  *bool   `json:"prime"`
+	}
+	if err := json.Unmarshal([]byte(line), &res); err == nil && res.Method != nil && *res.Method == "isPrime" && res.Prime != nil {
+		c.t.Fatalf("%s: got a well-formed response %q, want a malformed one", c.name, line)
+	}
+	c.ExpectClosed()
+}
+
+func isSmallPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
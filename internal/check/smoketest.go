@@ -0,0 +1,46 @@
+package check
+
+import "strings"
+
+func init() {
+	register("smoketest",
+		Scenario{Name: "echo", Run: func(t *T) {
+			c := t.Dial("client")
+			c.Send([]byte("hello, world\n"))
+			c.Expect([]byte("hello, world\n"))
+			c.Send([]byte("no newline"))
+			c.Expect([]byte("no newline"))
+		}},
+		Scenario{Name: "binary data", Run: func(t *T) {
+			b := make([]byte, 256)
+			for i := range b {
+				b[i] = byte(i)
+			}
+
+			c := t.Dial("client")
+			c.Send(b)
+			c.Expect(b)
+		}},
+		Scenario{Name: "close after end of input", Run: func(t *T) {
+			data := []byte(strings.Repeat("0123456789", 10000))
+
+			c := t.Dial("client")
+			c.Send(data)
+			c.CloseWrite()
+			c.Expect(data)
+			c.ExpectClosed()
+		}},
+		Scenario{Name: "concurrent clients", Run: func(t *T) {
+			var clients []*Client
+			for _, name := range []string{"a", "b", "c", "d", "e"} {
+				clients = append(clients, t.Dial(name))
+			}
+			for i, c := range clients {
+				c.Send([]byte(strings.Repeat(string(rune('a'+i)), 100)))
+			}
+			for i, c := range clients {
+				c.Expect([]byte(strings.Repeat(string(rune('a'+i)), 100)))
+			}
+		}},
+	)
+}
@@ -0,0 +1,75 @@
+package check
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+func init() {
+	register("unusualdb",
+		Scenario{Name: "insert and retrieve", Run: func(t *T) {
+			key := uniqueKey("foo")
+			c := t.DialUDP("client")
+			c.Send([]byte(key + "=bar"))
+			c.Send([]byte(key))
+			c.ExpectPacket(key + "=bar")
+		}},
+		Scenario{Name: "overwrite", Run: func(t *T) {
+			key := uniqueKey("foo")
+			c := t.DialUDP("client")
+			c.Send([]byte(key + "=bar"))
+			c.Send([]byte(key + "=baz"))
+			c.Send([]byte(key))
+			c.ExpectPacket(key + "=baz")
+		}},
+		Scenario{Name: "equals signs", Run: func(t *T) {
+			key := uniqueKey("foo")
+			c := t.DialUDP("client")
+			c.Send([]byte(key + "=bar=baz"))
+			c.Send([]byte(key))
+			c.ExpectPacket(key + "=bar=baz")
+			c.Send([]byte(key + "="))
+			c.Send([]byte(key))
+			c.ExpectPacket(key + "=")
+		}},
+		Scenario{Name: "empty key", Run: func(t *T) {
+			value := uniqueKey("value")
+			c := t.DialUDP("client")
+			c.Send([]byte("=" + value))
+			c.Send([]byte(""))
+			c.ExpectPacket("=" + value)
+		}},
+		Scenario{Name: "shared between clients", Run: func(t *T) {
+			key := uniqueKey("shared")
+			a := t.DialUDP("a")
+			b := t.DialUDP("b")
+			a.Send([]byte(key + "=from a"))
+			a.Send([]byte(key))
+			a.ExpectPacket(key + "=from a")
+			b.Send([]byte(key))
+			b.ExpectPacket(key + "=from a")
+		}},
+		Scenario{Name: "version is immutable", Run: func(t *T) {
+			c := t.DialUDP("client")
+			c.Send([]byte("version"))
+			version := string(c.ReadPacket())
+			if !strings.HasPrefix(version, "version=") || version == "version=" {
+				t.Fatalf("client: got %q, want a version", version)
+			}
+			if want := t.Setting("db-version"); want != "" && version != "version="+want {
+				t.Fatalf("client: got %q, want %q", version, "version="+want)
+			}
+
+			c.Send([]byte("version=hacked"))
+			c.Send([]byte("version"))
+			c.ExpectPacket(version)
+		}},
+	)
+}
+
+// uniqueKey returns a key based on prefix that no other run uses, so that
+// scenarios do not see each other's values on a shared server.
+func uniqueKey(prefix string) string {
+	return fmt.Sprintf("%s-%08x", prefix, rand.Uint32())
+}
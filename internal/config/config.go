@@ -0,0 +1,88 @@
+// Package config reads the configuration files of the protohackers command.
+//
+// A configuration file is YAML. Its keys are the names of command-line
+// flags, so that every setting has a single name across the file, the
+// command line and the environment:
+//
+//	metrics-addr: ":9100"
+//	log-format: json
+//	problems:
+//	  smoketest:
+//	    addr: ":9000"
+//	    idle-timeout: 30s
+//	  mobinthemiddle:
+//	    addr: ":9005"
+//	    upstream-addr: chat.protohackers.com:16963
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a parsed configuration file.
+type Config struct {
+	// Settings are the top-level settings, keyed by flag name.
+	Settings map[string]string `yaml:",inline"`
+
+	// Problems are the settings of each problem, keyed by the problem
+	// number, name or alias and then by flag name.
+	Problems map[string]map[string]string `yaml:"problems"`
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses a configuration file.
+func Parse(b []byte) (*Config, error) {
+	var c Config
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Apply sets the flags of fs named by settings, in name order. Flags for
+// which skip reports true are left alone, which lets values given on the
+// command line take precedence over the file. prefix is prepended to the
+// setting names in errors.
+func Apply(fs *flag.FlagSet, settings map[string]string, skip func(name string) bool, prefix string) error {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s%s: unknown setting", prefix, name)
+		}
+		if skip != nil && skip(name) {
+			continue
+		}
+		if err := fs.Set(name, settings[name]); err != nil {
+			return fmt.Errorf("%s%s: invalid value %q: %w", prefix, name, settings[name], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	c, err := Parse([]byte(`
+metrics-addr: ":9100"
+log-level: debug
+problems:
+  smoketest:
+    addr: ":9000"
+    max-conns: 10
+  5:
+    upstream-addr: chat.protohackers.com:16963
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got := c.Settings["metrics-addr"]; got != ":9100" {
+		t.Errorf("metrics-addr = %q, want %q", got, ":9100")
+	}
+	if got := c.Settings["log-level"]; got != "debug" {
+		t.Errorf("log-level = %q, want %q", got, "debug")
+	}
+	if _, ok := c.Settings["problems"]; ok {
+		t.Error("problems is reported as a top-level setting")
+	}
+	if got := c.Problems["smoketest"]["max-conns"]; got != "10" {
+		t.Errorf("smoketest max-conns = %q, want %q", got, "10")
+	}
+	if got := c.Problems["5"]["upstream-addr"]; got != "chat.protohackers.com:16963" {
+		t.Errorf("5 upstream-addr = %q, want %q", got, "chat.protohackers.com:16963")
+	}
+
+	if _, err := Parse(nil); err != nil {
+		t.Errorf("Parse() of an empty file error = %v", err)
+	}
+	if _, err := Parse([]byte("problems:\n  smoketest:\n    addr: [1, 2]\n")); err == nil {
+		t.Error("Parse() of a non-scalar setting succeeded")
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	newFlagSet := func() (*flag.FlagSet, *time.Duration, *int) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		return fs, fs.Duration("idle-timeout", time.Minute, ""), fs.Int("max-conns", 0, "")
+	}
+
+	t.Run("sets flags", func(t *testing.T) {
+		t.Parallel()
+
+		fs, idle, maxConns := newFlagSet()
+		settings := map[string]string{"idle-timeout": "5s", "max-conns": "3"}
+		if err := Apply(fs, settings, nil, ""); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if *idle != 5*time.Second || *maxConns != 3 {
+			t.Errorf("got idle-timeout %v, max-conns %d, want %v, %d", *idle, *maxConns, 5*time.Second, 3)
+		}
+	})
+
+	t.Run("skips flags", func(t *testing.T) {
+		t.Parallel()
+
+		fs, idle, maxConns := newFlagSet()
+		settings := map[string]string{"idle-timeout": "5s", "max-conns": "3"}
+		skip := func(name string) bool { return name == "max-conns" }
+		if err := Apply(fs, settings, skip, ""); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if *idle != 5*time.Second || *maxConns != 0 {
+			t.Errorf("got idle-timeout %v, max-conns %d, want %v, %d", *idle, *maxConns, 5*time.Second, 0)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			settings map[string]string
+			want     string
+		}{
+			{map[string]string{"max-conns": "3", "colour": "blue"}, "x.colour: unknown setting"},
+			{map[string]string{"max-conns": "many"}, `x.max-conns: invalid value "many": parse error`},
+		}
+		for _, tt := range tests {
+			fs, _, _ := newFlagSet()
+			if err := Apply(fs, tt.settings, nil, "x."); err == nil || err.Error() != tt.want {
+				t.Errorf("Apply(%v) error = %v, want %q", tt.settings, err, tt.want)
+			}
+		}
+	})
+}
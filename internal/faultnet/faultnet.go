@@ -0,0 +1,234 @@
+// Package faultnet wraps network connections to inject the faults that real
+// networks and the protohackers.com checker produce: writes split at random
+// boundaries, writes merged together, latency and connection resets.
+//
+// It is meant for tests: a handler that only works when every read returns
+// exactly one message fails once its peer's writes go through faultnet.
+package faultnet
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultFlushDelay is how long coalesced writes are held back when
+// Faults.FlushDelay is zero.
+const defaultFlushDelay = 10 * time.Millisecond
+
+// ErrReset is returned by writes to a connection that faultnet reset.
+var ErrReset = errors.New("faultnet: connection reset")
+
+// Faults describes the faults injected into the writes of a connection.
+// The zero value injects none.
+type Faults struct {
+	// Seed seeds the random choices, so that a failing run can be
+	// repeated.
+	Seed int64
+
+	// MaxFragment, if positive, splits every write into fragments of 1 to
+	// MaxFragment bytes that are sent separately.
+	MaxFragment int
+
+	// Coalesce, if positive, holds writes back until at least Coalesce
+	// bytes are pending or FlushDelay passed, and then sends them
+	// together.
+	Coalesce int
+
+	// FlushDelay is how long coalesced writes may be held back. If zero,
+	// 10ms is used.
+	FlushDelay time.Duration
+
+	// Latency, if positive, delays every fragment by a random duration of
+	// up to Latency.
+	Latency time.Duration
+
+	// ResetAfter, if positive, resets the connection once that many bytes
+	// were written: the peer sees a reset and later writes fail with
+	// ErrReset.
+	ResetAfter int
+}
+
+// Profile is a named set of faults.
+type Profile struct {
+	Name   string
+	Faults Faults
+}
+
+// Profiles returns the fault profiles handler tests run through: a clean
+// connection, and the ways the protohackers.com checker sends data.
+func Profiles() []Profile {
+	return []Profile{
+		{Name: "clean"},
+		{Name: "byte at a time", Faults: Faults{MaxFragment: 1}},
+		{Name: "fragmented", Faults: Faults{Seed: 1, MaxFragment: 7, Latency: time.Millisecond}},
+		{Name: "coalesced", Faults: Faults{Coalesce: 4096}},
+		{Name: "coalesced and fragmented", Faults: Faults{Seed: 2, Coalesce: 64, MaxFragment: 5}},
+	}
+}
+
+// Wrap returns conn with faults injected into its writes. Reads are left
+// alone; wrap the other end of the connection to affect them.
+func Wrap(conn net.Conn, f Faults) net.Conn {
+	return &faultConn{Conn: conn, f: f, rand: rand.New(rand.NewSource(f.Seed))}
+}
+
+// Listener returns a listener whose accepted connections have faults
+// injected into their writes.
+func Listener(ln net.Listener, f Faults) net.Listener {
+	return &listener{Listener: ln, f: f}
+}
+
+type listener struct {
+	net.Listener
+	f Faults
+
+	mu  sync.Mutex
+	seq int64
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection makes its own random choices.
+	l.mu.Lock()
+	l.seq++
+	f := l.f
+	f.Seed += l.seq
+	l.mu.Unlock()
+
+	return Wrap(conn, f), nil
+}
+
+type faultConn struct {
+	net.Conn
+	f Faults
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	pending []byte
+	timer   *time.Timer
+	written int
+	err     error
+}
+
+func (c *faultConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.f.Coalesce <= 0 {
+		return c.send(b)
+	}
+
+	c.pending = append(c.pending, b...)
+	if len(c.pending) >= c.f.Coalesce {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.timer == nil {
+		delay := c.f.FlushDelay
+		if delay <= 0 {
+			delay = defaultFlushDelay
+		}
+		c.timer = time.AfterFunc(delay, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.flush()
+		})
+	}
+	return len(b), nil
+}
+
+// flush sends the pending writes. It must be called with c.mu held.
+func (c *faultConn) flush() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if len(c.pending) == 0 || c.err != nil {
+		return c.err
+	}
+
+	b := c.pending
+	c.pending = nil
+	_, err := c.send(b)
+	return err
+}
+
+// send writes b in fragments. It must be called with c.mu held.
+func (c *faultConn) send(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		size := len(b)
+		if c.f.MaxFragment > 0 {
+			size = min(size, 1+c.rand.Intn(c.f.MaxFragment))
+		}
+		reset := false
+		if c.f.ResetAfter > 0 && c.written+size >= c.f.ResetAfter {
+			size = c.f.ResetAfter - c.written
+			reset = true
+		}
+
+		if c.f.Latency > 0 {
+			time.Sleep(time.Duration(c.rand.Int63n(int64(c.f.Latency) + 1)))
+		}
+		m, err := c.Conn.Write(b[:size])
+		n += m
+		c.written += m
+		if err != nil {
+			c.err = err
+			return n, err
+		}
+		if reset {
+			c.reset()
+			return n, c.err
+		}
+		b = b[size:]
+	}
+	return n, nil
+}
+
+// reset aborts the connection so that its peer sees a reset rather than an
+// orderly close. It must be called with c.mu held.
+func (c *faultConn) reset() {
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	c.Conn.Close()
+	c.err = ErrReset
+}
+
+// CloseWrite sends the pending writes, then shuts down the writing side of
+// the connection if it supports that.
+func (c *faultConn) CloseWrite() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.flush(); err != nil {
+		return err
+	}
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close sends the pending writes and closes the connection.
+func (c *faultConn) Close() error {
+	c.mu.Lock()
+	c.flush()
+	c.mu.Unlock()
+
+	return c.Conn.Close()
+}
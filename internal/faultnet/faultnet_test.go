@@ -0,0 +1,163 @@
+package faultnet
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWrap_fragments(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := Wrap(client, Faults{Seed: 1, MaxFragment: 3})
+	defer conn.Close()
+
+	payload := []byte("the quick brown fox jumps over the lazy dog")
+	go conn.Write(payload)
+
+	var got []byte
+	b := make([]byte, 64)
+	for len(got) < len(payload) {
+		n, err := server.Read(b)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if n > 3 {
+			t.Errorf("read a fragment of %d bytes, want at most 3", n)
+		}
+		got = append(got, b[:n]...)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("got %q, want %q", got, payload)
+	}
+}
+
+func TestWrap_coalesces(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		faults Faults
+		writes []string
+		want   []string
+	}{
+		{
+			name:   "flushed by size",
+			faults: Faults{Coalesce: 6, FlushDelay: time.Hour},
+			writes: []string{"one\n", "two\n", "three\n"},
+			want:   []string{"one\ntwo\n", "three\n"},
+		},
+		{
+			name:   "flushed by delay",
+			faults: Faults{Coalesce: 1024, FlushDelay: time.Millisecond},
+			writes: []string{"one\n", "two\n"},
+			want:   []string{"one\ntwo\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server := net.Pipe()
+			defer server.Close()
+			conn := Wrap(client, tt.faults)
+			defer conn.Close()
+
+			// Pipe writes block until they are read, so the writes are
+			// made before any read.
+			go func() {
+				for _, w := range tt.writes {
+					conn.Write([]byte(w))
+				}
+			}()
+			time.Sleep(10 * time.Millisecond)
+
+			b := make([]byte, 64)
+			for _, want := range tt.want {
+				server.SetReadDeadline(time.Now().Add(time.Second))
+				n, err := server.Read(b)
+				if err != nil {
+					t.Fatalf("failed to read: %v", err)
+				}
+				if got := string(b[:n]); got != want {
+					t.Errorf("read %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWrap_close_flushes(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	conn := Wrap(client, Faults{Coalesce: 1024, FlushDelay: time.Hour})
+
+	go func() {
+		conn.Write([]byte("pending"))
+		conn.Close()
+	}()
+
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(got) != "pending" {
+		t.Errorf("got %q, want %q", got, "pending")
+	}
+}
+
+func TestWrap_reset(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	conn := Wrap(client, Faults{ResetAfter: 5})
+	defer conn.Close()
+
+	n, err := conn.Write([]byte("hello, world"))
+	if n != 5 || !errors.Is(err, ErrReset) {
+		t.Errorf("Write() = %d, %v, want 5, %v", n, err, ErrReset)
+	}
+	if _, err := conn.Write([]byte("more")); !errors.Is(err, ErrReset) {
+		t.Errorf("Write() after a reset error = %v, want %v", err, ErrReset)
+	}
+
+	server := <-accepted
+	if server == nil {
+		t.Fatal("failed to accept")
+	}
+	defer server.Close()
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	got, err := io.ReadAll(server)
+	if string(got) != "hello" || !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("peer read %q, %v, want %q and a reset", got, err, "hello")
+	}
+}
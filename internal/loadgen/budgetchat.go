@@ -0,0 +1,101 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+func init() {
+	// A chat workload also loads mobinthemiddle, which relays the same
+	// protocol.
+	chat := Workload{Network: "tcp", Dial: dialChatter}
+	register("budgetchat", chat)
+	register("mobinthemiddle", chat)
+}
+
+// chatter joins the room twice: as a speaker that sends messages and as a
+// listener that waits for them to be broadcast. Every listener receives the
+// messages of every speaker, so the cost of broadcasting grows with the
+// square of the clients.
+type chatter struct {
+	speaker, listener net.Conn
+	r                 *bufio.Reader
+	name              string
+	seq               int
+}
+
+func dialChatter(ctx context.Context, addr string, id int) (Client, error) {
+	// Names are made unique so that several runs can share a room.
+	run := rand.Intn(1 << 20)
+	c := &chatter{name: fmt.Sprintf("speaker%dx%d", run, id)}
+
+	var err error
+	if c.speaker, _, err = joinChat(ctx, addr, c.name); err != nil {
+		return nil, err
+	}
+	if c.listener, c.r, err = joinChat(ctx, addr, fmt.Sprintf("listener%dx%d", run, id)); err != nil {
+		c.speaker.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// joinChat connects to the chat server at addr and joins the room as name.
+func joinChat(ctx context.Context, addr, name string) (net.Conn, *bufio.Reader, error) {
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bind(ctx, conn)()
+
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to read the greeting: %w", err)
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", name); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to join: %w", err)
+	}
+	if !strings.HasPrefix(line, "* ") {
+		conn.Close()
+		return nil, nil, errors.New("failed to join: " + strings.TrimSpace(line))
+	}
+	return conn, r, nil
+}
+
+func (c *chatter) Do(ctx context.Context) error {
+	defer bind(ctx, c.speaker, c.listener)()
+
+	c.seq++
+	msg := fmt.Sprintf("message %d from %s", c.seq, c.name)
+	if _, err := fmt.Fprintf(c.speaker, "%s\n", msg); err != nil {
+		return err
+	}
+
+	// Skip the messages of the other speakers and the room notifications.
+	want := fmt.Sprintf("[%s] %s\n", c.name, msg)
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if line == want {
+			return nil
+		}
+	}
+}
+
+func (c *chatter) Close() error {
+	return errors.Join(c.speaker.Close(), c.listener.Close())
+}
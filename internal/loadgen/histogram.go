@@ -0,0 +1,99 @@
+package loadgen
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histogramSubBits sets the precision of a Histogram: every power of two
+// is split into 1<<histogramSubBits buckets, so a recorded latency is
+// known to within 1/128 of its value.
+const histogramSubBits = 7
+
+// histogramExact is the number of nanoseconds below which every value
+// has a bucket of its own.
+const histogramExact = 2 << histogramSubBits
+
+// A Histogram counts latencies in buckets whose width grows with their
+// value, so that its size depends on the range of the latencies and not
+// on how many were recorded. The zero value is an empty histogram.
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	max    time.Duration
+}
+
+// Record adds a latency to h.
+func (h *Histogram) Record(d time.Duration) {
+	d = max(d, 0)
+	i := bucket(uint64(d))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.count++
+	h.max = max(h.max, d)
+}
+
+// Merge adds the latencies recorded by o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if len(o.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, len(o.counts)-len(h.counts))...)
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.count += o.count
+	h.max = max(h.max, o.max)
+}
+
+// Count returns the number of latencies recorded.
+func (h *Histogram) Count() int {
+	return int(h.count)
+}
+
+// Max returns the highest latency recorded, or zero if there is none.
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the latency below which p percent of the recorded
+// latencies are, or zero if there is none. It is rounded up to the bucket
+// holding it, but never beyond Max.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	rank = max(1, min(rank, h.count))
+
+	var seen uint64
+	for i, n := range h.counts {
+		if seen += n; seen >= rank {
+			return min(time.Duration(bucketMax(i)), h.max)
+		}
+	}
+	return h.max
+}
+
+// bucket returns the index of the bucket of v.
+func bucket(v uint64) int {
+	if v < histogramExact {
+		return int(v)
+	}
+	shift := bits.Len64(v) - (histogramSubBits + 1)
+	sub := int(v>>shift) - histogramExact/2
+	return histogramExact + (shift-1)<<histogramSubBits + sub
+}
+
+// bucketMax returns the highest value of the bucket with index i.
+func bucketMax(i int) uint64 {
+	if i < histogramExact {
+		return uint64(i)
+	}
+	i -= histogramExact
+	shift := i>>histogramSubBits + 1
+	top := uint64(i&(1<<histogramSubBits-1) + histogramExact/2)
+	return (top+1)<<shift - 1
+}
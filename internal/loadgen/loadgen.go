@@ -0,0 +1,349 @@
+// Package loadgen drives concurrent client traffic against problem servers
+// and reports throughput, latency and errors, to size hosts and catch
+// performance regressions.
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Options.
+const (
+	DefaultClients  = 10
+	DefaultDuration = 10 * time.Second
+	DefaultTimeout  = 5 * time.Second
+)
+
+// reconnectDelay is how long a client waits before reconnecting after an
+// error.
+const reconnectDelay = 100 * time.Millisecond
+
+// Error classes counted in a Report.
+const (
+	ErrorConnect  = "connect"
+	ErrorTimeout  = "timeout"
+	ErrorResponse = "response"
+	ErrorIO       = "io"
+)
+
+// errUnexpectedResponse is wrapped by the errors of clients that received
+// a wrong answer.
+var errUnexpectedResponse = errors.New("unexpected response")
+
+// unexpected returns an error for a wrong answer.
+func unexpected(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errUnexpectedResponse, fmt.Sprintf(format, args...))
+}
+
+// A Workload generates the traffic of one problem.
+type Workload struct {
+	// Network is the network the server listens on.
+	Network string
+
+	// Dial connects the client with the given number to the server at
+	// addr.
+	Dial func(ctx context.Context, addr string, id int) (Client, error)
+}
+
+// Client is a connected load-generating client.
+type Client interface {
+	// Do makes a request and waits for its response, giving up when ctx
+	// is done. A client that failed is closed and replaced.
+	Do(ctx context.Context) error
+
+	Close() error
+}
+
+// workloads are the workloads of every problem, keyed by problem name.
+var workloads = map[string]Workload{}
+
+// register adds the workload of a problem. It is called from the init
+// functions of the files holding them.
+func register(problem string, w Workload) {
+	workloads[problem] = w
+}
+
+// Lookup returns the workload of the named problem.
+func Lookup(problem string) (Workload, bool) {
+	w, ok := workloads[problem]
+	return w, ok
+}
+
+// Problems returns the names of the problems that have a workload, sorted.
+func Problems() []string {
+	names := make([]string, 0, len(workloads))
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options configures a run.
+type Options struct {
+	// Addr is the address of the server under load.
+	Addr string
+
+	// Clients is the number of concurrent clients. If zero,
+	// DefaultClients is used.
+	Clients int
+
+	// Duration is how long the run lasts. If zero and Requests is zero,
+	// DefaultDuration is used.
+	Duration time.Duration
+
+	// Requests is the number of requests every client makes. If zero,
+	// clients make requests until the run is over.
+	Requests int
+
+	// Rate is the number of requests per second every client makes. If
+	// zero, clients make requests as fast as they are answered.
+	Rate float64
+
+	// Timeout is how long a request may take. If zero, DefaultTimeout is
+	// used.
+	Timeout time.Duration
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Clients  int
+	Duration time.Duration
+	Requests int
+
+	// Errors counts failed requests and connections by class.
+	Errors map[string]int
+
+	// Latencies is the distribution of the latencies of successful
+	// requests.
+	Latencies Histogram
+}
+
+// Throughput returns the successful requests per second.
+func (r *Report) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// ErrorCount returns the number of errors of every class.
+func (r *Report) ErrorCount() int {
+	n := 0
+	for _, c := range r.Errors {
+		n += c
+	}
+	return n
+}
+
+// Percentile returns the latency below which p percent of the successful
+// requests completed, or zero if none did.
+func (r *Report) Percentile(p float64) time.Duration {
+	return r.Latencies.Percentile(p)
+}
+
+// WriteTo writes a summary of r to w.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "clients   %d\n", r.Clients)
+	fmt.Fprintf(&b, "duration  %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "requests  %d (%.1f/s)\n", r.Requests, r.Throughput())
+
+	fmt.Fprintf(&b, "errors    %d", r.ErrorCount())
+	if len(r.Errors) > 0 {
+		classes := make([]string, 0, len(r.Errors))
+		for class, n := range r.Errors {
+			classes = append(classes, fmt.Sprintf("%s %d", class, n))
+		}
+		sort.Strings(classes)
+		fmt.Fprintf(&b, " (%s)", strings.Join(classes, ", "))
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "latency   p50 %s  p90 %s  p99 %s  max %s\n",
+		round(r.Percentile(50)), round(r.Percentile(90)), round(r.Percentile(99)), round(r.Latencies.Max()))
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
+
+// Run drives the traffic of w against the server until the run is over or
+// ctx is done.
+func Run(ctx context.Context, w Workload, opts Options) *Report {
+	if opts.Clients <= 0 {
+		opts.Clients = DefaultClients
+	}
+	if opts.Duration <= 0 && opts.Requests <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var (
+		mu     sync.Mutex
+		report = Report{Clients: opts.Clients, Errors: make(map[string]int)}
+		wg     sync.WaitGroup
+	)
+	start := time.Now()
+	for id := 0; id < opts.Clients; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			r := runClient(ctx, w, opts, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Requests += r.Requests
+			report.Latencies.Merge(&r.Latencies)
+			for class, n := range r.Errors {
+				report.Errors[class] += n
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	return &report
+}
+
+// runClient makes the requests of one client, reconnecting after errors.
+func runClient(ctx context.Context, w Workload, opts Options, id int) Report {
+	r := Report{Errors: make(map[string]int)}
+
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+	next := time.Now()
+
+	var c Client
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+
+	for done := 0; opts.Requests <= 0 || done < opts.Requests; done++ {
+		if interval > 0 {
+			if !sleep(ctx, time.Until(next)) {
+				return r
+			}
+			next = next.Add(interval)
+		}
+		if ctx.Err() != nil {
+			return r
+		}
+
+		if c == nil {
+			dialCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+			var err error
+			c, err = w.Dial(dialCtx, opts.Addr, id)
+			cancel()
+			if err != nil {
+				c = nil
+				if ctx.Err() != nil {
+					return r
+				}
+				r.Errors[ErrorConnect]++
+				sleep(ctx, reconnectDelay)
+				continue
+			}
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		start := time.Now()
+		err := c.Do(reqCtx)
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			// Requests cut short by the end of the run are not failures.
+			if ctx.Err() != nil {
+				return r
+			}
+			r.Errors[classify(err)]++
+			c.Close()
+			c = nil
+			continue
+		}
+
+		r.Requests++
+		r.Latencies.Record(elapsed)
+	}
+	return r
+}
+
+func classify(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errUnexpectedResponse):
+		return ErrorResponse
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	default:
+		return ErrorIO
+	}
+}
+
+// sleep waits for d, and reports whether ctx is still live afterwards.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// dial connects to addr over network, for Workload.Dial implementations.
+func dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+// bind applies the deadline of ctx to the connections and interrupts them
+// when ctx is done, until the returned function is called.
+func bind(ctx context.Context, conns ...net.Conn) (stop func()) {
+	deadline, _ := ctx.Deadline()
+	for _, conn := range conns {
+		conn.SetDeadline(deadline)
+	}
+	unwatch := context.AfterFunc(ctx, func() {
+		for _, conn := range conns {
+			conn.SetDeadline(time.Now())
+		}
+	})
+	return func() { unwatch() }
+}
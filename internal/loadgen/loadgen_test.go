@@ -0,0 +1,260 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	w, _ := Lookup("smoketest")
+	report := Run(context.Background(), w, Options{Addr: ln.Addr().String(), Clients: 3, Requests: 10})
+	if report.Requests != 30 || report.ErrorCount() != 0 {
+		t.Errorf("Run() made %d requests with errors %v, want 30 without errors", report.Requests, report.Errors)
+	}
+	if got := report.Latencies.Count(); got != 30 {
+		t.Errorf("Run() recorded %d latencies, want 30", got)
+	}
+
+	// Nothing listens at the address of a closed listener.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	closed.Close()
+	report = Run(context.Background(), w, Options{Addr: closed.Addr().String(), Clients: 2, Requests: 3})
+	if report.Requests != 0 || report.Errors[ErrorConnect] != 6 {
+		t.Errorf("Run() against no server made %d requests with errors %v, want 6 connect errors", report.Requests, report.Errors)
+	}
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	r := &Report{
+		Clients:  2,
+		Duration: 2 * time.Second,
+		Requests: 100,
+		Errors:   map[string]int{ErrorTimeout: 2, ErrorIO: 1},
+	}
+	for i := 1; i <= 100; i++ {
+		r.Latencies.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{99.5, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		// Latencies are bucketed, so percentiles are known to within 1%.
+		if got := r.Percentile(tt.p); got < tt.want || got > tt.want+tt.want/100 {
+			t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	want := "clients   2\n" +
+		"duration  2s\n" +
+		"requests  100 (50.0/s)\n" +
+		"errors    3 (io 1, timeout 2)\n" +
+		"latency   p50 50.07ms  p90 90.18ms  p99 99.09ms  max 100ms\n"
+	if b.String() != want {
+		t.Errorf("WriteTo() wrote\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+
+	var h, other Histogram
+	for d := time.Nanosecond; d < time.Hour; d = d*5/4 + 1 {
+		h.Record(d)
+		other.Record(d)
+	}
+	size := len(h.counts)
+	for i := 0; i < 100000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	if len(h.counts) != size {
+		t.Errorf("recording more latencies grew the histogram from %d to %d buckets", size, len(h.counts))
+	}
+
+	n := h.Count()
+	h.Merge(&other)
+	if got, want := h.Count(), n+other.Count(); got != want {
+		t.Errorf("Count() after Merge() = %d, want %d", got, want)
+	}
+	if got := h.Percentile(100); got != h.Max() {
+		t.Errorf("Percentile(100) = %v, want Max() = %v", got, h.Max())
+	}
+
+	// Every value falls in a bucket whose highest value is within 1/128
+	// of it.
+	for v := uint64(0); v < 1<<20; v = v*9/8 + 1 {
+		hi := bucketMax(bucket(v))
+		if hi < v || hi-v > v>>histogramSubBits {
+			t.Errorf("bucketMax(bucket(%d)) = %d", v, hi)
+		}
+	}
+
+	var empty Histogram
+	if got := empty.Percentile(50); got != 0 {
+		t.Errorf("Percentile(50) of an empty histogram = %v, want 0", got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{unexpected("wrong"), ErrorResponse},
+		{context.DeadlineExceeded, ErrorTimeout},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, ErrorTimeout},
+		{io.ErrUnexpectedEOF, ErrorIO},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// The speeddaemon workload has no server in this repository to run
+// against, so it is checked against a fake that fines every car seen twice.
+func TestSpeedDaemon(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go serveSpeedDaemon(ln)
+
+	w, _ := Lookup("speeddaemon")
+	report := Run(context.Background(), w, Options{Addr: ln.Addr().String(), Clients: 2, Requests: 5, Timeout: time.Second})
+	if report.Requests != 10 || report.ErrorCount() != 0 {
+		t.Errorf("Run() made %d requests with errors %v, want 10 without errors", report.Requests, report.Errors)
+	}
+}
+
+// serveSpeedDaemon is a fake Speed Daemon server that sends every
+// dispatcher of a road a ticket for each plate seen twice on it. Tickets
+// for roads without a dispatcher wait for one, as they do in a real server.
+func serveSpeedDaemon(ln net.Listener) {
+	var (
+		mu          sync.Mutex
+		seen        = make(map[string]bool)
+		dispatchers = make(map[[2]byte][]net.Conn)
+		pending     = make(map[[2]byte][][]byte)
+	)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+
+			r := bufio.NewReader(conn)
+			var road [2]byte
+			for {
+				t, err := r.ReadByte()
+				if err != nil {
+					return
+				}
+				switch t {
+				case speedTypeIAmCamera:
+					var b [6]byte
+					if _, err := io.ReadFull(r, b[:]); err != nil {
+						return
+					}
+					copy(road[:], b[:2])
+				case speedTypeIAmDispatcher:
+					var b [3]byte
+					if _, err := io.ReadFull(r, b[:]); err != nil {
+						return
+					}
+					copy(road[:], b[1:])
+					mu.Lock()
+					dispatchers[road] = append(dispatchers[road], conn)
+					for _, ticket := range pending[road] {
+						conn.Write(ticket)
+					}
+					delete(pending, road)
+					mu.Unlock()
+				case speedTypePlate:
+					plate, err := readSpeedString(r)
+					if err != nil {
+						return
+					}
+					var ts [4]byte
+					if _, err := io.ReadFull(r, ts[:]); err != nil {
+						return
+					}
+
+					mu.Lock()
+					if seen[plate] {
+						ticket := append([]byte{speedTypeTicket, byte(len(plate))}, plate...)
+						ticket = append(ticket, road[:]...)
+						ticket = append(ticket, make([]byte, 14)...)
+						for _, d := range dispatchers[road] {
+							d.Write(ticket)
+						}
+						if len(dispatchers[road]) == 0 {
+							pending[road] = append(pending[road], ticket)
+						}
+					}
+					seen[plate] = true
+					mu.Unlock()
+				default:
+					conn.Write([]byte{speedTypeError, 3, 'b', 'a', 'd'})
+					return
+				}
+			}
+		}()
+	}
+}
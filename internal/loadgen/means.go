@@ -0,0 +1,68 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+)
+
+func init() {
+	register("means", Workload{
+		Network: "tcp",
+		Dial: func(ctx context.Context, addr string, id int) (Client, error) {
+			conn, err := dial(ctx, "tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return &meansClient{conn: conn, rand: rand.New(rand.NewSource(int64(id)))}, nil
+		},
+	})
+}
+
+// meansClient inserts a price with every request and queries the mean of
+// all the prices it inserted.
+type meansClient struct {
+	conn net.Conn
+	rand *rand.Rand
+
+	timestamp int32
+	sum       int64
+	count     int64
+}
+
+func (c *meansClient) Do(ctx context.Context) error {
+	defer bind(ctx, c.conn)()
+
+	c.timestamp++
+	price := c.rand.Int31n(10000)
+
+	var b [18]byte
+	b[0] = 'I'
+	binary.BigEndian.PutUint32(b[1:], uint32(c.timestamp))
+	binary.BigEndian.PutUint32(b[5:], uint32(price))
+	b[9] = 'Q'
+	minTime, maxTime := int32(math.MinInt32), int32(math.MaxInt32)
+	binary.BigEndian.PutUint32(b[10:], uint32(minTime))
+	binary.BigEndian.PutUint32(b[14:], uint32(maxTime))
+	if _, err := c.conn.Write(b[:]); err != nil {
+		return err
+	}
+	c.sum += int64(price)
+	c.count++
+
+	if _, err := io.ReadFull(c.conn, b[:4]); err != nil {
+		return err
+	}
+	want := int32(c.sum / c.count)
+	if got := int32(binary.BigEndian.Uint32(b[:4])); got != want {
+		return unexpected("mean of %d prices is %d, want %d", c.count, got, want)
+	}
+	return nil
+}
+
+func (c *meansClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,58 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+func init() {
+	register("primetime", Workload{
+		Network: "tcp",
+		Dial: func(ctx context.Context, addr string, id int) (Client, error) {
+			conn, err := dial(ctx, "tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return &primeClient{
+				conn: conn,
+				r:    bufio.NewReader(conn),
+				rand: rand.New(rand.NewSource(int64(id))),
+			}, nil
+		},
+	})
+}
+
+// primeClient asks whether random numbers are prime.
+type primeClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	rand *rand.Rand
+}
+
+func (c *primeClient) Do(ctx context.Context) error {
+	defer bind(ctx, c.conn)()
+
+	n := c.rand.Int63n(1 << 40)
+	if _, err := fmt.Fprintf(c.conn, `{"method":"isPrime","number":%d}`+"\n", n); err != nil {
+		return err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	want := fmt.Sprintf(`{"method":"isPrime","prime":%t}`, big.NewInt(n).ProbablyPrime(20))
+	if got := strings.TrimSuffix(line, "\n"); got != want {
+		return unexpected("got %q for %d, want %q", got, n, want)
+	}
+	return nil
+}
+
+func (c *primeClient) Close() error {
+	return c.conn.Close()
+}
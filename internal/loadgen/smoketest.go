@@ -0,0 +1,54 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+)
+
+// echoPayloadSize is the size of the payloads echo clients send.
+const echoPayloadSize = 1024
+
+func init() {
+	register("smoketest", Workload{
+		Network: "tcp",
+		Dial: func(ctx context.Context, addr string, id int) (Client, error) {
+			conn, err := dial(ctx, "tcp", addr)
+			if err != nil {
+				return nil, err
+			}
+
+			c := &echoClient{conn: conn, payload: make([]byte, echoPayloadSize), buf: make([]byte, echoPayloadSize)}
+			rand.New(rand.NewSource(int64(id))).Read(c.payload)
+			return c, nil
+		},
+	})
+}
+
+// echoClient sends payloads and waits for them to come back.
+type echoClient struct {
+	conn    net.Conn
+	payload []byte
+	buf     []byte
+}
+
+func (c *echoClient) Do(ctx context.Context) error {
+	defer bind(ctx, c.conn)()
+
+	if _, err := c.conn.Write(c.payload); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c.conn, c.buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(c.buf, c.payload) {
+		return unexpected("echo differs from the payload")
+	}
+	return nil
+}
+
+func (c *echoClient) Close() error {
+	return c.conn.Close()
+}
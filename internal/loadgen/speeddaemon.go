@@ -0,0 +1,156 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+)
+
+// Speed Daemon message types.
+const (
+	speedTypeError         = 0x10
+	speedTypePlate         = 0x20
+	speedTypeTicket        = 0x21
+	speedTypeHeartbeat     = 0x41
+	speedTypeIAmCamera     = 0x80
+	speedTypeIAmDispatcher = 0x81
+)
+
+// speedLimit is the limit on the roads of the speed workload, in miles per
+// hour. Cars are seen a mile apart a minute apart, so every car is fined.
+const speedLimit = 30
+
+func init() {
+	register("speeddaemon", Workload{Network: "tcp", Dial: dialSpeedClient})
+}
+
+// speedClient runs a road of its own with two cameras and a dispatcher.
+// Every request is a speeding car seen by both cameras, and is answered by
+// the ticket the dispatcher receives.
+type speedClient struct {
+	cameras    [2]net.Conn
+	dispatcher net.Conn
+	r          *bufio.Reader
+	road       uint16
+	prefix     string
+	seq        int
+}
+
+func dialSpeedClient(ctx context.Context, addr string, id int) (Client, error) {
+	c := &speedClient{
+		road:   uint16(rand.Intn(1 << 16)),
+		prefix: fmt.Sprintf("LG%dX", id),
+	}
+
+	var err error
+	for mile := range c.cameras {
+		if c.cameras[mile], err = dial(ctx, "tcp", addr); err != nil {
+			c.Close()
+			return nil, err
+		}
+		msg := binary.BigEndian.AppendUint16([]byte{speedTypeIAmCamera}, c.road)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(mile))
+		msg = binary.BigEndian.AppendUint16(msg, speedLimit)
+		if _, err := c.cameras[mile].Write(msg); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if c.dispatcher, err = dial(ctx, "tcp", addr); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.r = bufio.NewReader(c.dispatcher)
+	msg := binary.BigEndian.AppendUint16([]byte{speedTypeIAmDispatcher, 1}, c.road)
+	if _, err := c.dispatcher.Write(msg); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *speedClient) Do(ctx context.Context) error {
+	defer bind(ctx, c.cameras[0], c.cameras[1], c.dispatcher)()
+
+	// Every car is new, so that none is fined twice on a day.
+	c.seq++
+	plate := fmt.Sprintf("%s%d", c.prefix, c.seq)
+	timestamp := uint32(c.seq) * 86400
+	for mile, conn := range c.cameras {
+		msg := append([]byte{speedTypePlate, byte(len(plate))}, plate...)
+		msg = binary.BigEndian.AppendUint32(msg, timestamp+uint32(mile)*60)
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+	}
+
+	for {
+		t, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case speedTypeTicket:
+			got, err := c.readTicket()
+			if err != nil {
+				return err
+			}
+			if got == plate {
+				return nil
+			}
+		case speedTypeHeartbeat:
+		case speedTypeError:
+			msg, err := readSpeedString(c.r)
+			if err != nil {
+				return err
+			}
+			return unexpected("error %q", msg)
+		default:
+			return unexpected("message type %#x", t)
+		}
+	}
+}
+
+// readTicket reads the body of a ticket and returns its plate.
+func (c *speedClient) readTicket() (string, error) {
+	plate, err := readSpeedString(c.r)
+	if err != nil {
+		return "", err
+	}
+	var b [16]byte // road, mile1, timestamp1, mile2, timestamp2, speed
+	if _, err := io.ReadFull(c.r, b[:]); err != nil {
+		return "", err
+	}
+	if road := binary.BigEndian.Uint16(b[:]); road != c.road {
+		return "", unexpected("ticket for road %d, want %d", road, c.road)
+	}
+	return plate, nil
+}
+
+func readSpeedString(r *bufio.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (c *speedClient) Close() error {
+	var errs []error
+	for _, conn := range append(c.cameras[:], c.dispatcher) {
+		if conn != nil {
+			errs = append(errs, conn.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
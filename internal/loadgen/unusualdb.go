@@ -0,0 +1,60 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+)
+
+// dbKeys is the number of keys every database client cycles through.
+const dbKeys = 100
+
+func init() {
+	register("unusualdb", Workload{
+		Network: "udp",
+		Dial: func(ctx context.Context, addr string, id int) (Client, error) {
+			conn, err := dial(ctx, "udp", addr)
+			if err != nil {
+				return nil, err
+			}
+			return &dbClient{conn: conn, prefix: fmt.Sprintf("loadgen-%d-%d", rand.Intn(1<<20), id), buf: make([]byte, 1000)}, nil
+		},
+	})
+}
+
+// dbClient inserts a value with every request and retrieves it. A lost
+// datagram shows up as a timeout.
+type dbClient struct {
+	conn   net.Conn
+	prefix string
+	buf    []byte
+	seq    int
+}
+
+func (c *dbClient) Do(ctx context.Context) error {
+	defer bind(ctx, c.conn)()
+
+	c.seq++
+	key := fmt.Sprintf("%s-%d", c.prefix, c.seq%dbKeys)
+	insert := fmt.Sprintf("%s=value %d", key, c.seq)
+	if _, err := c.conn.Write([]byte(insert)); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write([]byte(key)); err != nil {
+		return err
+	}
+
+	n, err := c.conn.Read(c.buf)
+	if err != nil {
+		return err
+	}
+	if got := string(c.buf[:n]); got != insert {
+		return unexpected("retrieved %q, want %q", got, insert)
+	}
+	return nil
+}
+
+func (c *dbClient) Close() error {
+	return c.conn.Close()
+}
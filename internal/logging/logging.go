@@ -0,0 +1,80 @@
+// Package logging sets up structured logging shared by all problem servers
+// and carries connection-scoped loggers through contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configure the logger built by New.
+type Options struct {
+	// Format is either FormatText or FormatJSON.
+	Format string
+
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Format, "log-format", FormatText, "log output format (text or json)")
+	fs.StringVar(&o.Level, "log-level", "info", "minimum log level (debug, info, warn or error)")
+}
+
+// New returns a logger writing to w according to the options.
+func (o Options) New(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if o.Level != "" {
+		if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", o.Level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(o.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", o.Format)
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger if
+// there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// NewConnID returns a random identifier for a connection.
+func NewConnID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("logging: failed to generate connection ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
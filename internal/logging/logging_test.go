@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestOptions_New(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		opts    Options
+		check   func(t *testing.T, out string)
+		wantErr bool
+	}{
+		{
+			name: "json",
+			opts: Options{Format: FormatJSON, Level: "info"},
+			check: func(t *testing.T, out string) {
+				var entry map[string]any
+				if err := json.Unmarshal([]byte(out), &entry); err != nil {
+					t.Fatalf("output is not JSON: %v", err)
+				}
+				if entry["msg"] != "hello" || entry["conn_id"] != "abc" {
+					t.Errorf("entry = %v", entry)
+				}
+			},
+		},
+		{
+			name: "text",
+			opts: Options{Format: "TEXT", Level: "info"},
+			check: func(t *testing.T, out string) {
+				if !strings.Contains(out, "msg=hello conn_id=abc") {
+					t.Errorf("output = %q", out)
+				}
+			},
+		},
+		{
+			name: "level filters",
+			opts: Options{Level: "warn"},
+			check: func(t *testing.T, out string) {
+				if out != "" {
+					t.Errorf("output = %q, want nothing", out)
+				}
+			},
+		},
+		{
+			name:    "invalid level",
+			opts:    Options{Level: "loud"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid format",
+			opts:    Options{Format: "xml"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			logger, err := tt.opts.New(&buf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			logger.Info("hello", slog.String("conn_id", "abc"))
+			tt.check(t, buf.String())
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Errorf("FromContext() = %v, want the default logger", got)
+	}
+
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if got := FromContext(NewContext(context.Background(), logger)); got != logger {
+		t.Errorf("FromContext() = %v, want %v", got, logger)
+	}
+}
+
+func TestNewConnID(t *testing.T) {
+	t.Parallel()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewConnID()
+		if len(id) != 16 {
+			t.Fatalf("NewConnID() = %q, want 16 hex characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewConnID() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,351 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text exposition format.
+//
+// Only the small subset of the Prometheus data model used by the servers is
+// supported, so that no client library is needed.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram buckets suited to request latencies in
+// seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// NewCounterVec registers a counter family in the Default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewGaugeVec registers a gauge family in the Default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewHistogramVec registers a histogram family in the Default registry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Registry is a set of metric families.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// NewCounterVec registers a counter family. It panics if name is already
+// registered.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	f := r.register(name, help, "counter", labels, func() metric { return &Counter{} })
+	return &CounterVec{f}
+}
+
+// NewGaugeVec registers a gauge family. It panics if name is already
+// registered.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	f := r.register(name, help, "gauge", labels, func() metric { return &Gauge{} })
+	return &GaugeVec{f}
+}
+
+// NewHistogramVec registers a histogram family with the given upper bucket
+// bounds. It panics if name is already registered.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	f := r.register(name, help, "histogram", labels, func() metric {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})
+	return &HistogramVec{f}
+}
+
+func (r *Registry) register(name, help, typ string, labels []string, newMetric func() metric) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metrics: %s already registered", name))
+	}
+
+	f := &family{
+		name:      name,
+		help:      help,
+		typ:       typ,
+		labels:    labels,
+		newMetric: newMetric,
+		metrics:   make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+type metric interface {
+	write(b *strings.Builder, name, labels string)
+}
+
+type series struct {
+	labels string
+	metric metric
+}
+
+type family struct {
+	name      string
+	help      string
+	typ       string
+	labels    []string
+	newMetric func() metric
+
+	mu      sync.RWMutex
+	metrics map[string]*series
+}
+
+func (f *family) with(values []string) metric {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.metrics[key]
+	f.mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.metrics[key]; ok {
+		return s.metric
+	}
+	s = &series{labels: formatLabels(f.labels, values), metric: f.newMetric()}
+	f.metrics[key] = s
+	return s.metric
+}
+
+func (f *family) write(b *strings.Builder) {
+	f.mu.RLock()
+	all := make([]*series, 0, len(f.metrics))
+	for _, s := range f.metrics {
+		all = append(all, s)
+	}
+	f.mu.RUnlock()
+
+	if len(all) == 0 {
+		return
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].labels < all[j].labels })
+
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range all {
+		s.metric.write(b, f.name, s.labels)
+	}
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct{ f *family }
+
+// With returns the counter for the given label values, creating it if needed.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.f.with(values).(*Counter)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+func (c *Counter) write(b *strings.Builder, name, labels string) {
+	fmt.Fprintf(b, "%s%s %d\n", name, labels, c.Value())
+}
+
+// GaugeVec is a family of gauges partitioned by label values.
+type GaugeVec struct{ f *family }
+
+// With returns the gauge for the given label values, creating it if needed.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.f.with(values).(*Gauge)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+// Set sets the gauge to n.
+func (g *Gauge) Set(n int64) {
+	g.v.Store(n)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+func (g *Gauge) write(b *strings.Builder, name, labels string) {
+	fmt.Fprintf(b, "%s%s %d\n", name, labels, g.Value())
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct{ f *family }
+
+// With returns the histogram for the given label values, creating it if
+// needed.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.f.with(values).(*Histogram)
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.count
+}
+
+func (h *Histogram) write(b *strings.Builder, name, labels string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(bound)), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), count)
+	fmt.Fprintf(b, "%s_sum%s %s\n", name, labels, formatFloat(sum))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, labels, count)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends a label to an already formatted label set.
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("requests_total", "Requests handled.", "method")
+	requests.With("insert").Add(3)
+	requests.With("query").Inc()
+
+	active := r.NewGaugeVec("active", "Active sessions.")
+	active.With().Inc()
+	active.With().Inc()
+	active.With().Dec()
+
+	latency := r.NewHistogramVec("latency_seconds", "Handler latency.", []float64{1, 0.1}, "server")
+	latency.With("echo").Observe(0.05)
+	latency.With("echo").Observe(0.1)
+	latency.With("echo").Observe(0.5)
+	latency.With("echo").Observe(2)
+
+	escaped := r.NewCounterVec("escaped_total", "Help with \\ and\nnewline.", "value")
+	escaped.With("a\"b\\c\nd").Inc()
+
+	// Families without series are omitted.
+	r.NewCounterVec("unused_total", "Never incremented.", "label")
+
+	want := `# HELP active Active sessions.
+# TYPE active gauge
+active 1
+# HELP escaped_total Help with \\ and\nnewline.
+# TYPE escaped_total counter
+escaped_total{value="a\"b\\c\nd"} 1
+# HELP latency_seconds Handler latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{server="echo",le="0.1"} 2
+latency_seconds_bucket{server="echo",le="1"} 3
+latency_seconds_bucket{server="echo",le="+Inf"} 4
+latency_seconds_sum{server="echo"} 2.65
+latency_seconds_count{server="echo"} 4
+# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{method="insert"} 3
+requests_total{method="query"} 1
+`
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo() got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_duplicate(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "First.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name did not panic")
+		}
+	}()
+	r.NewGaugeVec("dup_total", "Second.")
+}
+
+func TestCounter_concurrent(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	c := r.NewCounterVec("concurrent_total", "Concurrent increments.", "worker")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.With("shared").Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := c.With("shared").Value(); got != 10000 {
+		t.Errorf("Value() = %d, want %d", got, 10000)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	r.NewCounterVec("hits_total", "Hits.").With().Inc()
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != contentType {
+		t.Errorf("Content-Type = %q, want %q", got, contentType)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if !strings.Contains(string(body), "hits_total 1\n") {
+		t.Errorf("body = %q, want it to contain %q", body, "hits_total 1\n")
+	}
+
+	res, err = http.Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
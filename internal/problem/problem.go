@@ -0,0 +1,138 @@
+// Package problem describes the solutions served by the protohackers
+// command.
+package problem
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+// Networks a problem can be served over.
+const (
+	NetworkTCP  = "tcp"
+	NetworkUDP  = "udp"
+	NetworkUnix = "unix"
+	NetworkHTTP = "http"
+)
+
+// A Problem is a solution to one of the protohackers.com problems.
+//
+// A problem is served over TCP and Unix sockets if NewServer is set, and
+// over UDP if NewPacketServer is set. A problem may have both, and one with
+// neither has no server yet. A problem with NewServer is also served over
+// HTTP if NewHTTPHandler is set.
+type Problem struct {
+	// Number is the problem number on protohackers.com.
+	Number int
+
+	// Name is the name the problem is served by, such as "smoketest".
+	Name string
+
+	// Aliases are alternative names accepted in place of Name.
+	Aliases []string
+
+	// Title is the problem title on protohackers.com.
+	Title string
+
+	// NewOptions, if set, returns the problem-specific settings at their
+	// defaults. Each server gets a value of its own, so that servers of
+	// the same problem may be configured differently.
+	NewOptions func() Options
+
+	// NewServer returns a server with the handler and default settings of
+	// the problem, configured by opts: a value returned by NewOptions, or
+	// nil if the problem has none. Work the problem runs in the
+	// background, such as a chat room, must stop when ctx is done.
+	// Callers keep ctx alive until the server has drained its
+	// connections, which may still rely on that work. The logger carried
+	// by ctx is the one the server logs to.
+	NewServer func(ctx context.Context, opts Options) (*server.Server, error)
+
+	// NewPacketServer is the counterpart of NewServer for problems served
+	// over UDP.
+	NewPacketServer func(ctx context.Context, opts Options) (*server.PacketServer, error)
+
+	// NewHTTPHandler returns the handler of an HTTP gateway to srv, a
+	// server returned by NewServer. The gateway shares the connection
+	// limits and timeouts of srv, and whatever state its handler holds.
+	NewHTTPHandler func(srv *server.Server) (http.Handler, error)
+}
+
+// Options are the problem-specific settings of a server.
+type Options interface {
+	// RegisterFlags registers flags on fs that set the options.
+	RegisterFlags(fs *flag.FlagSet)
+}
+
+// Options returns new problem-specific settings at their defaults, or nil
+// if the problem has none.
+func (p Problem) Options() Options {
+	if p.NewOptions == nil {
+		return nil
+	}
+	return p.NewOptions()
+}
+
+// Network returns the network the problem is served over by default, or an
+// empty string if the problem has no server. TCP takes precedence over UDP.
+func (p Problem) Network() string {
+	switch {
+	case p.NewServer != nil:
+		return NetworkTCP
+	case p.NewPacketServer != nil:
+		return NetworkUDP
+	default:
+		return ""
+	}
+}
+
+// Serves reports whether the problem can be served over network.
+func (p Problem) Serves(network string) bool {
+	switch network {
+	case NetworkTCP, NetworkUnix:
+		return p.NewServer != nil
+	case NetworkUDP:
+		return p.NewPacketServer != nil
+	case NetworkHTTP:
+		return p.NewServer != nil && p.NewHTTPHandler != nil
+	default:
+		return false
+	}
+}
+
+// Matches reports whether s refers to the problem by number, name or alias.
+// Names are matched case-insensitively.
+func (p Problem) Matches(s string) bool {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n == p.Number
+	}
+	if strings.EqualFold(s, p.Name) {
+		return true
+	}
+	for _, alias := range p.Aliases {
+		if strings.EqualFold(s, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%02d %s", p.Number, p.Name)
+}
+
+// Lookup returns the problem among problems that s refers to.
+func Lookup(problems []Problem, s string) (Problem, bool) {
+	for _, p := range problems {
+		if p.Matches(s) {
+			return p, true
+		}
+	}
+	return Problem{}, false
+}
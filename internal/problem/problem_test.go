@@ -0,0 +1,90 @@
+package problem
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sklyar/protohackers/internal/server"
+)
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	problems := []Problem{
+		{
+			Number:  0,
+			Name:    "smoketest",
+			Aliases: []string{"echo"},
+			NewServer: func(context.Context, Options) (*server.Server, error) {
+				return &server.Server{}, nil
+			},
+		},
+		{
+			Number: 6,
+			Name:   "speeddaemon",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantOK  bool
+		wantNet string
+	}{
+		{name: "number", s: "0", want: "smoketest", wantOK: true, wantNet: NetworkTCP},
+		{name: "padded number", s: "06", want: "speeddaemon", wantOK: true},
+		{name: "name", s: "SmokeTest", want: "smoketest", wantOK: true, wantNet: NetworkTCP},
+		{name: "alias", s: "echo", want: "smoketest", wantOK: true, wantNet: NetworkTCP},
+		{name: "unknown number", s: "7"},
+		{name: "unknown name", s: "speed"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, ok := Lookup(problems, tt.s)
+			if ok != tt.wantOK || p.Name != tt.want {
+				t.Fatalf("Lookup(%q) = %q, %v, want %q, %v", tt.s, p.Name, ok, tt.want, tt.wantOK)
+			}
+			if got := p.Network(); got != tt.wantNet {
+				t.Errorf("Network() = %q, want %q", got, tt.wantNet)
+			}
+		})
+	}
+}
+
+func TestProblem_Serves(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(context.Context, Options) (*server.Server, error) { return &server.Server{}, nil }
+	newPacketServer := func(context.Context, Options) (*server.PacketServer, error) { return &server.PacketServer{}, nil }
+	newHTTPHandler := func(*server.Server) (http.Handler, error) { return http.NotFoundHandler(), nil }
+
+	tests := []struct {
+		name    string
+		p       Problem
+		network string
+		want    bool
+	}{
+		{name: "tcp", p: Problem{NewServer: newServer}, network: NetworkTCP, want: true},
+		{name: "unix", p: Problem{NewServer: newServer}, network: NetworkUnix, want: true},
+		{name: "udp without packet server", p: Problem{NewServer: newServer}, network: NetworkUDP},
+		{name: "udp", p: Problem{NewPacketServer: newPacketServer}, network: NetworkUDP, want: true},
+		{name: "unix without server", p: Problem{NewPacketServer: newPacketServer}, network: NetworkUnix},
+		{name: "no server", network: NetworkTCP},
+		{name: "http", p: Problem{NewServer: newServer, NewHTTPHandler: newHTTPHandler}, network: NetworkHTTP, want: true},
+		{name: "http without handler", p: Problem{NewServer: newServer}, network: NetworkHTTP},
+		{name: "http without server", p: Problem{NewHTTPHandler: newHTTPHandler}, network: NetworkHTTP},
+		{name: "unknown network", p: Problem{NewServer: newServer}, network: "sctp"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.Serves(tt.network); got != tt.want {
+			t.Errorf("%s: Serves(%q) = %v, want %v", tt.name, tt.network, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout is how long Listener waits for the header of a
+// connection when no timeout is given.
+const DefaultHeaderTimeout = 5 * time.Second
+
+// DefaultMaxPending is how many headers Listener reads at once when no
+// limit is given.
+const DefaultMaxPending = 256
+
+// Listener returns a listener that reads a PROXY protocol header from every
+// connection it accepts. The accepted connections report the addresses
+// from the header as their remote and local addresses, and read what
+// follows the header.
+//
+// Headers are read in the background, so that a slow peer does not hold
+// up the others. Connections whose header is missing, malformed or does
+// not arrive within timeout are closed and logged to logger; if timeout is
+// zero, DefaultHeaderTimeout is used.
+//
+// Connections waiting for their header are not yet seen by the server and
+// its connection limits, so at most maxPending of them are kept; further
+// connections are closed as soon as they are accepted. If maxPending is
+// zero, DefaultMaxPending is used.
+func Listener(ln net.Listener, timeout time.Duration, maxPending int, logger *slog.Logger) net.Listener {
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPending
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	l := &listener{
+		Listener: ln,
+		timeout:  timeout,
+		logger:   logger,
+		pending:  make(chan struct{}, maxPending),
+		accepted: make(chan accepted),
+		done:     make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+type accepted struct {
+	conn net.Conn
+	err  error
+}
+
+type listener struct {
+	net.Listener
+	timeout time.Duration
+	logger  *slog.Logger
+
+	pending   chan struct{} // a token per header being read
+	accepted  chan accepted
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *listener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if !l.deliver(accepted{err: err}) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case l.pending <- struct{}{}:
+			go l.readHeader(conn)
+		default:
+			l.logger.Warn("rejected connection: too many pending PROXY protocol headers",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+			)
+			conn.Close()
+		}
+	}
+}
+
+func (l *listener) readHeader(conn net.Conn) {
+	defer func() { <-l.pending }()
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(l.timeout))
+	h, err := Read(r)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		l.logger.Warn("rejected connection without a valid PROXY protocol header",
+			slog.String("remote_addr", conn.RemoteAddr().String()),
+			slog.Any("err", err),
+		)
+		conn.Close()
+		return
+	}
+
+	c := &proxyConn{Conn: conn, r: r, remote: h.Source, local: h.Destination}
+	if !l.deliver(accepted{conn: c}) {
+		conn.Close()
+	}
+}
+
+// deliver hands a to Accept. It reports false if the listener was closed
+// first.
+func (l *listener) deliver(a accepted) bool {
+	select {
+	case l.accepted <- a:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case a := <-l.accepted:
+		return a.conn, a.err
+	case <-l.done:
+		return nil, &net.OpError{Op: "accept", Net: l.Addr().Network(), Addr: l.Addr(), Err: net.ErrClosed}
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// proxyConn is a connection whose header was read. It reports the
+// addresses from the header, if it has any.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// NetConn returns the connection the header was read from.
+func (c *proxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// CloseWrite shuts down the writing side of the connection if it supports
+// that.
+func (c *proxyConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
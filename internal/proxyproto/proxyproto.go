@@ -0,0 +1,269 @@
+// Package proxyproto reads and writes the headers of the HAProxy PROXY
+// protocol, versions 1 and 2, which load balancers put in front of the
+// connections they relay to tell the server the address of the client.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidHeader is returned for data that is not a valid PROXY protocol
+// header.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+const (
+	// maxV1Len is the length of the longest version 1 header, CRLF
+	// included.
+	maxV1Len = 107
+
+	v1Prefix = "PROXY "
+)
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Version 2 commands, address families and transport protocols.
+const (
+	v2CommandLocal = 0x0
+	v2CommandProxy = 0x1
+
+	v2FamilyUnspec = 0x0
+	v2FamilyInet   = 0x1
+	v2FamilyInet6  = 0x2
+	v2FamilyUnix   = 0x3
+
+	v2ProtoStream = 0x1
+	v2ProtoDgram  = 0x2
+)
+
+// A Header is a PROXY protocol header.
+type Header struct {
+	// Version is 1 for the text format and 2 for the binary one.
+	Version int
+
+	// Source is the address of the client and Destination the address it
+	// connected to. Both are nil if the header does not carry addresses:
+	// a version 1 UNKNOWN header, a version 2 LOCAL one such as a health
+	// check, or addresses of a family this package does not read.
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// Read reads a version 1 or 2 header from r, consuming nothing after it.
+// Errors about the header itself wrap ErrInvalidHeader.
+func Read(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case v1Prefix[0]:
+		return readV1(r)
+	case v2Signature[0]:
+		return readV2(r)
+	default:
+		return nil, fmt.Errorf("%w: no PROXY protocol signature", ErrInvalidHeader)
+	}
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) == maxV1Len {
+			return nil, fmt.Errorf("%w: longer than %d bytes", ErrInvalidHeader, maxV1Len)
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok || !strings.HasPrefix(s, v1Prefix) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	fields := strings.Split(s[len(v1Prefix):], " ")
+	if fields[0] == "UNKNOWN" {
+		// The rest of an UNKNOWN header is to be ignored.
+		return &Header{Version: 1}, nil
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	var wantV4 bool
+	switch fields[0] {
+	case "TCP4":
+		wantV4 = true
+	case "TCP6":
+	default:
+		return nil, fmt.Errorf("%w: unknown protocol %q", ErrInvalidHeader, fields[0])
+	}
+	src, err := parseV1Addr(fields[1], fields[3], wantV4)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[2], fields[4], wantV4)
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Version: 1, Source: src, Destination: dst}, nil
+}
+
+func parseV1Addr(ip, port string, wantV4 bool) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (addr.To4() != nil) != wantV4 || (wantV4 && strings.Contains(ip, ":")) {
+		return nil, fmt.Errorf("%w: invalid address %q", ErrInvalidHeader, ip)
+	}
+	// Ports are decimal without leading zeros.
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, fmt.Errorf("%w: invalid port %q", ErrInvalidHeader, port)
+	}
+	if wantV4 {
+		addr = addr.To4()
+	}
+	return &net.TCPAddr{IP: addr, Port: int(n)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(fixed[:12], v2Signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidHeader)
+	}
+	if version := fixed[12] >> 4; version != 2 {
+		return nil, fmt.Errorf("%w: version %d", ErrInvalidHeader, version)
+	}
+	command := fixed[12] & 0xf
+	family, proto := fixed[13]>>4, fixed[13]&0xf
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	h := &Header{Version: 2}
+	switch command {
+	case v2CommandLocal:
+		return h, nil
+	case v2CommandProxy:
+	default:
+		return nil, fmt.Errorf("%w: unknown command %d", ErrInvalidHeader, command)
+	}
+
+	var size int
+	switch family {
+	case v2FamilyUnspec:
+		return h, nil
+	case v2FamilyInet:
+		size = 2*net.IPv4len + 4
+	case v2FamilyInet6:
+		size = 2*net.IPv6len + 4
+	case v2FamilyUnix:
+		size = 2 * 108
+	default:
+		return nil, fmt.Errorf("%w: unknown address family %d", ErrInvalidHeader, family)
+	}
+	if proto != v2ProtoStream && proto != v2ProtoDgram {
+		return nil, fmt.Errorf("%w: unknown transport protocol %d", ErrInvalidHeader, proto)
+	}
+	// Type-length-value fields may follow the addresses; they are
+	// skipped.
+	if len(payload) < size {
+		return nil, fmt.Errorf("%w: %d bytes of addresses, want %d", ErrInvalidHeader, len(payload), size)
+	}
+
+	switch family {
+	case v2FamilyInet, v2FamilyInet6:
+		n := size/2 - 2
+		srcIP, dstIP := net.IP(payload[:n]), net.IP(payload[n:2*n])
+		srcPort := int(binary.BigEndian.Uint16(payload[2*n:]))
+		dstPort := int(binary.BigEndian.Uint16(payload[2*n+2:]))
+		if proto == v2ProtoStream {
+			h.Source, h.Destination = &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+		} else {
+			h.Source, h.Destination = &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+		}
+	case v2FamilyUnix:
+		network := "unix"
+		if proto == v2ProtoDgram {
+			network = "unixgram"
+		}
+		h.Source = &net.UnixAddr{Name: unixPath(payload[:108]), Net: network}
+		h.Destination = &net.UnixAddr{Name: unixPath(payload[108:216]), Net: network}
+	}
+	return h, nil
+}
+
+func unixPath(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// Format returns the header encoded in its version. Addresses other than
+// TCP ones, or a missing address, are sent as UNKNOWN in version 1 and
+// without addresses in version 2, so the receiver falls back to the
+// addresses of the connection.
+func (h *Header) Format() ([]byte, error) {
+	src, srcOK := h.Source.(*net.TCPAddr)
+	dst, dstOK := h.Destination.(*net.TCPAddr)
+	ok := srcOK && dstOK && src != nil && dst != nil
+	v4 := ok && src.IP.To4() != nil && dst.IP.To4() != nil
+
+	switch h.Version {
+	case 1:
+		switch {
+		case !ok:
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		case v4:
+			return fmt.Appendf(nil, "PROXY TCP4 %s %s %d %d\r\n", src.IP.To4(), dst.IP.To4(), src.Port, dst.Port), nil
+		default:
+			return fmt.Appendf(nil, "PROXY TCP6 %s %s %d %d\r\n", src.IP.To16(), dst.IP.To16(), src.Port, dst.Port), nil
+		}
+
+	case 2:
+		b := append([]byte(nil), v2Signature...)
+		b = append(b, 2<<4|v2CommandProxy)
+		var addrs []byte
+		switch {
+		case !ok:
+			b = append(b, v2FamilyUnspec<<4)
+		case v4:
+			b = append(b, v2FamilyInet<<4|v2ProtoStream)
+			addrs = append(addrs, src.IP.To4()...)
+			addrs = append(addrs, dst.IP.To4()...)
+		default:
+			b = append(b, v2FamilyInet6<<4|v2ProtoStream)
+			addrs = append(addrs, src.IP.To16()...)
+			addrs = append(addrs, dst.IP.To16()...)
+		}
+		if ok {
+			addrs = binary.BigEndian.AppendUint16(addrs, uint16(src.Port))
+			addrs = binary.BigEndian.AppendUint16(addrs, uint16(dst.Port))
+		}
+		b = binary.BigEndian.AppendUint16(b, uint16(len(addrs)))
+		return append(b, addrs...), nil
+
+	default:
+		return nil, fmt.Errorf("unknown PROXY protocol version %d", h.Version)
+	}
+}
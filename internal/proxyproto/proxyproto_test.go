@@ -0,0 +1,238 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	v2 := func(command, family byte, payload ...byte) string {
+		b := append([]byte(nil), v2Signature...)
+		b = append(b, 2<<4|command, family)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+		return string(append(b, payload...))
+	}
+	inet := []byte{192, 0, 2, 1, 198, 51, 100, 7, 0x30, 0x39, 0x1f, 0x90}
+	inet6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x30, 0x39, 0x1f, 0x90)
+	unix := make([]byte, 216)
+	copy(unix, "/run/client.sock")
+	copy(unix[108:], "/run/server.sock")
+
+	tests := []struct {
+		name    string
+		in      string
+		wantSrc string
+		wantDst string
+		wantErr string
+	}{
+		{name: "v1 tcp4", in: "PROXY TCP4 192.0.2.1 198.51.100.7 12345 8080\r\n", wantSrc: "192.0.2.1:12345", wantDst: "198.51.100.7:8080"},
+		{name: "v1 tcp6", in: "PROXY TCP6 2001:db8::1 2001:db8::2 12345 8080\r\n", wantSrc: "[2001:db8::1]:12345", wantDst: "[2001:db8::2]:8080"},
+		{name: "v1 unknown", in: "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"},
+		{name: "v2 inet", in: v2(v2CommandProxy, v2FamilyInet<<4|v2ProtoStream, inet...), wantSrc: "192.0.2.1:12345", wantDst: "198.51.100.7:8080"},
+		{name: "v2 inet6", in: v2(v2CommandProxy, v2FamilyInet6<<4|v2ProtoStream, inet6...), wantSrc: "[2001:db8::1]:12345", wantDst: "[2001:db8::2]:8080"},
+		{name: "v2 unix", in: v2(v2CommandProxy, v2FamilyUnix<<4|v2ProtoStream, unix...), wantSrc: "/run/client.sock", wantDst: "/run/server.sock"},
+		{name: "v2 with tlvs", in: v2(v2CommandProxy, v2FamilyInet<<4|v2ProtoStream, append(inet, 0x04, 0, 1, 'x')...), wantSrc: "192.0.2.1:12345", wantDst: "198.51.100.7:8080"},
+		{name: "v2 local", in: v2(v2CommandLocal, v2FamilyUnspec)},
+		{name: "v2 unspec", in: v2(v2CommandProxy, v2FamilyUnspec)},
+		{name: "no header", in: "hello\n", wantErr: "no PROXY protocol signature"},
+		{name: "v1 without crlf", in: "PROXY TCP4 192.0.2.1 198.51.100.7 12345 8080\n", wantErr: "invalid PROXY protocol header"},
+		{name: "v1 too long", in: "PROXY UNKNOWN " + strings.Repeat("x", 100) + "\r\n", wantErr: "longer than 107 bytes"},
+		{name: "v1 not proxy", in: "POST / HTTP/1.1\r\n", wantErr: "invalid PROXY protocol header"},
+		{name: "v1 unknown protocol", in: "PROXY UDP4 192.0.2.1 198.51.100.7 12345 8080\r\n", wantErr: `unknown protocol "UDP4"`},
+		{name: "v1 missing port", in: "PROXY TCP4 192.0.2.1 198.51.100.7 12345\r\n", wantErr: "invalid PROXY protocol header"},
+		{name: "v1 wrong family", in: "PROXY TCP4 2001:db8::1 198.51.100.7 12345 8080\r\n", wantErr: `invalid address "2001:db8::1"`},
+		{name: "v1 bad address", in: "PROXY TCP4 192.0.2 198.51.100.7 12345 8080\r\n", wantErr: `invalid address "192.0.2"`},
+		{name: "v1 port out of range", in: "PROXY TCP4 192.0.2.1 198.51.100.7 65536 8080\r\n", wantErr: `invalid port "65536"`},
+		{name: "v1 port with leading zero", in: "PROXY TCP4 192.0.2.1 198.51.100.7 080 8080\r\n", wantErr: `invalid port "080"`},
+		{name: "v1 double space", in: "PROXY TCP4  192.0.2.1 198.51.100.7 12345 8080\r\n", wantErr: "invalid PROXY protocol header"},
+		{name: "v2 bad signature", in: "\r\n\r\n\x00\r\nQUIT!" + strings.Repeat("\x00", 4), wantErr: "bad signature"},
+		{name: "v2 wrong version", in: string(v2Signature) + "\x11\x11\x00\x00", wantErr: "version 1"},
+		{name: "v2 unknown command", in: v2(0x2, v2FamilyInet<<4|v2ProtoStream, inet...), wantErr: "unknown command 2"},
+		{name: "v2 unknown family", in: v2(v2CommandProxy, 0x4<<4|v2ProtoStream, inet...), wantErr: "unknown address family 4"},
+		{name: "v2 unknown protocol", in: v2(v2CommandProxy, v2FamilyInet<<4|0x3, inet...), wantErr: "unknown transport protocol 3"},
+		{name: "v2 short addresses", in: v2(v2CommandProxy, v2FamilyInet6<<4|v2ProtoStream, inet...), wantErr: "12 bytes of addresses, want 36"},
+		{name: "v2 truncated", in: v2(v2CommandProxy, v2FamilyInet<<4|v2ProtoStream, inet...)[:20], wantErr: io.ErrUnexpectedEOF.Error()},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := bufio.NewReader(strings.NewReader(tt.in + "rest"))
+			h, err := Read(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Read() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if got := addrString(h.Source); got != tt.wantSrc {
+				t.Errorf("Read() source = %q, want %q", got, tt.wantSrc)
+			}
+			if got := addrString(h.Destination); got != tt.wantDst {
+				t.Errorf("Read() destination = %q, want %q", got, tt.wantDst)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "rest" {
+				t.Errorf("Read() left %q, want %q", rest, "rest")
+			}
+		})
+	}
+}
+
+func TestRead_malformedWraps(t *testing.T) {
+	t.Parallel()
+
+	_, err := Read(bufio.NewReader(strings.NewReader("hello\n")))
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Read() error = %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestHeader_Format(t *testing.T) {
+	t.Parallel()
+
+	addrs := []struct {
+		name     string
+		src, dst net.Addr
+	}{
+		{name: "ipv4", src: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 12345}, dst: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 8080}},
+		{name: "ipv6", src: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12345}, dst: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 8080}},
+		{name: "unix", src: &net.UnixAddr{Name: "@", Net: "unix"}, dst: &net.UnixAddr{Name: "/run/echo.sock", Net: "unix"}},
+	}
+
+	for _, version := range []int{1, 2} {
+		for _, a := range addrs {
+			h := Header{Version: version, Source: a.src, Destination: a.dst}
+			b, err := h.Format()
+			if err != nil {
+				t.Fatalf("v%d %s: Format() error = %v", version, a.name, err)
+			}
+			got, err := Read(bufio.NewReader(strings.NewReader(string(b))))
+			if err != nil {
+				t.Fatalf("v%d %s: Read() of %q error = %v", version, a.name, b, err)
+			}
+
+			// Only TCP addresses are sent.
+			wantSrc, wantDst := "", ""
+			if _, ok := a.src.(*net.TCPAddr); ok {
+				wantSrc, wantDst = a.src.String(), a.dst.String()
+			}
+			if got.Version != version || addrString(got.Source) != wantSrc || addrString(got.Destination) != wantDst {
+				t.Errorf("v%d %s: read back %+v, want %q to %q", version, a.name, got, wantSrc, wantDst)
+			}
+		}
+	}
+
+	if _, err := (&Header{Version: 3}).Format(); err == nil {
+		t.Error("Format() of version 3 succeeded, want an error")
+	}
+}
+
+func TestListener(t *testing.T) {
+	t.Parallel()
+
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ln := Listener(raw, time.Second, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer ln.Close()
+
+	dial := func(data string) net.Conn {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if data != "" {
+			conn.Write([]byte(data))
+		}
+		return conn
+	}
+
+	// A peer that sends nothing does not hold up the others, and peers
+	// with a malformed header are closed.
+	dial("")
+	bad := dial("hello\n")
+	dial("PROXY TCP4 192.0.2.1 198.51.100.7 12345 8080\r\nping")
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().String(); got != "192.0.2.1:12345" {
+		t.Errorf("RemoteAddr() = %q, want %q", got, "192.0.2.1:12345")
+	}
+	if got := conn.LocalAddr().String(); got != "198.51.100.7:8080" {
+		t.Errorf("LocalAddr() = %q, want %q", got, "198.51.100.7:8080")
+	}
+	b := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "ping" {
+		t.Errorf("read %q, %v, want %q", b, err, "ping")
+	}
+
+	bad.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := bad.Read(b); err == nil {
+		t.Error("peer with a malformed header was not closed")
+	}
+
+	ln.Close()
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept() after Close() error = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
+
+func TestListener_maxPending(t *testing.T) {
+	t.Parallel()
+
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ln := Listener(raw, time.Minute, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer ln.Close()
+
+	// A peer that sends nothing takes the only slot, so the next one is
+	// closed without its header being read.
+	silent, err := net.Dial("tcp", raw.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer silent.Close()
+	extra, err := net.Dial("tcp", raw.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer extra.Close()
+	extra.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.7 12345 8080\r\n"))
+
+	extra.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = extra.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); err == nil || ok && netErr.Timeout() {
+		t.Errorf("Read() of a peer past the pending limit error = %v, want it closed", err)
+	}
+}
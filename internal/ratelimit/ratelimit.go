@@ -0,0 +1,218 @@
+// Package ratelimit shapes the bandwidth of streams with token buckets.
+//
+// A Limiter holds the tokens; Reader and Writer spend them on the bytes
+// that go through a stream. Several streams may share a Limiter, which
+// limits their combined bandwidth, and a stream may go through several
+// limiters, such as one of its own and one shared by all.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A Limiter is a token bucket that fills at a rate of tokens per second up
+// to its burst size. A token stands for a byte. A nil Limiter imposes no
+// limit.
+type Limiter struct {
+	rate  float64
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a full bucket that fills at rate tokens per second up
+// to burst tokens. A burst below 1 is taken as 1. A rate of zero or below
+// imposes no limit, so NewLimiter returns nil for it.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst = max(burst, 1)
+	return &Limiter{rate: rate, burst: burst, tokens: float64(burst)}
+}
+
+// Burst returns the most tokens a single call to WaitN may take.
+func (l *Limiter) Burst() int {
+	if l == nil {
+		return 0
+	}
+	return l.burst
+}
+
+// WaitN takes n tokens, waiting until the bucket holds enough or ctx is
+// done, in which case the tokens are given back. It fails if n exceeds the
+// burst size.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	if n > l.burst {
+		return fmt.Errorf("ratelimit: %d tokens exceed the burst of %d", n, l.burst)
+	}
+
+	wait := l.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.refund(n)
+		return ctx.Err()
+	}
+}
+
+// reserve takes n tokens, possibly going into debt, and returns how long
+// until the debt is paid off.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fill()
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// refund gives back n tokens taken by reserve but not waited for, so
+// that abandoned waits leave no debt behind.
+func (l *Limiter) refund(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fill()
+	l.tokens = min(float64(l.burst), l.tokens+float64(n))
+}
+
+// fill adds the tokens that accrued since the last call. The caller holds
+// l.mu.
+func (l *Limiter) fill() {
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// chunk returns the size of the largest piece of a stream the limiters
+// let through at once, or n if that is smaller.
+func chunk(n int, limiters []*Limiter) int {
+	for _, l := range limiters {
+		if b := l.Burst(); b > 0 {
+			n = min(n, b)
+		}
+	}
+	return n
+}
+
+// wait takes n tokens from every limiter and returns how long that took.
+func wait(ctx context.Context, n int, limiters []*Limiter) (time.Duration, error) {
+	start := time.Now()
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return time.Since(start), err
+		}
+	}
+	return time.Since(start), nil
+}
+
+// A Reader limits the bandwidth of the reads from an underlying reader.
+type Reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+
+	n      int64
+	waited time.Duration
+}
+
+// NewReader returns a reader that reads from r at the pace the limiters
+// allow. Reads wait for tokens until ctx is done. Nil limiters are
+// ignored.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*Limiter) *Reader {
+	return &Reader{ctx: ctx, r: r, limiters: limiters}
+}
+
+// Read reads at most a burst of bytes, then waits for the tokens for what
+// it read.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p[:chunk(len(p), r.limiters)])
+	r.n += int64(n)
+	waited, werr := wait(r.ctx, n, r.limiters)
+	r.waited += waited
+	if err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+// N returns the number of bytes read.
+func (r *Reader) N() int64 {
+	return r.n
+}
+
+// Waited returns how long reads waited for tokens.
+func (r *Reader) Waited() time.Duration {
+	return r.waited
+}
+
+// A Writer limits the bandwidth of the writes to an underlying writer.
+type Writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+
+	n      int64
+	waited time.Duration
+}
+
+// NewWriter returns a writer that writes to w at the pace the limiters
+// allow. Writes wait for tokens until ctx is done. Nil limiters are
+// ignored.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*Limiter) *Writer {
+	return &Writer{ctx: ctx, w: w, limiters: limiters}
+}
+
+// Write writes p a burst at a time, waiting for the tokens of each burst
+// before writing it.
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		size := chunk(len(p), w.limiters)
+		waited, err := wait(w.ctx, size, w.limiters)
+		w.waited += waited
+		if err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(p[:size])
+		written += n
+		w.n += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[size:]
+	}
+	return written, nil
+}
+
+// N returns the number of bytes written.
+func (w *Writer) N() int64 {
+	return w.n
+}
+
+// Waited returns how long writes waited for tokens.
+func (w *Writer) Waited() time.Duration {
+	return w.waited
+}
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_WaitN(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(1000, 100)
+	ctx := context.Background()
+
+	// The bucket starts full, so a burst goes through at once.
+	start := time.Now()
+	if err := l.WaitN(ctx, 100); err != nil {
+		t.Fatalf("WaitN() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("first burst took %v, want no wait", elapsed)
+	}
+
+	// The next 200 tokens take 200ms to fill.
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.WaitN(ctx, 100); err != nil {
+			t.Fatalf("WaitN() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("200 tokens at 1000/s took %v, want about 200ms", elapsed)
+	}
+
+	if err := l.WaitN(ctx, 101); err == nil {
+		t.Error("WaitN() beyond the burst succeeded, want an error")
+	}
+}
+
+func TestLimiter_WaitN_cancel(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(1, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	l.WaitN(ctx, 1)
+	if err := l.WaitN(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitN() on an empty bucket error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestLimiter_WaitN_refund(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(10, 10)
+	l.WaitN(context.Background(), 10)
+
+	// Giving up on a second of tokens leaves no debt behind: the next
+	// token is a tenth of a second away, not over a second.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitN() on an empty bucket error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	start := time.Now()
+	if err := l.WaitN(context.Background(), 1); err != nil {
+		t.Fatalf("WaitN() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("a token after a cancelled wait took %v, want about 100ms", elapsed)
+	}
+}
+
+func TestLimiter_nil(t *testing.T) {
+	t.Parallel()
+
+	var l *Limiter
+	if err := l.WaitN(context.Background(), 1<<20); err != nil {
+		t.Errorf("WaitN() on a nil limiter error = %v", err)
+	}
+	if b := l.Burst(); b != 0 {
+		t.Errorf("Burst() of a nil limiter = %d, want 0", b)
+	}
+
+	for _, rate := range []float64{0, -1} {
+		if l := NewLimiter(rate, 10); l != nil {
+			t.Errorf("NewLimiter(%v, 10) = %+v, want nil", rate, l)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	payload := strings.Repeat("x", 300)
+	r := NewReader(context.Background(), strings.NewReader(payload), NewLimiter(1000, 100), nil)
+
+	start := time.Now()
+	b := make([]byte, 1024)
+	var got []byte
+	for {
+		n, err := r.Read(b)
+		if n > 100 {
+			t.Errorf("Read() returned %d bytes, want at most a burst of 100", n)
+		}
+		got = append(got, b[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	if string(got) != payload {
+		t.Errorf("read %d bytes, want %d", len(got), len(payload))
+	}
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("reading 300 bytes at 1000/s with a burst of 100 took %v, want about 200ms", elapsed)
+	}
+	if r.N() != 300 || r.Waited() < 150*time.Millisecond {
+		t.Errorf("N() = %d, Waited() = %v, want 300 and about 200ms", r.N(), r.Waited())
+	}
+}
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+
+	// Two writers share a limiter, so together they write at its rate.
+	shared := NewLimiter(1000, 100)
+	var (
+		wg  sync.WaitGroup
+		out [2]bytes.Buffer
+	)
+	start := time.Now()
+	for i := range out {
+		wg.Add(1)
+		go func(buf *bytes.Buffer) {
+			defer wg.Done()
+
+			w := NewWriter(context.Background(), buf, NewLimiter(1e6, 50), shared)
+			if n, err := w.Write(bytes.Repeat([]byte("x"), 150)); n != 150 || err != nil {
+				t.Errorf("Write() = %d, %v, want 150, nil", n, err)
+			}
+			if w.N() != 150 {
+				t.Errorf("N() = %d, want 150", w.N())
+			}
+		}(&out[i])
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("writing 300 bytes at a shared 1000/s took %v, want about 200ms", elapsed)
+	}
+	for i := range out {
+		if out[i].Len() != 150 {
+			t.Errorf("writer %d wrote %d bytes, want 150", i, out[i].Len())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// deadlineConn applies the server timeouts to every Read and Write of the
+// wrapped connection. It owns the connection deadlines: handlers must not
+// set their own.
+//
+// Reads may be issued concurrently with writes, but not with other reads.
+type deadlineConn struct {
+	net.Conn
+
+	idle        time.Duration
+	read        time.Duration
+	write       time.Duration
+	minProgress int
+
+	// idleDeadline is when the peer is considered idle. It is pushed back
+	// every time the peer sends at least minProgress bytes.
+	idleDeadline time.Time
+	progress     int
+}
+
+func newDeadlineConn(conn net.Conn, idle, read, write time.Duration, minProgress int) *deadlineConn {
+	c := &deadlineConn{
+		Conn:        conn,
+		idle:        idle,
+		read:        read,
+		write:       write,
+		minProgress: max(minProgress, 1),
+	}
+	if idle > 0 {
+		c.idleDeadline = time.Now().Add(idle)
+	}
+	return c
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	now := time.Now()
+
+	deadline := c.idleDeadline
+	if c.read > 0 {
+		if d := now.Add(c.read); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.idle > 0 {
+		c.progress += n
+		if c.progress >= c.minProgress {
+			c.idleDeadline = time.Now().Add(c.idle)
+			c.progress = 0
+		}
+	}
+	return n, err
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.write > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.write)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeadlineConn(t *testing.T) {
+	t.Parallel()
+
+	t.Run("idle peer", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := pipe(t)
+		defer client.Close()
+
+		conn := newDeadlineConn(server, 50*time.Millisecond, 0, 0, 0)
+		start := time.Now()
+		_, err := conn.Read(make([]byte, 1))
+		checkTimeout(t, err, start, 50*time.Millisecond)
+	})
+
+	t.Run("activity extends idle timeout", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := pipe(t)
+		defer client.Close()
+
+		stop := trickle(client, 20*time.Millisecond)
+		defer stop()
+
+		conn := newDeadlineConn(server, 50*time.Millisecond, 0, 0, 0)
+		b := make([]byte, 1)
+		for end := time.Now().Add(200 * time.Millisecond); time.Now().Before(end); {
+			if _, err := conn.Read(b); err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+		}
+	})
+
+	t.Run("slow-loris peer", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := pipe(t)
+		defer client.Close()
+
+		stop := trickle(client, 20*time.Millisecond)
+		defer stop()
+
+		conn := newDeadlineConn(server, 100*time.Millisecond, 0, 0, 100)
+		start := time.Now()
+		b := make([]byte, 1)
+		for {
+			_, err := conn.Read(b)
+			if err == nil {
+				continue
+			}
+			checkTimeout(t, err, start, 100*time.Millisecond)
+			return
+		}
+	})
+
+	t.Run("stalled read", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := pipe(t)
+		defer client.Close()
+
+		conn := newDeadlineConn(server, time.Hour, 50*time.Millisecond, 0, 0)
+		start := time.Now()
+		_, err := conn.Read(make([]byte, 1))
+		checkTimeout(t, err, start, 50*time.Millisecond)
+	})
+
+	t.Run("stalled write", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := pipe(t)
+		defer client.Close()
+
+		// The client never reads, so writes block once the socket buffers
+		// are full.
+		conn := newDeadlineConn(server, 0, 0, 50*time.Millisecond, 0)
+		b := make([]byte, 1<<20)
+		for i := 0; ; i++ {
+			start := time.Now()
+			if _, err := conn.Write(b); err != nil {
+				checkTimeout(t, err, start, 0)
+				return
+			}
+			if i > 1000 {
+				t.Fatal("Write() never blocked")
+			}
+		}
+	})
+}
+
+func TestServer_timeouts(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln := listen(t)
+	srv := Server{Handler: HandlerFunc(echo), IdleTimeout: 50 * time.Millisecond}
+	errs := serve(ctx, &srv, ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn, "ping")
+
+	// The server hangs up on a peer that goes silent.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("Read() error = %v, want %v", err, io.EOF)
+	}
+
+	cancel()
+	if err := wait(t, errs); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+}
+
+// pipe returns both ends of a loopback TCP connection.
+func pipe(t *testing.T) (server, client net.Conn) {
+	t.Helper()
+
+	ln := listen(t)
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	server, err = ln.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return server, client
+}
+
+// trickle writes a single byte to conn every interval until stopped.
+func trickle(conn net.Conn, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := conn.Write([]byte{'x'}); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func checkTimeout(t *testing.T, err error, start time.Time, atLeast time.Duration) {
+	t.Helper()
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("error = %v, want a net.Error timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < atLeast {
+		t.Fatalf("timed out after %v, want at least %v", elapsed, atLeast)
+	}
+}
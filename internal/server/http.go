@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/sklyar/protohackers/internal/logging"
+)
+
+// ServeHTTPHandler is Serve for HTTP: it serves HTTP/1.1 with h on the
+// connections accepted on ln, in place of Handler. They share the
+// connection limits, timeouts and metrics of the connections of Serve,
+// which may run on other listeners at the same time. Connections refused
+// by a limit get a 503 Service Unavailable response.
+func (s *Server) ServeHTTPHandler(ctx context.Context, ln net.Listener, h http.Handler) error {
+	if h == nil {
+		return fmt.Errorf("server: nil HTTP handler")
+	}
+	return s.serve(ctx, ln, httpHandler{h}, rejectHTTP)
+}
+
+// httpHandler serves HTTP on a connection, with keep-alive.
+type httpHandler struct {
+	h http.Handler
+}
+
+func (h httpHandler) ServeConn(ctx context.Context, conn net.Conn) {
+	logger := logging.FromContext(ctx)
+
+	ln := newConnListener(conn)
+	srv := &http.Server{
+		Handler:     h.h,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		ErrorLog:    slog.NewLogLogger(logger.Handler(), slog.LevelDebug),
+	}
+	// Once the server stops accepting, the request in flight may finish,
+	// but the connection is not kept alive for another.
+	stop := context.AfterFunc(ctx, func() {
+		if err := srv.Shutdown(context.WithoutCancel(ctx)); err != nil {
+			logger.Error("failed to shut down HTTP", slog.Any("err", err))
+		}
+	})
+	defer stop()
+
+	srv.Serve(ln)
+	<-ln.conn.closed
+}
+
+// connListener is a listener that accepts a single connection, and then
+// blocks until the connection or the listener is closed.
+type connListener struct {
+	conn     *notifyConn
+	accepted bool
+	mu       sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{
+		conn: &notifyConn{Conn: conn, closed: make(chan struct{})},
+		done: make(chan struct{}),
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	first := !l.accepted
+	l.accepted = true
+	l.mu.Unlock()
+	if first {
+		return l.conn, nil
+	}
+
+	select {
+	case <-l.conn.closed:
+	case <-l.done:
+	}
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// notifyConn is a connection that tells when it is closed.
+type notifyConn struct {
+	net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *notifyConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// NetConn returns the underlying connection.
+func (c *notifyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// rejectHTTP answers a connection refused by a limit with a 503 Service
+// Unavailable response.
+func rejectHTTP(ctx context.Context, conn net.Conn, err error) {
+	body := err.Error() + "\n"
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 503 Service Unavailable\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body); err != nil {
+		logging.FromContext(ctx).Debug("failed to write to connection", slog.Any("err", err))
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_ServeHTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	echoPath := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})
+
+	t.Run("keeps connections alive", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{}
+		errs := serveHTTP(ctx, &srv, ln, echoPath)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for _, path := range []string{"/a", "/b"} {
+			resp := get(t, conn, r, path)
+			if resp.StatusCode != http.StatusOK || resp.body != path {
+				t.Fatalf("GET %s = %d %q, want %d %q", path, resp.StatusCode, resp.body, http.StatusOK, path)
+			}
+		}
+
+		conn.Close()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("ServeHTTPHandler() error = %v", err)
+		}
+	})
+
+	t.Run("answers rejected connections with 503", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{MaxConns: 1}
+		errs := serveHTTP(ctx, &srv, ln, echoPath)
+
+		first, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer first.Close()
+		get(t, first, bufio.NewReader(first), "/")
+
+		second, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer second.Close()
+		resp := get(t, second, bufio.NewReader(second), "/")
+		if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(resp.body, ErrTooManyConns.Error()) {
+			t.Fatalf("GET / = %d %q, want %d %q", resp.StatusCode, resp.body, http.StatusServiceUnavailable, ErrTooManyConns)
+		}
+
+		first.Close()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("ServeHTTPHandler() error = %v", err)
+		}
+	})
+
+	t.Run("closes idle connections on shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{ShutdownTimeout: time.Hour}
+		errs := serveHTTP(ctx, &srv, ln, echoPath)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		get(t, conn, r, "/")
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("ServeHTTPHandler() error = %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := r.ReadByte(); !errors.Is(err, io.EOF) {
+			t.Fatalf("Read() error = %v, want %v", err, io.EOF)
+		}
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		t.Parallel()
+
+		ln := listen(t)
+		defer ln.Close()
+		srv := Server{}
+		if err := srv.ServeHTTPHandler(context.Background(), ln, nil); err == nil {
+			t.Fatal("ServeHTTPHandler() error = nil, want an error")
+		}
+	})
+}
+
+func serveHTTP(ctx context.Context, srv *Server, ln net.Listener, h http.Handler) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ServeHTTPHandler(ctx, ln, h)
+	}()
+	return errs
+}
+
+type httpResponse struct {
+	*http.Response
+	body string
+}
+
+// get sends a GET request for path on conn and reads the response from r.
+func get(t *testing.T, conn net.Conn, r *bufio.Reader, path string) httpResponse {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	return httpResponse{Response: resp, body: string(body)}
+}
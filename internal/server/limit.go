@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+)
+
+// rejectTimeout bounds how long Reject may spend writing to a refused
+// connection.
+const rejectTimeout = time.Second
+
+// maxRejecting bounds how many refused connections Reject answers at
+// once. Past it, refused connections are closed without a reply, so that
+// a flood of them costs no more than the accept loop itself.
+const maxRejecting = 64
+
+var (
+	// ErrTooManyConns is reported to Reject when MaxConns is reached.
+	ErrTooManyConns = errors.New("too many connections")
+
+	// ErrTooManyConnsPerIP is reported to Reject when MaxConnsPerIP is
+	// reached for the remote address.
+	ErrTooManyConnsPerIP = errors.New("too many connections from this address")
+)
+
+// reject refuses a connection that was not admitted by track, answering
+// it with respond if that is not nil.
+func (s *Server) reject(ctx context.Context, conn net.Conn, group *connGroup, reason error, respond func(ctx context.Context, conn net.Conn, err error)) {
+	defer group.wg.Done()
+	defer conn.Close()
+
+	logger := s.connLogger(conn)
+	ctx = logging.NewContext(ctx, logger)
+
+	connectionsRejected.With(s.Name, group.listener, rejectReason(reason)).Inc()
+	logger.Warn("connection rejected", slog.String("reason", reason.Error()))
+
+	if respond == nil {
+		return
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(rejectTimeout)); err != nil {
+		return
+	}
+	respond(ctx, conn, reason)
+}
+
+// startReject reserves one of the maxRejecting slots for answering a
+// refused connection, reporting whether one was free.
+func (s *Server) startReject() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rejecting >= maxRejecting {
+		return false
+	}
+	s.rejecting++
+	return true
+}
+
+func (s *Server) finishReject() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rejecting--
+}
+
+func rejectReason(err error) string {
+	if errors.Is(err, ErrTooManyConnsPerIP) {
+		return "max_conns_per_ip"
+	}
+	return "max_conns"
+}
+
+// remoteIP returns the host part of the connection's remote address.
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_limits(t *testing.T) {
+	t.Parallel()
+
+	reject := func(_ context.Context, conn net.Conn, err error) {
+		_, _ = conn.Write([]byte(err.Error() + "\n"))
+	}
+
+	t.Run("global limit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo), MaxConns: 2, Reject: reject}
+		errs := serve(ctx, &srv, ln)
+
+		first := dial(t, ln.Addr().String(), "")
+		roundTrip(t, first, "ping")
+		second := dial(t, ln.Addr().String(), "")
+		roundTrip(t, second, "ping")
+
+		third := dial(t, ln.Addr().String(), "")
+		checkRejected(t, third, ErrTooManyConns)
+
+		// A slot frees up once a connection is closed.
+		first.Close()
+		eventually(t, func() bool {
+			conn := dial(t, ln.Addr().String(), "")
+			defer conn.Close()
+			return echoes(conn)
+		})
+
+		second.Close()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("per-IP limit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo), MaxConnsPerIP: 1, Reject: reject}
+		errs := serve(ctx, &srv, ln)
+
+		first := dial(t, ln.Addr().String(), "127.0.0.1")
+		defer first.Close()
+		roundTrip(t, first, "ping")
+
+		second := dial(t, ln.Addr().String(), "127.0.0.1")
+		checkRejected(t, second, ErrTooManyConnsPerIP)
+
+		other := dial(t, ln.Addr().String(), "127.0.0.2")
+		roundTrip(t, other, "ping")
+		other.Close()
+
+		first.Close()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("rejects silently without policy", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo), MaxConns: 1}
+		errs := serve(ctx, &srv, ln)
+
+		first := dial(t, ln.Addr().String(), "")
+		roundTrip(t, first, "ping")
+
+		second := dial(t, ln.Addr().String(), "")
+		defer second.Close()
+		second.SetReadDeadline(time.Now().Add(time.Second))
+		if n, err := second.Read(make([]byte, 1)); n != 0 || !errors.Is(err, io.EOF) {
+			t.Fatalf("Read() = %d, %v, want 0, %v", n, err, io.EOF)
+		}
+
+		first.Close()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("closes refused connections past the reject limit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		release := make(chan struct{})
+		stalled := func(ctx context.Context, _ net.Conn, _ error) {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo), MaxConns: 1, Reject: stalled}
+		errs := serve(ctx, &srv, ln)
+
+		first := dial(t, ln.Addr().String(), "")
+		roundTrip(t, first, "ping")
+
+		// Occupy every reject slot with a connection whose reply stalls.
+		var pending []net.Conn
+		for i := 0; i < maxRejecting; i++ {
+			conn := dial(t, ln.Addr().String(), "")
+			defer conn.Close()
+			pending = append(pending, conn)
+		}
+		eventually(t, func() bool {
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			return srv.rejecting == maxRejecting
+		})
+
+		extra := dial(t, ln.Addr().String(), "")
+		defer extra.Close()
+		extra.SetReadDeadline(time.Now().Add(time.Second))
+		if n, err := extra.Read(make([]byte, 1)); n != 0 || !errors.Is(err, io.EOF) {
+			t.Fatalf("Read() = %d, %v, want 0, %v", n, err, io.EOF)
+		}
+
+		close(release)
+		for _, conn := range pending {
+			conn.Close()
+		}
+		first.Close()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+}
+
+func dial(t *testing.T, addr, localIP string) net.Conn {
+	t.Helper()
+
+	var d net.Dialer
+	if localIP != "" {
+		d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(localIP)}
+	}
+
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		if localIP != "" && localIP != "127.0.0.1" {
+			t.Skipf("cannot dial from %s: %v", localIP, err)
+		}
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return conn
+}
+
+func checkRejected(t *testing.T, conn net.Conn, reason error) {
+	t.Helper()
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if want := reason.Error() + "\n"; string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+}
+
+func echoes(conn net.Conn) bool {
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return false
+	}
+	b := make([]byte, 4)
+	_, err := io.ReadFull(conn, b)
+	return err == nil && string(b) == "ping"
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
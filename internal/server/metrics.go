@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net"
+
+	"github.com/sklyar/protohackers/internal/metrics"
+)
+
+// durationBuckets cover anything from a one-shot request to a long-lived
+// chat session, in seconds.
+var durationBuckets = []float64{.001, .01, .1, 1, 10, 60, 600, 3600}
+
+// Every series is labelled with the name of the server and the local
+// address of the listener it came from, so that a server serving several
+// listeners, such as TCP and TLS, reports each of them apart.
+
+var (
+	connectionsTotal = metrics.NewCounterVec(
+		"protohackers_connections_total",
+		"Connections accepted.",
+		"server", "listener",
+	)
+	connectionsActive = metrics.NewGaugeVec(
+		"protohackers_connections_active",
+		"Connections currently being served.",
+		"server", "listener",
+	)
+	connectionsRejected = metrics.NewCounterVec(
+		"protohackers_connections_rejected_total",
+		"Connections refused because of a connection limit.",
+		"server", "listener", "reason",
+	)
+	connectionDuration = metrics.NewHistogramVec(
+		"protohackers_connection_duration_seconds",
+		"Time spent in the connection handler.",
+		durationBuckets,
+		"server", "listener",
+	)
+	packetsTotal = metrics.NewCounterVec(
+		"protohackers_packets_total",
+		"Datagrams received.",
+		"server", "listener",
+	)
+	packetDuration = metrics.NewHistogramVec(
+		"protohackers_packet_duration_seconds",
+		"Time spent in the packet handler.",
+		metrics.DefaultBuckets,
+		"server", "listener",
+	)
+	receivedBytes = metrics.NewCounterVec(
+		"protohackers_received_bytes_total",
+		"Bytes received from peers.",
+		"server", "listener",
+	)
+	sentBytes = metrics.NewCounterVec(
+		"protohackers_sent_bytes_total",
+		"Bytes sent to peers.",
+		"server", "listener",
+	)
+	errorsTotal = metrics.NewCounterVec(
+		"protohackers_server_errors_total",
+		"Errors encountered outside of handlers.",
+		"server", "listener", "kind",
+	)
+)
+
+// countingConn counts the bytes read from and written to a connection.
+type countingConn struct {
+	net.Conn
+
+	received *metrics.Counter
+	sent     *metrics.Counter
+}
+
+func newCountingConn(conn net.Conn, server, listener string) *countingConn {
+	return &countingConn{
+		Conn:     conn,
+		received: receivedBytes.With(server, listener),
+		sent:     sentBytes.With(server, listener),
+	}
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent.Add(uint64(n))
+	return n, err
+}
+
+// countingPacketConn counts the bytes read from and written to a packet
+// connection.
+type countingPacketConn struct {
+	net.PacketConn
+
+	received *metrics.Counter
+	sent     *metrics.Counter
+}
+
+func newCountingPacketConn(pc net.PacketConn, server, listener string) *countingPacketConn {
+	return &countingPacketConn{
+		PacketConn: pc,
+		received:   receivedBytes.With(server, listener),
+		sent:       sentBytes.With(server, listener),
+	}
+}
+
+func (c *countingPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	c.received.Add(uint64(n))
+	return n, addr, err
+}
+
+func (c *countingPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.sent.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+)
+
+const defaultMaxPacketSize = 65535
+
+// PacketHandler serves a single datagram received from addr. Replies are
+// written back through pc. The payload is only valid until ServePacket
+// returns.
+type PacketHandler interface {
+	ServePacket(ctx context.Context, pc net.PacketConn, addr net.Addr, payload []byte)
+}
+
+// PacketHandlerFunc adapts an ordinary function to the PacketHandler
+// interface.
+type PacketHandlerFunc func(ctx context.Context, pc net.PacketConn, addr net.Addr, payload []byte)
+
+func (f PacketHandlerFunc) ServePacket(ctx context.Context, pc net.PacketConn, addr net.Addr, payload []byte) {
+	f(ctx, pc, addr, payload)
+}
+
+// PacketServer reads datagrams from a packet connection and hands each of
+// them to the Handler. Datagrams are handled sequentially in the order they
+// were received.
+type PacketServer struct {
+	Handler PacketHandler
+
+	// Name identifies the server in metrics.
+	Name string
+
+	// Logger is the base logger of the server. Each handler receives a
+	// logger derived from it through its context, see logging.FromContext.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// MaxPacketSize is the size of the read buffer. Longer datagrams are
+	// truncated. Defaults to 65535.
+	MaxPacketSize int
+}
+
+// Serve reads datagrams from pc until ctx is cancelled or the connection
+// fails permanently. Temporary read errors are retried with exponential
+// backoff. The connection is closed when Serve returns.
+//
+// Serve returns nil when it was stopped by ctx.
+func (s *PacketServer) Serve(ctx context.Context, pc net.PacketConn) error {
+	if s.Handler == nil {
+		return errors.New("server: nil packet handler")
+	}
+
+	defer pc.Close()
+
+	stop := closeOnDone(ctx, pc, s.logger())
+	defer stop()
+
+	listener := pc.LocalAddr().String()
+	pc = newCountingPacketConn(pc, s.Name, listener)
+
+	size := s.MaxPacketSize
+	if size <= 0 {
+		size = defaultMaxPacketSize
+	}
+	buf := make([]byte, size)
+
+	var backoff time.Duration
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return fmt.Errorf("read: %w", err)
+			}
+
+			errorsTotal.With(s.Name, listener, "read").Inc()
+			backoff = nextBackoff(backoff)
+			s.logger().Error("failed to read packet", slog.Any("err", err), slog.Duration("backoff", backoff))
+			if !sleep(ctx, backoff) {
+				return nil
+			}
+			continue
+		}
+		backoff = 0
+		packetsTotal.With(s.Name, listener).Inc()
+
+		s.servePacket(ctx, pc, listener, addr, buf[:n])
+	}
+}
+
+func (s *PacketServer) servePacket(ctx context.Context, pc net.PacketConn, listener string, addr net.Addr, payload []byte) {
+	logger := s.logger().With(slog.String("remote_addr", addr.String()))
+	ctx = logging.NewContext(ctx, logger)
+
+	defer func() {
+		if v := recover(); v != nil {
+			errorsTotal.With(s.Name, listener, "panic").Inc()
+			logger.Error(
+				"panic serving packet",
+				slog.Any("panic", v),
+				slog.String("stack", string(debug.Stack())),
+			)
+		}
+	}()
+
+	start := time.Now()
+	defer func() {
+		packetDuration.With(s.Name, listener).Observe(time.Since(start).Seconds())
+	}()
+
+	s.Handler.ServePacket(ctx, pc, addr, payload)
+}
+
+func (s *PacketServer) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacketServer_Serve(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves datagrams until cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+
+		srv := PacketServer{Handler: PacketHandlerFunc(echoPacket)}
+		errs := make(chan error, 1)
+		go func() {
+			errs <- srv.Serve(ctx, pc)
+		}()
+
+		conn, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		b := make([]byte, 16)
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if got := string(b[:n]); got != "ping" {
+			t.Fatalf("got %q, want %q", got, "ping")
+		}
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("returns error when connection is closed", func(t *testing.T) {
+		t.Parallel()
+
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+
+		srv := PacketServer{Handler: PacketHandlerFunc(echoPacket)}
+		errs := make(chan error, 1)
+		go func() {
+			errs <- srv.Serve(context.Background(), pc)
+		}()
+
+		pc.Close()
+		if err := wait(t, errs); !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Serve() error = %v, want %v", err, net.ErrClosed)
+		}
+	})
+}
+
+func echoPacket(_ context.Context, pc net.PacketConn, addr net.Addr, payload []byte) {
+	_, _ = pc.WriteTo(payload, addr)
+}
@@ -0,0 +1,375 @@
+// Package server implements the accept loop shared by all problem servers.
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+)
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// DefaultShutdownTimeout is the grace period RegisterFlags defaults to for
+// a server without one.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Handler serves a single connection. The connection is closed by the
+// server once ServeConn returns.
+type Handler interface {
+	ServeConn(ctx context.Context, conn net.Conn)
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface.
+type HandlerFunc func(ctx context.Context, conn net.Conn)
+
+func (f HandlerFunc) ServeConn(ctx context.Context, conn net.Conn) {
+	f(ctx, conn)
+}
+
+// Server accepts connections from a listener and hands each of them to the
+// Handler in its own goroutine.
+type Server struct {
+	Handler Handler
+
+	// Name identifies the server in metrics.
+	Name string
+
+	// Logger is the base logger of the server. Each handler receives a
+	// logger derived from it through its context, see logging.FromContext.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// ShutdownTimeout is how long in-flight connections may keep running
+	// once Serve stops accepting. Connections still open after that are
+	// closed forcibly. Zero closes them immediately.
+	ShutdownTimeout time.Duration
+
+	// MaxConns limits the number of concurrent connections. Zero means no
+	// limit.
+	MaxConns int
+
+	// MaxConnsPerIP limits the number of concurrent connections from a
+	// single remote IP address. Zero means no limit.
+	MaxConnsPerIP int
+
+	// IdleTimeout is how long to wait for the peer to send data before the
+	// connection is considered idle and reads fail with a timeout. Zero
+	// means no idle timeout.
+	IdleTimeout time.Duration
+
+	// MinReadProgress is the number of bytes the peer must send within
+	// IdleTimeout to keep the connection open. It protects against
+	// slow-loris peers trickling single bytes. Defaults to 1.
+	MinReadProgress int
+
+	// ReadTimeout bounds each individual read. Zero means no limit.
+	ReadTimeout time.Duration
+
+	// WriteTimeout bounds each individual write. Zero means no limit.
+	WriteTimeout time.Duration
+
+	// Reject is called for connections refused because of a limit, with
+	// ErrTooManyConns or ErrTooManyConnsPerIP. It may write a
+	// protocol-specific error before the connection is closed. If nil,
+	// or if too many refused connections are being answered already,
+	// refused connections are closed without a reply.
+	Reject func(ctx context.Context, conn net.Conn, err error)
+
+	mu        sync.Mutex
+	conns     map[net.Conn]*connGroup
+	ips       map[string]int
+	rejecting int
+}
+
+// A connGroup is the connections accepted by one call of Serve, which it
+// waits for and drains.
+type connGroup struct {
+	wg sync.WaitGroup
+
+	// listener is the local address of the listener, for metrics.
+	listener string
+}
+
+// RegisterFlags registers command-line flags for the server settings on fs.
+// Settings already made on s serve as the flag defaults, and the shutdown
+// timeout defaults to DefaultShutdownTimeout if s has none.
+func (s *Server) RegisterFlags(fs *flag.FlagSet) {
+	shutdownTimeout := s.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+	fs.DurationVar(&s.ShutdownTimeout, "shutdown-timeout", shutdownTimeout, "grace period for in-flight connections on shutdown")
+	fs.DurationVar(&s.IdleTimeout, "idle-timeout", s.IdleTimeout, "close connections whose peer sends nothing for this long (0 means no limit)")
+	fs.IntVar(&s.MinReadProgress, "min-read-progress", s.MinReadProgress, "bytes the peer must send per idle timeout to stay connected")
+	fs.DurationVar(&s.ReadTimeout, "read-timeout", s.ReadTimeout, "maximum duration of a single read (0 means no limit)")
+	fs.DurationVar(&s.WriteTimeout, "write-timeout", s.WriteTimeout, "maximum duration of a single write (0 means no limit)")
+	fs.IntVar(&s.MaxConns, "max-conns", s.MaxConns, "maximum number of concurrent connections (0 means no limit)")
+	fs.IntVar(&s.MaxConnsPerIP, "max-conns-per-ip", s.MaxConnsPerIP, "maximum number of concurrent connections per remote IP (0 means no limit)")
+}
+
+// Serve accepts connections on ln until ctx is cancelled or the listener
+// fails permanently. Temporary accept errors are retried with exponential
+// backoff. The listener is closed when Serve returns.
+//
+// Once Serve stops accepting, the context passed to handlers is cancelled
+// and in-flight connections are given ShutdownTimeout to finish before they
+// are closed. Serve does not return until every handler has returned.
+//
+// Connections from a TLS listener, such as one returned by tls.NewListener,
+// complete their handshake before they reach the Handler, and the
+// negotiated parameters are logged.
+//
+// Serve may run on several listeners at once. They share the connection
+// limits, but each call waits for, and on timeout closes, only the
+// connections it accepted.
+//
+// Serve returns nil when it was stopped by ctx.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.Handler == nil {
+		return errors.New("server: nil handler")
+	}
+	return s.serve(ctx, ln, s.Handler, s.Reject)
+}
+
+// serve is Serve with the handler and the reject function of the
+// connections of ln.
+func (s *Server) serve(ctx context.Context, ln net.Listener, handler Handler, reject func(ctx context.Context, conn net.Conn, err error)) error {
+	stop := closeOnDone(ctx, ln, s.logger())
+	defer stop()
+
+	group := connGroup{listener: ln.Addr().String()}
+	connCtx, cancel := context.WithCancel(ctx)
+	defer s.drain(&group)
+	defer cancel()
+	defer ln.Close()
+
+	var backoff time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return fmt.Errorf("accept: %w", err)
+			}
+
+			errorsTotal.With(s.Name, group.listener, "accept").Inc()
+			backoff = nextBackoff(backoff)
+			s.logger().Error("failed to accept", slog.Any("err", err), slog.Duration("backoff", backoff))
+			if !sleep(ctx, backoff) {
+				return nil
+			}
+			continue
+		}
+		backoff = 0
+
+		if err := s.track(conn, &group); err != nil {
+			if reject != nil && s.startReject() {
+				go func() {
+					defer s.finishReject()
+					s.reject(connCtx, conn, &group, err, reject)
+				}()
+			} else {
+				s.reject(connCtx, conn, &group, err, nil)
+			}
+			continue
+		}
+		go s.serveConn(connCtx, conn, &group, handler)
+	}
+}
+
+// drain waits for the in-flight connections of group to finish, closing
+// them once the shutdown timeout expires.
+func (s *Server) drain(group *connGroup) {
+	done := make(chan struct{})
+	go func() {
+		group.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(s.ShutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	if n := s.closeConns(group); n > 0 {
+		s.logger().Warn("shutdown timeout exceeded, closing connections", slog.Int("conns", n))
+	}
+	<-done
+}
+
+// track registers conn as in-flight in group. It fails if accepting conn
+// would exceed one of the connection limits. Refused connections are
+// still counted by the wait group of group until reject is done with them.
+func (s *Server) track(conn net.Conn, group *connGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group.wg.Add(1)
+
+	if s.MaxConns > 0 && len(s.conns) >= s.MaxConns {
+		return ErrTooManyConns
+	}
+
+	ip := remoteIP(conn)
+	if s.MaxConnsPerIP > 0 && s.ips[ip] >= s.MaxConnsPerIP {
+		return ErrTooManyConnsPerIP
+	}
+
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]*connGroup)
+		s.ips = make(map[string]int)
+	}
+	s.conns[conn] = group
+	s.ips[ip]++
+
+	return nil
+}
+
+func (s *Server) untrack(conn net.Conn, group *connGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+
+	ip := remoteIP(conn)
+	if s.ips[ip]--; s.ips[ip] <= 0 {
+		delete(s.ips, ip)
+	}
+
+	group.wg.Done()
+}
+
+// closeConns closes the tracked connections of group and returns how many
+// there were.
+func (s *Server) closeConns(group *connGroup) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for conn, g := range s.conns {
+		if g != group {
+			continue
+		}
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logger().Error("failed to close connection", slog.Any("err", err))
+		}
+		n++
+	}
+	return n
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn, group *connGroup, handler Handler) {
+	logger := s.connLogger(conn)
+	ctx = logging.NewContext(ctx, logger)
+
+	defer s.untrack(conn, group)
+	defer func() {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Error("failed to close connection", slog.Any("err", err))
+		}
+	}()
+	defer func() {
+		if v := recover(); v != nil {
+			errorsTotal.With(s.Name, group.listener, "panic").Inc()
+			logger.Error(
+				"panic serving connection",
+				slog.Any("panic", v),
+				slog.String("stack", string(debug.Stack())),
+			)
+		}
+	}()
+
+	connectionsTotal.With(s.Name, group.listener).Inc()
+	active := connectionsActive.With(s.Name, group.listener)
+	active.Inc()
+	defer active.Dec()
+
+	logger.Debug("connection opened")
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		connectionDuration.With(s.Name, group.listener).Observe(elapsed.Seconds())
+		logger.Debug("connection closed", slog.Duration("duration", elapsed))
+	}()
+
+	if !s.handshake(ctx, conn, group.listener, logger) {
+		return
+	}
+
+	var c net.Conn = newCountingConn(conn, s.Name, group.listener)
+	if s.IdleTimeout > 0 || s.ReadTimeout > 0 || s.WriteTimeout > 0 {
+		c = newDeadlineConn(c, s.IdleTimeout, s.ReadTimeout, s.WriteTimeout, s.MinReadProgress)
+	}
+
+	handler.ServeConn(ctx, c)
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+// connLogger returns a logger scoped to a single connection.
+func (s *Server) connLogger(conn net.Conn) *slog.Logger {
+	return s.logger().With(
+		slog.String("conn_id", logging.NewConnID()),
+		slog.String("remote_addr", conn.RemoteAddr().String()),
+	)
+}
+
+// closeOnDone closes c once ctx is done. The returned function releases the
+// watcher without closing c.
+func closeOnDone(ctx context.Context, c io.Closer, logger *slog.Logger) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := c.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				logger.Error("failed to close listener", slog.Any("err", err))
+			}
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+func nextBackoff(d time.Duration) time.Duration {
+	if d == 0 {
+		return minAcceptBackoff
+	}
+	return min(2*d, maxAcceptBackoff)
+}
+
+// sleep waits for d or until ctx is done. It reports whether the full
+// duration elapsed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
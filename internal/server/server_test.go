@@ -0,0 +1,549 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/logging"
+)
+
+func TestServer_Serve(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves connections until cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo)}
+		errs := serve(ctx, &srv, ln)
+
+		for i := 0; i < 3; i++ {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			roundTrip(t, conn, "ping")
+			conn.Close()
+		}
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("closes connection after handler returns", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(func(context.Context, net.Conn) {})}
+		errs := serve(ctx, &srv, ln)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatalf("Read() error = %v, want %v", err, io.EOF)
+		}
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("waits for in-flight connections", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var finished atomic.Bool
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(func(context.Context, net.Conn) {
+			close(started)
+			<-release
+			finished.Store(true)
+		})}
+		errs := serve(ctx, &srv, ln)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		<-started
+
+		cancel()
+		select {
+		case err := <-errs:
+			t.Fatalf("Serve() returned %v before the handler finished", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+		if !finished.Load() {
+			t.Fatal("Serve() returned before the handler finished")
+		}
+	})
+
+	t.Run("backs off on accept errors", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := &flakyListener{Listener: listen(t), failures: 3}
+		srv := Server{Handler: HandlerFunc(echo)}
+		errs := serve(ctx, &srv, ln)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		roundTrip(t, conn, "ping")
+		conn.Close()
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+		if got := ln.calls.Load(); got < 4 {
+			t.Fatalf("Accept() called %d times, want at least 4", got)
+		}
+	})
+
+	t.Run("returns error when listener is closed", func(t *testing.T) {
+		t.Parallel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo)}
+		errs := serve(context.Background(), &srv, ln)
+
+		ln.Close()
+		if err := wait(t, errs); !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Serve() error = %v, want %v", err, net.ErrClosed)
+		}
+	})
+
+	t.Run("recovers from handler panic", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var once sync.Once
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(func(ctx context.Context, conn net.Conn) {
+			once.Do(func() { panic("boom") })
+			echo(ctx, conn)
+		})}
+		errs := serve(ctx, &srv, ln)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		conn.Close()
+
+		conn, err = net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		roundTrip(t, conn, "ping")
+		conn.Close()
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+
+	t.Run("drains only the connections of its listener", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		otherCtx, cancelOther := context.WithCancel(context.Background())
+		defer cancelOther()
+
+		srv := Server{Handler: HandlerFunc(echo), ShutdownTimeout: 50 * time.Millisecond}
+		ln, other := listen(t), listen(t)
+		errs := serve(ctx, &srv, ln)
+		otherErrs := serve(otherCtx, &srv, other)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		roundTrip(t, conn, "ping")
+		otherConn, err := net.Dial("tcp", other.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer otherConn.Close()
+		roundTrip(t, otherConn, "ping")
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatalf("Read() error = %v, want %v", err, io.EOF)
+		}
+
+		// The other listener's connection outlives the drain.
+		roundTrip(t, otherConn, "pong")
+
+		otherConn.Close()
+		cancelOther()
+		if err := wait(t, otherErrs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	})
+}
+
+// TestServer_Shutdown is not parallel so that goroutine counts are not
+// disturbed by other tests.
+func TestServer_Shutdown(t *testing.T) {
+	t.Run("cancels handler context", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started := make(chan struct{})
+		ln := listen(t)
+		srv := Server{
+			Handler: HandlerFunc(func(ctx context.Context, _ net.Conn) {
+				close(started)
+				<-ctx.Done()
+			}),
+			ShutdownTimeout: time.Hour,
+		}
+		errs := serve(ctx, &srv, ln)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		<-started
+
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+		conn.Close()
+
+		checkGoroutines(t, before)
+	})
+
+	t.Run("force closes connections after timeout", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		const timeout = 50 * time.Millisecond
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo), ShutdownTimeout: timeout}
+		errs := serve(ctx, &srv, ln)
+
+		conns := make([]net.Conn, 10)
+		for i := range conns {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			roundTrip(t, conn, "ping")
+			conns[i] = conn
+		}
+
+		start := time.Now()
+		cancel()
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < timeout {
+			t.Fatalf("Serve() returned after %v, want at least %v", elapsed, timeout)
+		}
+
+		for _, conn := range conns {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+				t.Fatalf("Read() error = %v, want %v", err, io.EOF)
+			}
+			conn.Close()
+		}
+
+		checkGoroutines(t, before)
+	})
+
+	t.Run("lets connections finish within timeout", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ln := listen(t)
+		srv := Server{Handler: HandlerFunc(echo), ShutdownTimeout: time.Hour}
+		errs := serve(ctx, &srv, ln)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		roundTrip(t, conn, "ping")
+
+		cancel()
+		select {
+		case err := <-errs:
+			t.Fatalf("Serve() returned %v while a connection was open", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// The connection still works during the grace period.
+		roundTrip(t, conn, "pong")
+		conn.Close()
+
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+
+		checkGoroutines(t, before)
+	})
+}
+
+// checkGoroutines fails the test if the number of goroutines does not drop
+// back to want within a second.
+func checkGoroutines(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Fatalf("%d goroutines leaked:\n%s", n-want, buf)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func echo(_ context.Context, conn net.Conn) {
+	_, _ = io.Copy(conn, conn)
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	return ln
+}
+
+func serve(ctx context.Context, srv *Server, ln net.Listener) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(ctx, ln)
+	}()
+	return errs
+}
+
+func wait(t *testing.T, errs <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+		return nil
+	}
+}
+
+func roundTrip(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(b) != msg {
+		t.Fatalf("got %q, want %q", b, msg)
+	}
+}
+
+// flakyListener fails the first failures calls to Accept.
+type flakyListener struct {
+	net.Listener
+
+	failures int64
+	calls    atomic.Int64
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.calls.Add(1) <= l.failures {
+		return nil, errors.New("too many open files")
+	}
+	return l.Listener.Accept()
+}
+
+func TestServer_metrics(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const name = "metrics-test"
+
+	// The listeners of one server report their connections apart.
+	srv := Server{Handler: HandlerFunc(echo), Name: name}
+	lns := []net.Listener{listen(t), listen(t)}
+	var errs []<-chan error
+	for _, ln := range lns {
+		errs = append(errs, serve(ctx, &srv, ln))
+	}
+
+	conn, err := net.Dial("tcp", lns[0].Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	roundTrip(t, conn, "ping")
+	conn.Close()
+
+	cancel()
+	for _, errs := range errs {
+		if err := wait(t, errs); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	}
+
+	listener := lns[0].Addr().String()
+	if got := connectionsTotal.With(name, listener).Value(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+	if got := connectionsActive.With(name, listener).Value(); got != 0 {
+		t.Errorf("active connections = %d, want 0", got)
+	}
+	if got := receivedBytes.With(name, listener).Value(); got != 4 {
+		t.Errorf("received bytes = %d, want 4", got)
+	}
+	if got := sentBytes.With(name, listener).Value(); got != 4 {
+		t.Errorf("sent bytes = %d, want 4", got)
+	}
+	if got := connectionDuration.With(name, listener).Count(); got != 1 {
+		t.Errorf("observed durations = %d, want 1", got)
+	}
+	if got := connectionsTotal.With(name, lns[1].Addr().String()).Value(); got != 0 {
+		t.Errorf("connections of the idle listener = %d, want 0", got)
+	}
+}
+
+func TestServer_logger(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil)).With(slog.Int("problem", 0))
+
+	ln := listen(t)
+	srv := Server{
+		Handler: HandlerFunc(func(ctx context.Context, conn net.Conn) {
+			logging.FromContext(ctx).Info("hello")
+		}),
+		Logger: logger,
+	}
+	errs := serve(ctx, &srv, ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	io.ReadAll(conn)
+	conn.Close()
+
+	cancel()
+	if err := wait(t, errs); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	var entry struct {
+		Msg        string `json:"msg"`
+		Problem    *int   `json:"problem"`
+		ConnID     string `json:"conn_id"`
+		RemoteAddr string `json:"remote_addr"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode log entry %q: %v", out.Bytes(), err)
+	}
+	if entry.Msg != "hello" || entry.Problem == nil || entry.ConnID == "" {
+		t.Errorf("log entry = %+v", entry)
+	}
+	if want := conn.LocalAddr().String(); entry.RemoteAddr != want {
+		t.Errorf("remote_addr = %q, want %q", entry.RemoteAddr, want)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// tlsHandshakeTimeout bounds the TLS handshake of a connection accepted
+// from a TLS listener.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// handshake completes the TLS handshake of conn if it comes from a TLS
+// listener, such as one returned by tls.NewListener, and logs what was
+// negotiated. It reports whether the connection may be served.
+func (s *Server) handshake(ctx context.Context, conn net.Conn, listener string, logger *slog.Logger) bool {
+	tc := tlsConn(conn)
+	if tc == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+	if err := tc.HandshakeContext(ctx); err != nil {
+		errorsTotal.With(s.Name, listener, "tls_handshake").Inc()
+		logger.Warn("tls handshake failed", slog.Any("err", err))
+		return false
+	}
+
+	state := tc.ConnectionState()
+	attrs := []any{
+		slog.String("tls_version", tls.VersionName(state.Version)),
+		slog.String("cipher_suite", tls.CipherSuiteName(state.CipherSuite)),
+		slog.Bool("resumed", state.DidResume),
+	}
+	if state.ServerName != "" {
+		attrs = append(attrs, slog.String("server_name", state.ServerName))
+	}
+	if state.NegotiatedProtocol != "" {
+		attrs = append(attrs, slog.String("alpn", state.NegotiatedProtocol))
+	}
+	if len(state.PeerCertificates) > 0 {
+		attrs = append(attrs, slog.String("client_cert", state.PeerCertificates[0].Subject.String()))
+	}
+	logger.Info("tls handshake complete", attrs...)
+	return true
+}
+
+// tlsConn returns the TLS connection conn is or wraps, or nil. Wrappers
+// expose what they wrap through a NetConn method, as tls.Conn itself does.
+func tlsConn(conn net.Conn) *tls.Conn {
+	for conn != nil {
+		if tc, ok := conn.(*tls.Conn); ok {
+			return tc
+		}
+		w, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil
+		}
+		conn = w.NetConn()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sklyar/protohackers/internal/tlsconfig"
+)
+
+func TestServer_tls(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const name = "tls-test"
+
+	ca, err := tlsconfig.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	serverCert, err := ca.Issue("127.0.0.1")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	clientCert, err := ca.Issue("alice")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	var out syncBuffer
+	ln := tls.NewListener(listen(t), &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	srv := Server{Handler: HandlerFunc(echo), Name: name, Logger: slog.New(slog.NewJSONHandler(&out, nil))}
+	errs := serve(ctx, &srv, ln)
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		RootCAs:      ca.Pool(),
+		Certificates: []tls.Certificate{clientCert},
+	})
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	roundTrip(t, conn, "ping")
+	conn.Close()
+
+	// A peer that does not speak TLS never reaches the handler.
+	plain, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	plain.Write([]byte("ping\n"))
+	plain.SetReadDeadline(time.Now().Add(time.Second))
+	io.ReadAll(plain)
+	plain.Close()
+
+	cancel()
+	if err := wait(t, errs); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	if got := errorsTotal.With(name, ln.Addr().String(), "tls_handshake").Value(); got != 1 {
+		t.Errorf("handshake errors = %d, want 1", got)
+	}
+
+	var complete struct {
+		Version     string `json:"tls_version"`
+		CipherSuite string `json:"cipher_suite"`
+		ClientCert  string `json:"client_cert"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out.Bytes())), "\n") {
+		if strings.Contains(line, `"tls handshake complete"`) {
+			if err := json.Unmarshal([]byte(line), &complete); err != nil {
+				t.Fatalf("failed to decode log entry %q: %v", line, err)
+			}
+		}
+	}
+	if complete.Version != "TLS 1.3" || complete.CipherSuite == "" || complete.ClientCert != "CN=alice" {
+		t.Errorf("logged handshake %+v, want TLS 1.3 with a cipher suite and client alice", complete)
+	}
+}
+
+func Test_tlsConn(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	tc := tls.Server(server, &tls.Config{})
+	tests := []struct {
+		name string
+		conn net.Conn
+		want *tls.Conn
+	}{
+		{name: "plain", conn: server},
+		{name: "tls", conn: tc, want: tc},
+		{name: "wrapped", conn: wrapper{tc}, want: tc},
+		{name: "wrapped plain", conn: wrapper{server}},
+	}
+	for _, tt := range tests {
+		if got := tlsConn(tt.conn); got != tt.want {
+			t.Errorf("%s: tlsConn() = %p, want %p", tt.name, got, tt.want)
+		}
+	}
+}
+
+type wrapper struct{ net.Conn }
+
+func (w wrapper) NetConn() net.Conn { return w.Conn }
@@ -0,0 +1,128 @@
+// Package tlsconfig builds the TLS configurations of servers and clients
+// from certificate files, or from a self-signed CA generated for local
+// testing.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Options configure the server TLS settings built by Config.
+type Options struct {
+	// CertFile and KeyFile hold the PEM-encoded certificate chain and key
+	// of the server.
+	CertFile string
+	KeyFile  string
+
+	// SelfSignedCA, if set, makes Config generate a CA and a server
+	// certificate for localhost issued by it, in place of CertFile and
+	// KeyFile. The CA certificate is written to this path for clients to
+	// trust.
+	SelfSignedCA string
+
+	// ClientCAFile, if set, holds the PEM-encoded CA certificates that
+	// client certificates must be issued by. Clients without one are
+	// refused.
+	ClientCAFile string
+}
+
+// RegisterFlags registers command-line flags for the options on fs.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.CertFile, "tls-cert", "", "PEM certificate chain file of tls:// listeners")
+	fs.StringVar(&o.KeyFile, "tls-key", "", "PEM private key file of tls:// listeners")
+	fs.StringVar(&o.SelfSignedCA, "tls-self-signed-ca", "", "generate a self-signed CA and a localhost certificate for tls:// listeners, and write the CA certificate to this file")
+	fs.StringVar(&o.ClientCAFile, "tls-client-ca", "", "PEM file of the CAs client certificates must be issued by; clients without one are refused (disabled if empty)")
+}
+
+// Config returns the server TLS configuration described by the options.
+func (o Options) Config() (*tls.Config, error) {
+	var cert tls.Certificate
+	switch {
+	case o.SelfSignedCA != "" && (o.CertFile != "" || o.KeyFile != ""):
+		return nil, errors.New("a self-signed CA and certificate files are mutually exclusive")
+	case o.SelfSignedCA != "":
+		ca, err := GenerateCA()
+		if err != nil {
+			return nil, err
+		}
+		if cert, err = ca.Issue(localNames()...); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(o.SelfSignedCA, ca.CertPEM(), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write the CA certificate: %w", err)
+		}
+	case o.CertFile != "" && o.KeyFile != "":
+		var err error
+		if cert, err = tls.LoadX509KeyPair(o.CertFile, o.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load the certificate: %w", err)
+		}
+	case o.CertFile != "" || o.KeyFile != "":
+		return nil, errors.New("a certificate file needs a key file and the other way round")
+	default:
+		return nil, errors.New("no certificate: give certificate and key files or a self-signed CA")
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.ClientCAFile != "" {
+		pool, err := LoadPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Client returns a client TLS configuration. The server certificate is
+// verified against the CAs in caFile, or the system roots if it is empty.
+// The client presents the certificate in certFile and keyFile if they are
+// set.
+func Client(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := LoadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// LoadPool returns a pool of the PEM-encoded certificates in path.
+func LoadPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	return pool, nil
+}
+
+// localNames are the names a self-signed server certificate is valid for.
+func localNames() []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if host, err := os.Hostname(); err == nil && host != "localhost" {
+		names = append(names, host)
+	}
+	return names
+}
@@ -0,0 +1,179 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOptions_Config(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	certFile, keyFile := writeKeyPair(t, dir, "server", ca, "localhost")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.CertPEM(), 0o600); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "files", opts: Options{CertFile: certFile, KeyFile: keyFile}},
+		{name: "self-signed", opts: Options{SelfSignedCA: filepath.Join(dir, "self-signed.pem")}},
+		{name: "client CA", opts: Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}},
+		{name: "nothing", wantErr: "no certificate"},
+		{name: "certificate without key", opts: Options{CertFile: certFile}, wantErr: "a certificate file needs a key file"},
+		{name: "both", opts: Options{CertFile: certFile, KeyFile: keyFile, SelfSignedCA: caFile}, wantErr: "mutually exclusive"},
+		{name: "missing file", opts: Options{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}, wantErr: "failed to load the certificate"},
+		{name: "client CA without certificates", opts: Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}, wantErr: "no certificate in"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := tt.opts.Config()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Config() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Config() error = %v", err)
+			}
+			if len(cfg.Certificates) != 1 {
+				t.Errorf("Config() has %d certificates, want 1", len(cfg.Certificates))
+			}
+			if want := tt.opts.ClientCAFile != ""; (cfg.ClientAuth == tls.RequireAndVerifyClientCert) != want {
+				t.Errorf("Config() client auth = %v, want it required: %v", cfg.ClientAuth, want)
+			}
+		})
+	}
+}
+
+func TestSelfSigned(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	serverCfg, err := Options{SelfSignedCA: caFile}.Config()
+	if err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+	clientCfg, err := Client(caFile, "", "")
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	clientCfg.ServerName = "localhost"
+
+	if err := handshake(t, serverCfg, clientCfg); err != nil {
+		t.Errorf("handshake error = %v", err)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.CertPEM(), 0o600); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	serverCert, serverKey := writeKeyPair(t, dir, "server", ca, "127.0.0.1")
+	clientCert, clientKey := writeKeyPair(t, dir, "client", ca, "alice")
+
+	serverCfg, err := Options{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: caFile}.Config()
+	if err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+
+	withCert, err := Client(caFile, clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	if err := handshake(t, serverCfg, withCert); err != nil {
+		t.Errorf("handshake with a client certificate error = %v", err)
+	}
+
+	withoutCert, err := Client(caFile, "", "")
+	if err != nil {
+		t.Fatalf("Client() error = %v", err)
+	}
+	if err := handshake(t, serverCfg, withoutCert); err == nil {
+		t.Error("handshake without a client certificate succeeded, want an error")
+	}
+}
+
+// handshake connects a client to a server over loopback and returns the
+// error of the server side of the handshake.
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) error {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+	if err == nil {
+		conn.Close()
+	}
+	return <-errs
+}
+
+// writeKeyPair writes a certificate issued by ca for names, and its key,
+// to PEM files in dir.
+func writeKeyPair(t *testing.T, dir, name string, ca *CA, names ...string) (certFile, keyFile string) {
+	t.Helper()
+
+	cert, err := ca.Issue(names...)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	var certPEM []byte
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}